@@ -2,20 +2,37 @@ package config
 
 import (
 	"os"
+	"runtime"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/mohammed-ysn/cluster-imager/internal/decoder"
+	"github.com/mohammed-ysn/cluster-imager/pkg/validation"
+)
+
+// Modes select which components a process runs.
+const (
+	ModeAPI    = "api"
+	ModeWorker = "worker"
+	ModeAll    = "all"
 )
 
 type Config struct {
+	Mode    string
 	Server  ServerConfig
 	Redis   RedisConfig
 	NATS    NATSConfig
+	Queue   QueueConfig
 	Storage StorageConfig
 	Job     JobConfig
+	Worker  WorkerConfig
+	Image   ImageConfig
 }
 
 type ServerConfig struct {
-	Port string
+	Port            string
+	ShutdownTimeout time.Duration
 }
 
 type RedisConfig struct {
@@ -23,43 +40,101 @@ type RedisConfig struct {
 }
 
 type NATSConfig struct {
-	URL      string
-	Stream   string
-	Subject  string
-	Consumer string
-	MaxRetry int
+	URL               string
+	Stream            string
+	Subject           string
+	Consumer          string
+	MaxRetry          int
+	DeadLetterStream  string
+	DeadLetterSubject string
+	RetryBaseDelay    time.Duration
+	RetryMaxDelay     time.Duration
+	RetryJitter       float64
+}
+
+type QueueConfig struct {
+	Type string
 }
 
 type StorageConfig struct {
-	Type      string
-	LocalPath string
+	Type       string
+	LocalPath  string
+	LocalFsync bool
+	Endpoint   string
+	Bucket     string
+	AccessKey  string
+	SecretKey  string
+	Region     string
+	UseSSL     bool
 }
 
 type JobConfig struct {
-	TTL time.Duration
+	Store string
+	TTL   time.Duration
+}
+
+type WorkerConfig struct {
+	Concurrency int
+	// MemoryBudget bounds the estimated decode memory of jobs in flight, in
+	// bytes. Zero or less disables the budget.
+	MemoryBudget int64
+}
+
+// ImageConfig limits the images accepted by the API and the worker
+type ImageConfig struct {
+	MaxPixels    int
+	MaxDimension int
+	Formats      []string // empty allows every supported format
 }
 
 func Load() *Config {
 	return &Config{
+		Mode: getEnv("MODE", ModeAll),
 		Server: ServerConfig{
-			Port: getEnv("PORT", "8080"),
+			Port:            getEnv("PORT", "8080"),
+			ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 25*time.Second),
 		},
 		Redis: RedisConfig{
 			URL: getEnv("REDIS_URL", "redis://localhost:6379"),
 		},
 		NATS: NATSConfig{
-			URL:      getEnv("NATS_URL", "nats://localhost:4222"),
-			Stream:   getEnv("NATS_STREAM", "IMAGES"),
-			Subject:  getEnv("NATS_SUBJECT", "images.process"),
-			Consumer: getEnv("NATS_CONSUMER", "worker"),
-			MaxRetry: getEnvInt("NATS_MAX_RETRY", 3),
+			URL:               getEnv("NATS_URL", "nats://localhost:4222"),
+			Stream:            getEnv("NATS_STREAM", "IMAGES"),
+			Subject:           getEnv("NATS_SUBJECT", "images.process"),
+			Consumer:          getEnv("NATS_CONSUMER", "worker"),
+			MaxRetry:          getEnvInt("NATS_MAX_RETRY", 3),
+			DeadLetterStream:  getEnv("NATS_DLQ_STREAM", "IMAGES_DLQ"),
+			DeadLetterSubject: getEnv("NATS_DLQ_SUBJECT", "images.process.dlq"),
+			RetryBaseDelay:    getEnvDuration("NATS_RETRY_BASE_DELAY", time.Second),
+			RetryMaxDelay:     getEnvDuration("NATS_RETRY_MAX_DELAY", time.Minute),
+			RetryJitter:       getEnvFloat("NATS_RETRY_JITTER", 0.2),
+		},
+		Queue: QueueConfig{
+			Type: getEnv("QUEUE_TYPE", "nats"),
 		},
 		Storage: StorageConfig{
-			Type:      getEnv("STORAGE_TYPE", "local"),
-			LocalPath: getEnv("STORAGE_LOCAL_PATH", "/tmp/cluster-imager"),
+			Type:       getEnv("STORAGE_TYPE", "local"),
+			LocalPath:  getEnv("STORAGE_LOCAL_PATH", "/tmp/cluster-imager"),
+			LocalFsync: getEnvBool("STORAGE_LOCAL_FSYNC", true),
+			Endpoint:   getEnv("STORAGE_ENDPOINT", "localhost:9000"),
+			Bucket:     getEnv("STORAGE_BUCKET", "cluster-imager"),
+			AccessKey:  getEnv("STORAGE_ACCESS_KEY", ""),
+			SecretKey:  getEnv("STORAGE_SECRET_KEY", ""),
+			Region:     getEnv("STORAGE_REGION", "us-east-1"),
+			UseSSL:     getEnvBool("STORAGE_USE_SSL", false),
 		},
 		Job: JobConfig{
-			TTL: getEnvDuration("JOB_TTL", 24*time.Hour),
+			Store: getEnv("JOB_STORE", "redis"),
+			TTL:   getEnvDuration("JOB_TTL", 24*time.Hour),
+		},
+		Worker: WorkerConfig{
+			Concurrency:  getEnvInt("WORKER_CONCURRENCY", runtime.NumCPU()),
+			MemoryBudget: getEnvBytes("WORKER_MEMORY_BUDGET", 1<<30),
+		},
+		Image: ImageConfig{
+			MaxPixels:    getEnvInt("MAX_IMAGE_PIXELS", decoder.DefaultMaxPixels),
+			MaxDimension: getEnvInt("MAX_IMAGE_DIMENSION", validation.MaxImageDimension),
+			Formats:      getEnvList("ALLOWED_IMAGE_FORMATS"),
 		},
 	}
 }
@@ -80,6 +155,24 @@ func getEnvInt(key string, fallback int) int {
 	return fallback
 }
 
+func getEnvFloat(key string, fallback float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
 func getEnvDuration(key string, fallback time.Duration) time.Duration {
 	if v := os.Getenv(key); v != "" {
 		if d, err := time.ParseDuration(v); err == nil {
@@ -88,3 +181,34 @@ func getEnvDuration(key string, fallback time.Duration) time.Duration {
 	}
 	return fallback
 }
+
+// getEnvList reads a comma-separated list, ignoring empty entries
+func getEnvList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// getEnvBytes reads a byte count, optionally suffixed Ki, Mi or Gi
+func getEnvBytes(key string, fallback int64) int64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	unit := int64(1)
+	for suffix, size := range map[string]int64{"Ki": 1 << 10, "Mi": 1 << 20, "Gi": 1 << 30} {
+		if n, ok := strings.CutSuffix(v, suffix); ok {
+			v, unit = n, size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return n * unit
+}
@@ -0,0 +1,122 @@
+// Package decoder decodes untrusted images within limits on their format and
+// declared size. The format is sniffed from the data, not taken on trust, and
+// the size is checked before decoding so that a small file cannot make the
+// decoder allocate gigabytes.
+package decoder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Register the standard library formats
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+	"github.com/mohammed-ysn/cluster-imager/pkg/validation"
+)
+
+const (
+	// DefaultMaxPixels is the default bound on width x height
+	DefaultMaxPixels = 40_000_000
+)
+
+// ErrTooLarge is returned for images whose declared size exceeds the limits
+var ErrTooLarge = errors.New("image exceeds size limits")
+
+// Limits bound the images that may be decoded. Zero fields use the defaults.
+type Limits struct {
+	MaxPixels    int      // width x height; defaults to DefaultMaxPixels
+	MaxDimension int      // width or height; defaults to validation.MaxImageDimension
+	Formats      []string // allowed formats; defaults to all of Formats
+}
+
+func (l Limits) maxPixels() int {
+	if l.MaxPixels > 0 {
+		return l.MaxPixels
+	}
+	return DefaultMaxPixels
+}
+
+func (l Limits) maxDimension() int {
+	if l.MaxDimension > 0 {
+		return l.MaxDimension
+	}
+	return validation.MaxImageDimension
+}
+
+// Check returns ErrTooLarge if a width x height image exceeds the limits
+func (l Limits) Check(width, height int) error {
+	if width > l.maxDimension() || height > l.maxDimension() {
+		return fmt.Errorf("%dx%d exceeds %d pixels per side: %w", width, height, l.maxDimension(), ErrTooLarge)
+	}
+	if int64(width)*int64(height) > int64(l.maxPixels()) {
+		return fmt.Errorf("%dx%d exceeds %d pixels: %w", width, height, l.maxPixels(), ErrTooLarge)
+	}
+	return nil
+}
+
+// DecodeConfig sniffs the format, reads the image header and checks both
+// against limits
+func DecodeConfig(data []byte, limits Limits) (image.Config, string, error) {
+	sniffed, err := limits.checkFormat(data)
+	if err != nil {
+		return image.Config{}, sniffed, err
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return cfg, format, err
+	}
+	if format != sniffed {
+		return cfg, format, fmt.Errorf("%s data decoded as %s: %w", sniffed, format, ErrUnsupportedFormat)
+	}
+	if err := limits.Check(cfg.Width, cfg.Height); err != nil {
+		return cfg, format, err
+	}
+	return cfg, format, nil
+}
+
+// Code returns the job error code for a failure to decode
+func Code(err error) job.ErrorCode {
+	switch {
+	case errors.Is(err, ErrTooLarge):
+		return job.CodeImageTooLarge
+	case errors.Is(err, ErrUnsupportedFormat):
+		return job.CodeUnsupportedFormat
+	}
+	return job.CodeInvalidImage
+}
+
+// Decode decodes an image after checking its header against limits, so that
+// nothing is allocated for an image that is too large
+func Decode(data []byte, limits Limits) (image.Image, string, error) {
+	if _, _, err := DecodeConfig(data, limits); err != nil {
+		return nil, "", err
+	}
+	return image.Decode(bytes.NewReader(data))
+}
+
+// EstimateMemory approximates the bytes needed to hold a decoded image
+func EstimateMemory(cfg image.Config) int64 {
+	return int64(cfg.Width) * int64(cfg.Height) * bytesPerPixel(cfg.ColorModel)
+}
+
+// bytesPerPixel returns the size of a decoded pixel in a colour model
+func bytesPerPixel(m color.Model) int64 {
+	switch m {
+	case color.GrayModel, color.AlphaModel:
+		return 1
+	case color.Gray16Model, color.Alpha16Model:
+		return 2
+	case color.YCbCrModel: // 4:4:4 is the largest subsampling
+		return 3
+	case color.RGBA64Model, color.NRGBA64Model:
+		return 8
+	}
+	if _, ok := m.(color.Palette); ok {
+		return 1
+	}
+	return 4
+}
@@ -0,0 +1,212 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// pngHeader returns the signature and IHDR chunk of an 8-bit RGBA PNG
+// declaring the given size. It has no pixel data.
+func pngHeader(width, height uint32) []byte {
+	var ihdr [17]byte
+	copy(ihdr[:4], "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	ihdr[12] = 8 // bit depth
+	ihdr[13] = 6 // RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(13))
+	buf.Write(ihdr[:])
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(ihdr[:]))
+	return buf.Bytes()
+}
+
+func TestLimitsCheck(t *testing.T) {
+	tests := []struct {
+		name          string
+		limits        Limits
+		width, height int
+		wantErr       bool
+	}{
+		{"within defaults", Limits{}, 6000, 6000, false},
+		{"default dimension", Limits{}, 10001, 1, true},
+		{"default pixels", Limits{}, 8000, 8000, true},
+		{"custom pixels", Limits{MaxPixels: 100}, 10, 11, true},
+		{"custom dimension", Limits{MaxDimension: 50}, 51, 1, true},
+		{"at limits", Limits{MaxPixels: 100, MaxDimension: 10}, 10, 10, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.Check(tt.width, tt.height)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrTooLarge) {
+				t.Errorf("expected ErrTooLarge, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecode_RejectsDeclaredSize(t *testing.T) {
+	// Decoding this header in full would allocate 1.6GB
+	data := pngHeader(20000, 20000)
+
+	if _, _, err := DecodeConfig(data, Limits{MaxDimension: 20000}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("DecodeConfig() error = %v, want ErrTooLarge", err)
+	}
+	if _, _, err := Decode(data, Limits{MaxDimension: 20000}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Decode() error = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+
+	img, format, err := Decode(buf.Bytes(), Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "png" || img.Bounds().Dx() != 4 || img.Bounds().Dy() != 3 {
+		t.Errorf("decoded %s %v", format, img.Bounds())
+	}
+
+	if _, _, err := Decode([]byte("not an image"), Limits{}); err == nil || errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected a format error, got %v", err)
+	}
+}
+
+func TestEstimateMemory(t *testing.T) {
+	tests := []struct {
+		model color.Model
+		want  int64
+	}{
+		{color.GrayModel, 100 * 1},
+		{color.YCbCrModel, 100 * 3},
+		{color.NRGBAModel, 100 * 4},
+		{color.NRGBA64Model, 100 * 8},
+		{color.Palette{color.Black}, 100 * 1},
+	}
+
+	for _, tt := range tests {
+		cfg := image.Config{ColorModel: tt.model, Width: 10, Height: 10}
+		if got := EstimateMemory(cfg); got != tt.want {
+			t.Errorf("EstimateMemory(%T) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"jpeg", "\xff\xd8\xff\xe0", "jpeg"},
+		{"png", "\x89PNG\r\n\x1a\n", "png"},
+		{"gif87a", "GIF87a", "gif"},
+		{"gif89a", "GIF89a", "gif"},
+		{"bmp", "BM\x00\x00", "bmp"},
+		{"tiff little endian", "II*\x00", "tiff"},
+		{"tiff big endian", "MM\x00*", "tiff"},
+		{"webp", "RIFF\x24\x00\x00\x00WEBPVP8 ", "webp"},
+		{"riff but not webp", "RIFF\x24\x00\x00\x00WAVE", ""},
+		{"text", "not an image", ""},
+		{"truncated", "\x89PN", ""},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sniff([]byte(tt.data))
+			if tt.want == "" {
+				if !errors.Is(err, ErrUnsupportedFormat) {
+					t.Errorf("Sniff() = %q, %v, want ErrUnsupportedFormat", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Sniff() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesContentType(t *testing.T) {
+	tests := []struct {
+		format      string
+		contentType string
+		want        bool
+	}{
+		{"jpeg", "image/jpeg", true},
+		{"jpeg", "image/jpg", true},
+		{"png", "image/png; charset=binary", true},
+		{"png", "", true},
+		{"png", "application/octet-stream", true},
+		{"png", "image/jpeg", false},
+		{"gif", "text/plain", false},
+		{"webp", "not a media type", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchesContentType(tt.format, tt.contentType); got != tt.want {
+			t.Errorf("MatchesContentType(%q, %q) = %v, want %v", tt.format, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestDecode_Formats(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	encoders := map[string]func(*bytes.Buffer) error{
+		"png":  func(b *bytes.Buffer) error { return png.Encode(b, img) },
+		"bmp":  func(b *bytes.Buffer) error { return bmp.Encode(b, img) },
+		"tiff": func(b *bytes.Buffer) error { return tiff.Encode(b, img, nil) },
+	}
+
+	for format, encode := range encoders {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encode(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, got, err := Decode(buf.Bytes(), Limits{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != format || decoded.Bounds().Dx() != 4 {
+				t.Errorf("decoded %s %v", got, decoded.Bounds())
+			}
+
+			other := "jpeg"
+			_, _, err = Decode(buf.Bytes(), Limits{Formats: []string{other}})
+			if !errors.Is(err, ErrUnsupportedFormat) {
+				t.Errorf("expected ErrUnsupportedFormat when only %s is allowed, got %v", other, err)
+			}
+		})
+	}
+}
+
+func TestValidateFormats(t *testing.T) {
+	if err := ValidateFormats([]string{"jpeg", "webp"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ValidateFormats([]string{"jpeg", "avif"}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
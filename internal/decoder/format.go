@@ -0,0 +1,116 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"slices"
+
+	_ "golang.org/x/image/bmp" // Register the formats the standard library lacks
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// ErrUnsupportedFormat is returned for data that is not in an allowed format
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// Formats lists the supported input formats, by the names image.Decode reports
+var Formats = []string{"jpeg", "png", "gif", "bmp", "tiff", "webp"}
+
+// magic identifies a format by the bytes it starts with. '?' matches any byte.
+var magic = []struct {
+	format string
+	prefix string
+}{
+	{"jpeg", "\xff\xd8\xff"},
+	{"png", "\x89PNG\r\n\x1a\n"},
+	{"gif", "GIF87a"},
+	{"gif", "GIF89a"},
+	{"bmp", "BM"},
+	{"tiff", "II*\x00"},
+	{"tiff", "MM\x00*"},
+	{"webp", "RIFF????WEBP"},
+}
+
+// contentTypes maps each format to its MIME type, then any aliases clients send
+var contentTypes = map[string][]string{
+	"jpeg": {"image/jpeg", "image/jpg", "image/pjpeg"},
+	"png":  {"image/png", "image/x-png"},
+	"gif":  {"image/gif"},
+	"bmp":  {"image/bmp", "image/x-bmp", "image/x-ms-bmp"},
+	"tiff": {"image/tiff"},
+	"webp": {"image/webp"},
+}
+
+// Sniff detects the format of data from its leading bytes
+func Sniff(data []byte) (string, error) {
+	for _, m := range magic {
+		if matchMagic(data, m.prefix) {
+			return m.format, nil
+		}
+	}
+	return "", ErrUnsupportedFormat
+}
+
+func matchMagic(data []byte, prefix string) bool {
+	if len(data) < len(prefix) {
+		return false
+	}
+	for i := range len(prefix) {
+		if prefix[i] != '?' && data[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ContentType returns the MIME type of a supported format
+func ContentType(format string) string {
+	if types, ok := contentTypes[format]; ok {
+		return types[0]
+	}
+	return "application/octet-stream"
+}
+
+// MatchesContentType reports whether a client-declared content type is
+// consistent with format. Generic or missing types match anything.
+func MatchesContentType(format, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType == ""
+	}
+	if mediaType == "application/octet-stream" {
+		return true
+	}
+	return slices.Contains(contentTypes[format], mediaType)
+}
+
+// checkFormat sniffs data and checks its format is allowed
+func (l Limits) checkFormat(data []byte) (string, error) {
+	format, err := Sniff(data)
+	if err != nil {
+		return "", err
+	}
+	if !l.Allows(format) {
+		return format, fmt.Errorf("%s is not allowed: %w", format, ErrUnsupportedFormat)
+	}
+	return format, nil
+}
+
+// Allows reports whether format is an allowed input format
+func (l Limits) Allows(format string) bool {
+	if len(l.Formats) == 0 {
+		return slices.Contains(Formats, format)
+	}
+	return slices.Contains(l.Formats, format)
+}
+
+// ValidateFormats checks that each format is supported
+func ValidateFormats(formats []string) error {
+	for _, f := range formats {
+		if !slices.Contains(Formats, f) {
+			return fmt.Errorf("unknown image format %q (supported: %v)", f, Formats)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package encoders
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+// FallbackFormat is used when the output keeps the input format but no
+// encoder is registered for it. PNG is lossless and keeps transparency.
+const FallbackFormat = "png"
+
+// Encoder defines the interface for image encoders
+type Encoder interface {
+	// Encode writes img to w. Options in out that do not apply to the
+	// format are ignored.
+	Encode(w io.Writer, img image.Image, out job.Output) error
+
+	// ValidateOptions checks the options in out that apply to the format
+	ValidateOptions(out job.Output) error
+
+	// ContentType returns the MIME type of encoded images
+	ContentType() string
+
+	// Extension returns the file extension of encoded images, without a dot
+	Extension() string
+
+	Name() string
+}
+
+// validateQuality checks a 1-100 quality, where 0 selects the encoder default
+func validateQuality(quality int) error {
+	if quality < 0 || quality > 100 {
+		return fmt.Errorf("quality must be between 1 and 100")
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package encoders
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+func testImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 8), G: uint8(y * 8), B: 128, A: uint8(x * 8)})
+		}
+	}
+	return img
+}
+
+func TestEncoders_RoundTrip(t *testing.T) {
+	for _, name := range DefaultRegistry().List() {
+		t.Run(name, func(t *testing.T) {
+			enc, _ := DefaultRegistry().Get(name)
+
+			var buf bytes.Buffer
+			if err := enc.Encode(&buf, testImage(), job.Output{}); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			img, format, err := image.Decode(&buf)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if format != name {
+				t.Errorf("decoded format = %s, want %s", format, name)
+			}
+			if b := img.Bounds(); b.Dx() != 32 || b.Dy() != 32 {
+				t.Errorf("Expected 32x32, got %dx%d", b.Dx(), b.Dy())
+			}
+		})
+	}
+}
+
+func TestPNGEncoder_KeepsAlpha(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewPNGEncoder().Encode(&buf, testImage(), job.Output{Compression: "best"}); err != nil {
+		t.Fatal(err)
+	}
+	img, _, err := image.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("Expected transparent pixel, got alpha %d", a)
+	}
+}
+
+func TestJPEGEncoder_Quality(t *testing.T) {
+	enc := NewJPEGEncoder()
+	var low, high bytes.Buffer
+	if err := enc.Encode(&low, testImage(), job.Output{Quality: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(&high, testImage(), job.Output{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	if low.Len() >= high.Len() {
+		t.Errorf("Expected quality 10 (%d bytes) to be smaller than quality 95 (%d bytes)", low.Len(), high.Len())
+	}
+}
+
+func TestEncoders_ValidateOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoder Encoder
+		output  job.Output
+		wantErr bool
+	}{
+		{"jpeg defaults", NewJPEGEncoder(), job.Output{}, false},
+		{"jpeg quality", NewJPEGEncoder(), job.Output{Quality: 80}, false},
+		{"jpeg quality too high", NewJPEGEncoder(), job.Output{Quality: 101}, true},
+		{"jpeg negative quality", NewJPEGEncoder(), job.Output{Quality: -1}, true},
+		{"jpeg progressive", NewJPEGEncoder(), job.Output{Progressive: true}, false},
+		{"jpeg ignores compression", NewJPEGEncoder(), job.Output{Compression: "best"}, false},
+		{"png compression", NewPNGEncoder(), job.Output{Compression: "fast"}, false},
+		{"png unknown compression", NewPNGEncoder(), job.Output{Compression: "max"}, true},
+		{"png ignores quality", NewPNGEncoder(), job.Output{Quality: 80}, false},
+		{"gif", NewGIFEncoder(), job.Output{Quality: 80}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.encoder.ValidateOptions(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package encoders
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+// gifPalette is Plan9 with its last entry given over to transparency
+var gifPalette = append(append(color.Palette{}, palette.Plan9[:255]...), color.Transparent)
+
+// gifTransparent is the index of the transparent entry in gifPalette
+const gifTransparent = 255
+
+type GIFEncoder struct{}
+
+func NewGIFEncoder() *GIFEncoder {
+	return &GIFEncoder{}
+}
+
+func (e *GIFEncoder) Encode(w io.Writer, img image.Image, _ job.Output) error {
+	if p, ok := img.(*image.Paletted); ok {
+		return gif.Encode(w, p, nil)
+	}
+	return gif.Encode(w, quantizeGIF(img), nil)
+}
+
+// quantizeGIF dithers img's colours, with alpha ignored, to gifPalette and
+// marks pixels that are less than half opaque as transparent
+func quantizeGIF(img image.Image) *image.Paletted {
+	b := img.Bounds()
+	opaque := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			c.A = 0xff
+			opaque.SetNRGBA(x, y, c)
+		}
+	}
+
+	dst := image.NewPaletted(b, gifPalette)
+	draw.FloydSteinberg.Draw(dst, b, opaque, b.Min)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a < 0x8000 {
+				dst.SetColorIndex(x, y, gifTransparent)
+			}
+		}
+	}
+	return dst
+}
+
+// ValidateOptions accepts anything: GIF has no encoder options
+func (e *GIFEncoder) ValidateOptions(_ job.Output) error { return nil }
+
+func (e *GIFEncoder) ContentType() string { return "image/gif" }
+
+func (e *GIFEncoder) Extension() string { return "gif" }
+
+func (e *GIFEncoder) Name() string { return "gif" }
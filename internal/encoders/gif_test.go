@@ -0,0 +1,81 @@
+package encoders
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+func TestGIFEncoder_Transparency(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			switch {
+			case x < 4:
+				src.SetNRGBA(x, y, color.NRGBA{R: 255, G: 255, B: 255, A: 0})
+			case x < 6:
+				src.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+			default:
+				src.SetNRGBA(x, y, color.NRGBA{B: 255, A: 200})
+			}
+		}
+	}
+	var in bytes.Buffer
+	if err := png.Encode(&in, src); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := NewGIFEncoder().Encode(&out, decoded, job.Output{}); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got, err := gif.Decode(&out)
+	if err != nil {
+		t.Fatalf("gif.Decode() error = %v", err)
+	}
+
+	tests := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, color.RGBA{}},
+		{3, 7, color.RGBA{}},
+		{4, 0, color.RGBA{R: 255, A: 255}},
+		{7, 7, color.RGBA{B: 255, A: 255}},
+	}
+	for _, tt := range tests {
+		if c := color.RGBAModel.Convert(got.At(tt.x, tt.y)); c != tt.want {
+			t.Errorf("pixel (%d,%d) = %v, want %v", tt.x, tt.y, c, tt.want)
+		}
+	}
+}
+
+func TestGIFEncoder_KeepsPalettedInput(t *testing.T) {
+	pal := color.Palette{color.Transparent, color.RGBA{G: 255, A: 255}}
+	src := image.NewPaletted(image.Rect(0, 0, 2, 1), pal)
+	src.SetColorIndex(1, 0, 1)
+
+	var out bytes.Buffer
+	if err := NewGIFEncoder().Encode(&out, src, job.Output{}); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got, err := gif.Decode(&out)
+	if err != nil {
+		t.Fatalf("gif.Decode() error = %v", err)
+	}
+	if _, _, _, a := got.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("pixel (0,0) alpha = %d, want 0", a)
+	}
+	if c := color.RGBAModel.Convert(got.At(1, 0)); c != (color.RGBA{G: 255, A: 255}) {
+		t.Errorf("pixel (1,0) = %v, want opaque green", c)
+	}
+}
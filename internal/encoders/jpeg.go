@@ -0,0 +1,36 @@
+package encoders
+
+import (
+	"image"
+	"image/jpeg"
+	"io"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+type JPEGEncoder struct{}
+
+func NewJPEGEncoder() *JPEGEncoder {
+	return &JPEGEncoder{}
+}
+
+func (e *JPEGEncoder) Encode(w io.Writer, img image.Image, out job.Output) error {
+	opts := &jpeg.Options{Quality: jpeg.DefaultQuality}
+	if out.Quality > 0 {
+		opts.Quality = out.Quality
+	}
+	if out.Progressive {
+		return encodeProgressive(w, img, opts.Quality)
+	}
+	return jpeg.Encode(w, img, opts)
+}
+
+func (e *JPEGEncoder) ValidateOptions(out job.Output) error {
+	return validateQuality(out.Quality)
+}
+
+func (e *JPEGEncoder) ContentType() string { return "image/jpeg" }
+
+func (e *JPEGEncoder) Extension() string { return "jpg" }
+
+func (e *JPEGEncoder) Name() string { return "jpeg" }
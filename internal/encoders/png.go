@@ -0,0 +1,43 @@
+package encoders
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+// pngCompression maps job.Output.Compression to PNG compression levels
+var pngCompression = map[string]png.CompressionLevel{
+	"":        png.DefaultCompression,
+	"default": png.DefaultCompression,
+	"none":    png.NoCompression,
+	"fast":    png.BestSpeed,
+	"best":    png.BestCompression,
+}
+
+type PNGEncoder struct{}
+
+func NewPNGEncoder() *PNGEncoder {
+	return &PNGEncoder{}
+}
+
+func (e *PNGEncoder) Encode(w io.Writer, img image.Image, out job.Output) error {
+	enc := &png.Encoder{CompressionLevel: pngCompression[out.Compression]}
+	return enc.Encode(w, img)
+}
+
+func (e *PNGEncoder) ValidateOptions(out job.Output) error {
+	if _, ok := pngCompression[out.Compression]; !ok {
+		return fmt.Errorf("compression must be one of default, none, fast or best")
+	}
+	return nil
+}
+
+func (e *PNGEncoder) ContentType() string { return "image/png" }
+
+func (e *PNGEncoder) Extension() string { return "png" }
+
+func (e *PNGEncoder) Name() string { return "png" }
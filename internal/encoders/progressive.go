@@ -0,0 +1,525 @@
+package encoders
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// image/jpeg only writes baseline JPEGs, so progressive output is produced
+// here. It implements the subset of ITU T.81 needed for a progressive file:
+// spectral selection without successive approximation, 4:2:0 chroma
+// subsampling and the example Huffman tables from Annex K, which are the
+// same tables and quantisation matrices image/jpeg uses.
+
+// unzig maps a zig-zag index to its natural-order index within a block
+var unzig = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// unscaledQuant holds the luminance and chrominance quantisation matrices in
+// zig-zag order, before quality scaling
+var unscaledQuant = [2][64]byte{
+	// Luminance.
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	// Chrominance.
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+type huffmanSpec struct {
+	counts [16]byte
+	values []byte
+}
+
+// huffmanSpecs holds the luminance DC, luminance AC, chrominance DC and
+// chrominance AC tables, in that order
+var huffmanSpecs = [4]huffmanSpec{
+	// Luminance DC.
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	// Luminance AC.
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	// Chrominance DC.
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	// Chrominance AC.
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+// dctCos[x][u] holds cos((2x+1)uπ/16) for the forward DCT
+var dctCos = func() (c [8][8]float64) {
+	for x := 0; x < 8; x++ {
+		for u := 0; u < 8; u++ {
+			c[x][u] = math.Cos(float64((2*x+1)*u) * math.Pi / 16)
+		}
+	}
+	return c
+}()
+
+// huffmanLUT maps a symbol to its code, packed as size<<24 | code
+type huffmanLUT [256]uint32
+
+func newHuffmanLUT(s huffmanSpec) *huffmanLUT {
+	var lut huffmanLUT
+	code, k := uint32(0), 0
+	for i, n := range s.counts {
+		for j := 0; j < int(n); j++ {
+			lut[s.values[k]] = uint32(i+1)<<24 | code
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return &lut
+}
+
+// plane is one full-resolution 8-bit channel
+type plane struct {
+	pix  []uint8
+	w, h int
+}
+
+// at returns the sample at (x, y), replicating edge samples for
+// coordinates past the right or bottom edge
+func (p *plane) at(x, y int) int {
+	x = min(x, p.w-1)
+	y = min(y, p.h-1)
+	return int(p.pix[y*p.w+x])
+}
+
+// progressiveComponent holds the quantised coefficients of one component
+type progressiveComponent struct {
+	id     byte
+	h, v   int // sampling factors
+	table  int // 0 for the luminance tables, 1 for chrominance
+	bw, bh int // blocks covering the component's samples
+	stride int // blocks per row, padded to whole MCUs
+	blocks [][64]int16
+}
+
+// progressiveScan selects the components and the zig-zag coefficient range
+// [ss, se] one scan carries
+type progressiveScan struct {
+	comps  []int
+	ss, se int
+}
+
+// encodeProgressive writes img as a progressive JPEG. The first scan carries
+// the DC coefficients of every component so a decoder can show a coarse
+// preview early; later scans add the low and then the high frequencies.
+func encodeProgressive(w io.Writer, img image.Image, quality int) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width <= 0 || height <= 0 || width >= 1<<16 || height >= 1<<16 {
+		return fmt.Errorf("jpeg: image dimensions %dx%d out of range", width, height)
+	}
+
+	quant := scaleQuant(quality)
+	planes := toPlanes(img)
+	maxFactor := 1
+	var comps []*progressiveComponent
+	var scans []progressiveScan
+	if len(planes) == 1 {
+		comps = []*progressiveComponent{newProgressiveComponent(1, 1, 1, 0, maxFactor, width, height)}
+		scans = []progressiveScan{
+			{comps: []int{0}, ss: 0, se: 0},
+			{comps: []int{0}, ss: 1, se: 5},
+			{comps: []int{0}, ss: 6, se: 63},
+		}
+	} else {
+		maxFactor = 2
+		comps = []*progressiveComponent{
+			newProgressiveComponent(1, 2, 2, 0, maxFactor, width, height),
+			newProgressiveComponent(2, 1, 1, 1, maxFactor, width, height),
+			newProgressiveComponent(3, 1, 1, 1, maxFactor, width, height),
+		}
+		scans = []progressiveScan{
+			{comps: []int{0, 1, 2}, ss: 0, se: 0},
+			{comps: []int{0}, ss: 1, se: 5},
+			{comps: []int{1}, ss: 1, se: 63},
+			{comps: []int{2}, ss: 1, se: 63},
+			{comps: []int{0}, ss: 6, se: 63},
+		}
+	}
+	for i, c := range comps {
+		c.transform(planes[i], maxFactor/c.h, &quant[c.table])
+	}
+
+	e := &progressiveWriter{w: bufio.NewWriter(w)}
+	for i, s := range huffmanSpecs {
+		e.luts[i] = newHuffmanLUT(s)
+	}
+	e.writeHeaders(comps, quant, width, height)
+	for _, s := range scans {
+		e.writeScan(comps, s)
+	}
+	e.w.Write([]byte{0xff, 0xd9})
+	return e.w.Flush()
+}
+
+// scaleQuant scales the quantisation matrices for quality the same way
+// image/jpeg does
+func scaleQuant(quality int) (q [2][64]byte) {
+	quality = max(1, min(quality, 100))
+	scale := 200 - quality*2
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	for i := range unscaledQuant {
+		for j, u := range unscaledQuant[i] {
+			q[i][j] = byte(max(1, min((int(u)*scale+50)/100, 255)))
+		}
+	}
+	return q
+}
+
+// toPlanes converts img to a single gray plane or to Y, Cb and Cr planes
+func toPlanes(img image.Image) []*plane {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if gray, ok := img.(*image.Gray); ok {
+		p := &plane{pix: make([]uint8, w*h), w: w, h: h}
+		for y := 0; y < h; y++ {
+			off := gray.PixOffset(b.Min.X, b.Min.Y+y)
+			copy(p.pix[y*w:(y+1)*w], gray.Pix[off:off+w])
+		}
+		return []*plane{p}
+	}
+
+	planes := []*plane{
+		{pix: make([]uint8, w*h), w: w, h: h},
+		{pix: make([]uint8, w*h), w: w, h: h},
+		{pix: make([]uint8, w*h), w: w, h: h},
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var yy, cb, cr uint8
+			switch m := img.(type) {
+			case *image.YCbCr:
+				yi := m.YOffset(b.Min.X+x, b.Min.Y+y)
+				ci := m.COffset(b.Min.X+x, b.Min.Y+y)
+				yy, cb, cr = m.Y[yi], m.Cb[ci], m.Cr[ci]
+			case *image.RGBA:
+				i := m.PixOffset(b.Min.X+x, b.Min.Y+y)
+				yy, cb, cr = color.RGBToYCbCr(m.Pix[i], m.Pix[i+1], m.Pix[i+2])
+			default:
+				r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				yy, cb, cr = color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(bl>>8))
+			}
+			i := y*w + x
+			planes[0].pix[i], planes[1].pix[i], planes[2].pix[i] = yy, cb, cr
+		}
+	}
+	return planes
+}
+
+// newProgressiveComponent sizes a component with sampling factors h and v in
+// an image whose largest factor is maxFactor
+func newProgressiveComponent(id byte, h, v, table, maxFactor, width, height int) *progressiveComponent {
+	mcu := 8 * maxFactor
+	mcuCols, mcuRows := (width+mcu-1)/mcu, (height+mcu-1)/mcu
+	compW := (width*h + maxFactor - 1) / maxFactor
+	compH := (height*v + maxFactor - 1) / maxFactor
+	c := &progressiveComponent{
+		id: id, h: h, v: v, table: table,
+		bw: (compW + 7) / 8, bh: (compH + 7) / 8,
+		stride: mcuCols * h,
+	}
+	c.blocks = make([][64]int16, mcuCols*h*mcuRows*v)
+	return c
+}
+
+// transform fills every block of the component from p, averaging sub×sub
+// samples for subsampled components, and stores the quantised DCT
+// coefficients in zig-zag order
+func (c *progressiveComponent) transform(p *plane, sub int, quant *[64]byte) {
+	var in, out [64]float64
+	for i := range c.blocks {
+		bx, by := i%c.stride*8, i/c.stride*8
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				sum := 0
+				for dy := 0; dy < sub; dy++ {
+					for dx := 0; dx < sub; dx++ {
+						sum += p.at((bx+x)*sub+dx, (by+y)*sub+dy)
+					}
+				}
+				n := sub * sub
+				in[y*8+x] = float64((sum+n/2)/n - 128)
+			}
+		}
+		fdct(&in, &out)
+		for k := range c.blocks[i] {
+			c.blocks[i][k] = int16(math.Round(out[unzig[k]] / float64(quant[k])))
+		}
+	}
+}
+
+// fdct computes the 8x8 forward DCT of in
+func fdct(in, out *[64]float64) {
+	var tmp [64]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for x := 0; x < 8; x++ {
+				s += in[y*8+x] * dctCos[x][u]
+			}
+			tmp[y*8+u] = s
+		}
+	}
+	for u := 0; u < 8; u++ {
+		cu := 1.0
+		if u == 0 {
+			cu = math.Sqrt2 / 2
+		}
+		for v := 0; v < 8; v++ {
+			cv := 1.0
+			if v == 0 {
+				cv = math.Sqrt2 / 2
+			}
+			var s float64
+			for y := 0; y < 8; y++ {
+				s += tmp[y*8+u] * dctCos[y][v]
+			}
+			out[v*8+u] = s * cu * cv / 4
+		}
+	}
+}
+
+// progressiveWriter writes markers and Huffman-coded scan data
+type progressiveWriter struct {
+	w    *bufio.Writer
+	bits uint64
+	n    uint
+	luts [4]*huffmanLUT
+}
+
+// marker writes a marker segment header; length excludes the marker itself
+func (e *progressiveWriter) marker(m byte, length int) {
+	e.w.Write([]byte{0xff, m, byte(length >> 8), byte(length)})
+}
+
+func (e *progressiveWriter) writeHeaders(comps []*progressiveComponent, quant [2][64]byte, width, height int) {
+	tables := 1
+	if len(comps) > 1 {
+		tables = 2
+	}
+
+	e.w.Write([]byte{0xff, 0xd8})
+
+	e.marker(0xdb, 2+tables*65)
+	for i := 0; i < tables; i++ {
+		e.w.WriteByte(byte(i))
+		e.w.Write(quant[i][:])
+	}
+
+	e.marker(0xc2, 8+3*len(comps))
+	e.w.Write([]byte{8, byte(height >> 8), byte(height), byte(width >> 8), byte(width), byte(len(comps))})
+	for _, c := range comps {
+		e.w.Write([]byte{c.id, byte(c.h<<4 | c.v), byte(c.table)})
+	}
+
+	length := 2
+	for _, s := range huffmanSpecs[:2*tables] {
+		length += 17 + len(s.values)
+	}
+	e.marker(0xc4, length)
+	for i, s := range huffmanSpecs[:2*tables] {
+		e.w.WriteByte(byte(i%2<<4 | i/2))
+		e.w.Write(s.counts[:])
+		e.w.Write(s.values)
+	}
+}
+
+// writeScan writes one scan. A scan with several components interleaves
+// their blocks MCU by MCU; a single-component scan covers only the blocks
+// that hold the component's samples, as T.81 requires.
+func (e *progressiveWriter) writeScan(comps []*progressiveComponent, s progressiveScan) {
+	e.marker(0xda, 6+2*len(s.comps))
+	e.w.WriteByte(byte(len(s.comps)))
+	for _, i := range s.comps {
+		e.w.Write([]byte{comps[i].id, byte(comps[i].table<<4 | comps[i].table)})
+	}
+	e.w.Write([]byte{byte(s.ss), byte(s.se), 0})
+
+	var pred [3]int16
+	if len(s.comps) == 1 {
+		i := s.comps[0]
+		c := comps[i]
+		for by := 0; by < c.bh; by++ {
+			for bx := 0; bx < c.bw; bx++ {
+				e.writeBlock(c, &c.blocks[by*c.stride+bx], s, &pred[i])
+			}
+		}
+	} else {
+		first := comps[s.comps[0]]
+		mcuCols, mcuRows := first.stride/first.h, len(first.blocks)/first.stride/first.v
+		for my := 0; my < mcuRows; my++ {
+			for mx := 0; mx < mcuCols; mx++ {
+				for _, i := range s.comps {
+					c := comps[i]
+					for dy := 0; dy < c.v; dy++ {
+						for dx := 0; dx < c.h; dx++ {
+							e.writeBlock(c, &c.blocks[(my*c.v+dy)*c.stride+mx*c.h+dx], s, &pred[i])
+						}
+					}
+				}
+			}
+		}
+	}
+	e.flushBits()
+}
+
+// writeBlock writes the coefficients of blk that fall in the scan's range,
+// each block ending its own run of zeros with an EOB
+func (e *progressiveWriter) writeBlock(c *progressiveComponent, blk *[64]int16, s progressiveScan, pred *int16) {
+	k := s.ss
+	if k == 0 {
+		e.writeCoef(2*c.table, 0, blk[0]-*pred)
+		*pred = blk[0]
+		k++
+	}
+	ac := 2*c.table + 1
+	run := 0
+	for ; k <= s.se; k++ {
+		if blk[k] == 0 {
+			run++
+			continue
+		}
+		for ; run > 15; run -= 16 {
+			e.writeSymbol(ac, 0xf0)
+		}
+		e.writeCoef(ac, run, blk[k])
+		run = 0
+	}
+	if run > 0 {
+		e.writeSymbol(ac, 0x00)
+	}
+}
+
+// writeCoef writes v as a (run, size) symbol followed by size extra bits
+func (e *progressiveWriter) writeCoef(table, run int, v int16) {
+	a, bits := int32(v), int32(v)
+	if a < 0 {
+		a, bits = -a, bits-1
+	}
+	size := 0
+	for a > 0 {
+		size++
+		a >>= 1
+	}
+	e.writeSymbol(table, byte(run<<4|size))
+	if size > 0 {
+		e.writeBits(uint32(bits)&(1<<size-1), uint(size))
+	}
+}
+
+func (e *progressiveWriter) writeSymbol(table int, sym byte) {
+	code := e.luts[table][sym]
+	e.writeBits(code&0xffffff, uint(code>>24))
+}
+
+// writeBits appends the low n bits of v, stuffing a zero byte after every
+// 0xff as T.81 requires
+func (e *progressiveWriter) writeBits(v uint32, n uint) {
+	e.bits = e.bits<<n | uint64(v)
+	e.n += n
+	for e.n >= 8 {
+		e.n -= 8
+		b := byte(e.bits >> e.n)
+		e.w.WriteByte(b)
+		if b == 0xff {
+			e.w.WriteByte(0)
+		}
+	}
+}
+
+// flushBits pads the last partial byte of a scan with one bits
+func (e *progressiveWriter) flushBits() {
+	if e.n > 0 {
+		e.writeBits(1<<(8-e.n)-1, 8-e.n)
+	}
+	e.bits = 0
+}
@@ -0,0 +1,90 @@
+package encoders
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+func TestJPEGEncoder_Progressive(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 37, 23))
+	for y := 0; y < 23; y++ {
+		for x := 0; x < 37; x++ {
+			gray.SetGray(x, y, color.Gray{Y: uint8(x*5 + y*3)})
+		}
+	}
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 50, 41), image.YCbCrSubsampleRatio444)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i], ycbcr.Cb[i], ycbcr.Cr[i] = uint8(i), uint8(i*3), uint8(255-i)
+	}
+	offset := image.NewRGBA(image.Rect(5, 7, 45, 40))
+	for y := 7; y < 40; y++ {
+		for x := 5; x < 45; x++ {
+			offset.SetRGBA(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 6), B: 90, A: 255})
+		}
+	}
+
+	tests := []struct {
+		name    string
+		img     image.Image
+		quality int
+	}{
+		{"nrgba", testImage(), 0},
+		{"gray odd size", gray, 90},
+		{"ycbcr", ycbcr, 100},
+		{"rgba offset bounds", offset, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prog, base bytes.Buffer
+			out := job.Output{Quality: tt.quality, Progressive: true}
+			if err := NewJPEGEncoder().Encode(&prog, tt.img, out); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			out.Progressive = false
+			if err := NewJPEGEncoder().Encode(&base, tt.img, out); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(prog.Bytes(), []byte{0xff, 0xc2}) {
+				t.Error("Expected an SOF2 (progressive) marker")
+			}
+
+			got, err := jpeg.Decode(&prog)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			want, err := jpeg.Decode(&base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Bounds().Size() != tt.img.Bounds().Size() {
+				t.Fatalf("Expected size %v, got %v", tt.img.Bounds().Size(), got.Bounds().Size())
+			}
+			if d := meanDiff(got, want); d > 3 {
+				t.Errorf("Expected progressive output to match baseline, mean difference %.2f", d)
+			}
+		})
+	}
+}
+
+// meanDiff returns the mean absolute difference per 8-bit channel
+func meanDiff(a, b image.Image) float64 {
+	var sum, n float64
+	ab, bb := a.Bounds(), b.Bounds()
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			r1, g1, b1, _ := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, _ := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			for _, d := range []int{int(r1>>8) - int(r2>>8), int(g1>>8) - int(g2>>8), int(b1>>8) - int(b2>>8)} {
+				sum += float64(max(d, -d))
+				n++
+			}
+		}
+	}
+	return sum / n
+}
@@ -0,0 +1,96 @@
+package encoders
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+// Registry manages available image encoders, keyed by output format
+type Registry struct {
+	encoders map[string]Encoder
+	mu       sync.RWMutex
+}
+
+// NewRegistry creates a new encoder registry
+func NewRegistry() *Registry {
+	return &Registry{
+		encoders: make(map[string]Encoder),
+	}
+}
+
+// Register adds an encoder for format to the registry
+func (r *Registry) Register(format string, encoder Encoder) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.encoders[format]; exists {
+		return fmt.Errorf("encoder %s already registered", format)
+	}
+
+	r.encoders[format] = encoder
+	return nil
+}
+
+// Get retrieves the encoder for a format
+func (r *Registry) Get(format string) (Encoder, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	encoder, exists := r.encoders[format]
+	if !exists {
+		return nil, fmt.Errorf("encoder %s not found", format)
+	}
+
+	return encoder, nil
+}
+
+// List returns all registered formats in alphabetical order
+func (r *Registry) List() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	formats := make([]string, 0, len(r.encoders))
+	for format := range r.encoders {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	return formats
+}
+
+// ForOutput returns the encoder for out. An empty out.Format keeps
+// inputFormat, as reported by image.Decode, falling back to FallbackFormat
+// if no encoder is registered for it.
+func (r *Registry) ForOutput(out job.Output, inputFormat string) (Encoder, error) {
+	if out.Format != "" {
+		encoder, err := r.Get(out.Format)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported output format %q (supported: %v)", out.Format, r.List())
+		}
+		return encoder, nil
+	}
+
+	if encoder, err := r.Get(inputFormat); err == nil {
+		return encoder, nil
+	}
+	return r.Get(FallbackFormat)
+}
+
+// DefaultRegistry creates a registry with the standard library encoders.
+// Encoders for other formats, such as WebP or AVIF, can be registered on it.
+func DefaultRegistry() *Registry {
+	registry := NewRegistry()
+	if err := registry.Register("jpeg", NewJPEGEncoder()); err != nil {
+		panic(err)
+	}
+	if err := registry.Register("png", NewPNGEncoder()); err != nil {
+		panic(err)
+	}
+	if err := registry.Register("gif", NewGIFEncoder()); err != nil {
+		panic(err)
+	}
+	return registry
+}
@@ -0,0 +1,80 @@
+package encoders
+
+import (
+	"testing"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Run("Register and Get", func(t *testing.T) {
+		registry := NewRegistry()
+		encoder := NewPNGEncoder()
+
+		if err := registry.Register("test", encoder); err != nil {
+			t.Fatalf("Failed to register encoder: %v", err)
+		}
+
+		retrieved, err := registry.Get("test")
+		if err != nil {
+			t.Fatalf("Failed to get encoder: %v", err)
+		}
+		if retrieved != encoder {
+			t.Error("Retrieved encoder does not match registered encoder")
+		}
+	})
+
+	t.Run("Register duplicate", func(t *testing.T) {
+		registry := NewRegistry()
+		if err := registry.Register("test", NewPNGEncoder()); err != nil {
+			t.Fatal(err)
+		}
+		if err := registry.Register("test", NewPNGEncoder()); err == nil {
+			t.Error("Expected error when registering duplicate encoder")
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		got := DefaultRegistry().List()
+		want := []string{"gif", "jpeg", "png"}
+		if len(got) != len(want) {
+			t.Fatalf("List() = %v, want %v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("List() = %v, want %v", got, want)
+			}
+		}
+	})
+}
+
+func TestRegistry_ForOutput(t *testing.T) {
+	registry := DefaultRegistry()
+
+	tests := []struct {
+		name        string
+		output      job.Output
+		inputFormat string
+		want        string
+		wantErr     bool
+	}{
+		{"same as jpeg input", job.Output{}, "jpeg", "jpeg", false},
+		{"same as png input", job.Output{}, "png", "png", false},
+		{"same as gif input", job.Output{}, "gif", "gif", false},
+		{"input without encoder", job.Output{}, "bmp", FallbackFormat, false},
+		{"explicit format", job.Output{Format: "png"}, "jpeg", "png", false},
+		{"unknown format", job.Output{Format: "tiff"}, "jpeg", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := registry.ForOutput(tt.output, tt.inputFormat)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ForOutput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && enc.Name() != tt.want {
+				t.Errorf("ForOutput() = %s, want %s", enc.Name(), tt.want)
+			}
+		})
+	}
+}
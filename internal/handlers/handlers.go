@@ -1,11 +1,27 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/mohammed-ysn/cluster-imager/internal/decoder"
+	"github.com/mohammed-ysn/cluster-imager/internal/encoders"
+	"github.com/mohammed-ysn/cluster-imager/internal/metadata"
 	"github.com/mohammed-ysn/cluster-imager/internal/processors"
 	"github.com/mohammed-ysn/cluster-imager/pkg/job"
 	"github.com/mohammed-ysn/cluster-imager/pkg/logging"
@@ -13,21 +29,45 @@ import (
 	"github.com/mohammed-ysn/cluster-imager/pkg/storage"
 )
 
+const (
+	// maxUploadSize bounds the multipart form held in memory
+	maxUploadSize = 10 << 20
+	// maxJSONBodySize bounds JSON job submissions, which carry no image data
+	maxJSONBodySize = 1 << 20
+	// readyTimeout bounds each readiness check
+	readyTimeout = 2 * time.Second
+	// inputPrefix is where uploaded inputs are stored, and the only prefix
+	// an input_key may reference
+	inputPrefix = "inputs/"
+)
+
+// Check reports whether a dependency is usable, for readiness probes
+type Check func(ctx context.Context) error
+
 type Handlers struct {
 	logger   *logging.Logger
 	registry *processors.Registry
+	encoders *encoders.Registry
 	jobs     job.Store
 	storage  storage.Storage
 	queue    queue.Publisher
+	limits   decoder.Limits
+	checks   map[string]Check
 }
 
-func New(logger *logging.Logger, registry *processors.Registry, jobs job.Store, stor storage.Storage, q queue.Publisher) *Handlers {
+// New creates the API handlers. Uploads whose declared size exceeds limits
+// are rejected, as the worker would reject them. ReadyHandler runs checks,
+// which are keyed by dependency name.
+func New(logger *logging.Logger, registry *processors.Registry, encoderRegistry *encoders.Registry, jobs job.Store, stor storage.Storage, q queue.Publisher, limits decoder.Limits, checks map[string]Check) *Handlers {
 	return &Handlers{
 		logger:   logger,
 		registry: registry,
+		encoders: encoderRegistry,
 		jobs:     jobs,
 		storage:  stor,
 		queue:    q,
+		limits:   limits,
+		checks:   checks,
 	}
 }
 
@@ -36,8 +76,26 @@ func (h *Handlers) LiveHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// ReadyHandler runs every readiness check, responding 503 with the failures
+// if any check fails
 func (h *Handlers) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	failed := make(map[string]string)
+	for name, check := range h.checks {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		err := check(ctx)
+		cancel()
+		if err != nil {
+			h.logger.WithContext(r.Context()).Warn("readiness check failed", "check", name, "error", err)
+			failed[name] = err.Error()
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	if len(failed) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]any{"status": "unavailable", "checks": failed})
+		return
+	}
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
@@ -50,22 +108,22 @@ func (h *Handlers) CropHandler(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	x, err := strconv.Atoi(q.Get("x"))
 	if err != nil {
-		http.Error(w, "invalid value for 'x'", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, "invalid value for 'x'")
 		return
 	}
 	y, err := strconv.Atoi(q.Get("y"))
 	if err != nil {
-		http.Error(w, "invalid value for 'y'", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, "invalid value for 'y'")
 		return
 	}
 	width, err := strconv.Atoi(q.Get("width"))
 	if err != nil {
-		http.Error(w, "invalid value for 'width'", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, "invalid value for 'width'")
 		return
 	}
 	height, err := strconv.Atoi(q.Get("height"))
 	if err != nil {
-		http.Error(w, "invalid value for 'height'", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, "invalid value for 'height'")
 		return
 	}
 
@@ -80,94 +138,714 @@ func (h *Handlers) ResizeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Either dimension may be omitted and derived from the aspect ratio
 	q := r.URL.Query()
-	width, err := strconv.Atoi(q.Get("width"))
-	if err != nil {
-		http.Error(w, "invalid value for 'width'", http.StatusBadRequest)
+	params := map[string]any{}
+	for _, key := range []string{"width", "height"} {
+		if !q.Has(key) {
+			continue
+		}
+		v, err := strconv.Atoi(q.Get(key))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, fmt.Sprintf("invalid value for '%s'", key))
+			return
+		}
+		params[key] = v
+	}
+	for _, key := range []string{"mode", "gravity", "background", "filter"} {
+		if q.Has(key) {
+			params[key] = q.Get(key)
+		}
+	}
+	if q.Has("linear") {
+		linear, err := strconv.ParseBool(q.Get("linear"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, "invalid value for 'linear'")
+			return
+		}
+		params["linear"] = linear
+	}
+
+	h.enqueue(w, r, job.TypeResize, params)
+}
+
+func (h *Handlers) RotateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	height, err := strconv.Atoi(q.Get("height"))
+
+	q := r.URL.Query()
+	angle, err := strconv.ParseFloat(q.Get("angle"), 64)
 	if err != nil {
-		http.Error(w, "invalid value for 'height'", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, "invalid value for 'angle'")
+		return
+	}
+	params := map[string]any{"angle": angle}
+	if q.Has("background") {
+		params["background"] = q.Get("background")
+	}
+	if q.Has("expand") {
+		expand, err := strconv.ParseBool(q.Get("expand"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, "invalid value for 'expand'")
+			return
+		}
+		params["expand"] = expand
+	}
+
+	h.enqueue(w, r, job.TypeRotate, params)
+}
+
+func (h *Handlers) FlipHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	h.enqueue(w, r, job.TypeResize, map[string]any{
-		"width": width, "height": height,
+	h.enqueue(w, r, job.TypeFlip, map[string]any{
+		"direction": r.URL.Query().Get("direction"),
 	})
 }
 
+func (h *Handlers) TransposeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.enqueue(w, r, job.TypeTranspose, map[string]any{})
+}
+
+// jobRequest is the body of a generic job submission. The image is either
+// uploaded alongside it (multipart) or referenced by InputKey.
+type jobRequest struct {
+	Type       string         `json:"type"`
+	Parameters map[string]any `json:"parameters"`
+	Output     job.Output     `json:"output"`
+	InputKey   string         `json:"input_key"`
+}
+
+// SubmitJobHandler queues a job for any registered processor. It accepts
+// either a JSON jobRequest referencing an existing upload, or a multipart form
+// with "type", "parameters" and "output" (JSON objects) and an "image" file. Parameters
+// are validated by the processor, and against the image dimensions, before
+// anything is stored. A multipart form may also carry an "overlay" file for
+// watermark steps that name no overlay key.
+func (h *Handlers) SubmitJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req jobRequest
+	var file, overlay multipart.File
+	var header, overlayHeader *multipart.FileHeader
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "", fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		if req.InputKey == "" {
+			writeError(w, http.StatusBadRequest, "", "input_key is required")
+			return
+		}
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+			writeError(w, http.StatusBadRequest, "", "failed to parse form")
+			return
+		}
+		req.Type = r.FormValue("type")
+		req.InputKey = r.FormValue("input_key")
+		if raw := r.FormValue("parameters"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Parameters); err != nil {
+				writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, fmt.Sprintf("invalid parameters: %v", err))
+				return
+			}
+		}
+		if raw := r.FormValue("output"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Output); err != nil {
+				writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, fmt.Sprintf("invalid output: %v", err))
+				return
+			}
+		}
+
+		var err error
+		file, header, err = r.FormFile("image")
+		switch {
+		case err == nil && req.InputKey != "":
+			file.Close()
+			writeError(w, http.StatusBadRequest, "", "provide either an image or input_key, not both")
+			return
+		case err == nil:
+			defer file.Close()
+		case errors.Is(err, http.ErrMissingFile) && req.InputKey != "":
+			// Process the referenced upload instead
+		default:
+			writeError(w, http.StatusBadRequest, "", "no image file provided")
+			return
+		}
+
+		overlay, overlayHeader, err = r.FormFile("overlay")
+		switch {
+		case err == nil:
+			defer overlay.Close()
+		case errors.Is(err, http.ErrMissingFile):
+		default:
+			writeError(w, http.StatusBadRequest, "", "failed to read overlay file")
+			return
+		}
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, "", "content type must be application/json or multipart/form-data")
+		return
+	}
+
+	if req.Type == "" {
+		writeError(w, http.StatusBadRequest, "", "type is required")
+		return
+	}
+	if req.Parameters == nil {
+		req.Parameters = map[string]any{}
+	}
+	if req.InputKey != "" {
+		if err := storage.ValidateKey(req.InputKey); err != nil {
+			writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, fmt.Sprintf("invalid input_key: %v", err))
+			return
+		}
+		if !strings.HasPrefix(req.InputKey, inputPrefix) {
+			writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, fmt.Sprintf("input_key must name an uploaded input under %q", inputPrefix))
+			return
+		}
+	}
+
+	jobID := uuid.New().String()
+	var overlayKey string
+	if overlay != nil {
+		overlayKey = processors.OverlayPrefix + jobID
+		if !attachOverlay(req.Type, req.Parameters, overlayKey) {
+			writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, "overlay uploaded but no watermark step uses it")
+			return
+		}
+	}
+
+	proc, ok := h.validateParams(w, req.Type, req.Parameters)
+	if !ok {
+		return
+	}
+	var overlayType string
+	if overlay != nil {
+		if overlayType, ok = h.validateOverlay(w, overlay, overlayHeader.Header.Get("Content-Type")); !ok || !rewind(w, overlay) {
+			return
+		}
+	}
+	if !h.checkReferences(w, r, proc, req.Parameters, overlayKey) {
+		return
+	}
+
+	var input job.Input
+	var stored []string // objects this submission uploaded, removed if it fails
+	if file != nil {
+		if input, ok = h.validateImage(w, proc, req.Parameters, req.Output, file, header.Header.Get("Content-Type")); !ok || !rewind(w, file) {
+			return
+		}
+		if input, ok = h.storeInput(w, r, jobID, file, header, input); !ok {
+			return
+		}
+		stored = append(stored, input.StorageKey)
+	} else if input, ok = h.readInput(w, r, proc, req); !ok {
+		return
+	}
+
+	if overlay != nil {
+		if err := h.storage.Upload(r.Context(), overlayKey, overlay, overlayType); err != nil {
+			h.logger.WithContext(r.Context()).Error("failed to upload overlay", "error", err)
+			for _, key := range stored {
+				h.discard(r, key)
+			}
+			http.Error(w, "failed to store overlay", http.StatusInternalServerError)
+			return
+		}
+		stored = append(stored, overlayKey)
+	}
+
+	h.submit(w, r, &job.Job{
+		ID:         jobID,
+		Type:       job.Type(req.Type),
+		Status:     job.StatusQueued,
+		Parameters: req.Parameters,
+		Input:      input,
+		Output:     req.Output,
+		Metadata: job.Metadata{
+			RequestID: logging.GetRequestID(r.Context()),
+		},
+	}, stored...)
+}
+
+// readInput validates the stored object an input_key names, as validateImage
+// does an upload, and records its key and size
+func (h *Handlers) readInput(w http.ResponseWriter, r *http.Request, proc processors.Processor, req jobRequest) (job.Input, bool) {
+	meta, err := h.storage.Stat(r.Context(), req.InputKey)
+	if err == nil {
+		var rc io.ReadCloser
+		if rc, err = h.storage.Download(r.Context(), req.InputKey); err == nil {
+			defer rc.Close()
+			input, ok := h.validateImage(w, proc, req.Parameters, req.Output, rc, "")
+			input.StorageKey = req.InputKey
+			input.Size = meta.Size
+			return input, ok
+		}
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		writeError(w, http.StatusBadRequest, job.CodeInputNotFound, fmt.Sprintf("input %q not found", req.InputKey))
+		return job.Input{}, false
+	}
+	h.logger.WithContext(r.Context()).Error("failed to read input", "key", req.InputKey, "error", err)
+	http.Error(w, "failed to read input", http.StatusInternalServerError)
+	return job.Input{}, false
+}
+
 func (h *Handlers) JobStatusHandler(w http.ResponseWriter, r *http.Request) {
+	j, ok := h.lookupJob(w, r)
+	if !ok {
+		return
+	}
+
+	if j.Result != nil && j.Result.URL == "" {
+		j.Result.URL = "/api/v1/jobs/" + j.ID + "/result"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(j)
+}
+
+// JobResultHandler streams the processed image of a completed job.
+func (h *Handlers) JobResultHandler(w http.ResponseWriter, r *http.Request) {
+	j, ok := h.lookupJob(w, r)
+	if !ok {
+		return
+	}
+
+	if j.Status != job.StatusCompleted || j.Result == nil {
+		http.Error(w, fmt.Sprintf("job is %s, result not available", j.Status), http.StatusConflict)
+		return
+	}
+
+	h.serveObject(w, r, j.Result.StorageKey, j.Result.MimeType, j.Metadata.CompletedAt)
+}
+
+// JobInputHandler streams the original upload of a job.
+func (h *Handlers) JobInputHandler(w http.ResponseWriter, r *http.Request) {
+	j, ok := h.lookupJob(w, r)
+	if !ok {
+		return
+	}
+
+	h.serveObject(w, r, j.Input.StorageKey, j.Input.MimeType, j.Metadata.CreatedAt)
+}
+
+func (h *Handlers) lookupJob(w http.ResponseWriter, r *http.Request) (*job.Job, bool) {
 	id := r.PathValue("id")
 	if id == "" {
 		http.Error(w, "missing job id", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 
 	j, err := h.jobs.Get(r.Context(), id)
 	if err != nil {
-		http.Error(w, "job not found", http.StatusNotFound)
+		if errors.Is(err, job.ErrNotFound) {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return nil, false
+		}
+		h.logger.WithContext(r.Context()).Error("failed to get job", "job_id", id, "error", err)
+		http.Error(w, "failed to get job", http.StatusInternalServerError)
+		return nil, false
+	}
+	return j, true
+}
+
+// serveObject streams a stored object, delegating Range and conditional
+// request handling to http.ServeContent.
+func (h *Handlers) serveObject(w http.ResponseWriter, r *http.Request, key, contentType string, modTime time.Time) {
+	logger := h.logger.WithContext(r.Context())
+
+	meta, err := h.storage.Stat(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "object not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("failed to stat object", "key", key, "error", err)
+		http.Error(w, "failed to read object", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(j)
+	rc, err := h.storage.Download(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "object not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("failed to download object", "key", key, "error", err)
+		http.Error(w, "failed to read object", http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	// Range support needs a seekable body; buffer backends that only stream.
+	content, ok := rc.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			logger.Error("failed to read object", "key", key, "error", err)
+			http.Error(w, "failed to read object", http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	if contentType == "" {
+		contentType = meta.ContentType
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	etag := objectETag(key)
+	if meta.ETag != "" {
+		etag = `"` + meta.ETag + `"`
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, path.Base(key), modTime, content)
+}
+
+// objectETag derives an ETag from the storage key, for backends that do not
+// report one. Objects are written once per key, so the key identifies the
+// content.
+func objectETag(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
 }
 
 func (h *Handlers) enqueue(w http.ResponseWriter, r *http.Request, jobType job.Type, params map[string]any) {
-	logger := h.logger.WithContext(r.Context())
+	proc, ok := h.validateParams(w, string(jobType), params)
+	if !ok {
+		return
+	}
+
+	output, err := outputFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, fmt.Sprintf("invalid output: %v", err))
+		return
+	}
 
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "failed to parse form", http.StatusBadRequest)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		writeError(w, http.StatusBadRequest, "", "failed to parse form")
 		return
 	}
 
 	file, header, err := r.FormFile("image")
 	if err != nil {
-		http.Error(w, "no image file provided", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "", "no image file provided")
 		return
 	}
 	defer file.Close()
 
-	jobID := uuid.New().String()
-	storageKey := "inputs/" + jobID
+	input, ok := h.validateImage(w, proc, params, output, file, header.Header.Get("Content-Type"))
+	if !ok || !rewind(w, file) {
+		return
+	}
 
-	if err := h.storage.Upload(r.Context(), storageKey, file, header.Header.Get("Content-Type")); err != nil {
-		logger.Error("failed to upload image", "error", err)
-		http.Error(w, "failed to store image", http.StatusInternalServerError)
+	jobID := uuid.New().String()
+	if input, ok = h.storeInput(w, r, jobID, file, header, input); !ok {
 		return
 	}
 
-	j := &job.Job{
+	h.submit(w, r, &job.Job{
 		ID:         jobID,
 		Type:       jobType,
 		Status:     job.StatusQueued,
 		Parameters: params,
-		Input: job.Input{
-			StorageKey: storageKey,
-			MimeType:   header.Header.Get("Content-Type"),
-			Size:       header.Size,
-		},
+		Input:      input,
+		Output:     output,
 		Metadata: job.Metadata{
 			RequestID: logging.GetRequestID(r.Context()),
 		},
+	}, input.StorageKey)
+}
+
+// validateParams looks up the processor for jobType and validates params with
+// it. It writes the error response and returns false if the job is rejected.
+func (h *Handlers) validateParams(w http.ResponseWriter, jobType string, params map[string]any) (processors.Processor, bool) {
+	proc, err := h.registry.Get(jobType)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, job.CodeUnknownProcessor, fmt.Sprintf("unknown job type %q", jobType))
+		return nil, false
+	}
+	if err := proc.ValidateParams(params); err != nil {
+		writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, fmt.Sprintf("invalid parameters: %v", err))
+		return nil, false
 	}
+	return proc, true
+}
+
+// checkReferences rejects params that name a stored object which does not
+// exist. uploaded is stored along with the job, so it is not checked.
+func (h *Handlers) checkReferences(w http.ResponseWriter, r *http.Request, proc processors.Processor, params map[string]any, uploaded string) bool {
+	ref, ok := proc.(processors.Referencer)
+	if !ok {
+		return true
+	}
+	for _, key := range ref.References(params) {
+		if key == uploaded {
+			continue
+		}
+		exists, err := h.storage.Exists(r.Context(), key)
+		if err != nil {
+			h.logger.WithContext(r.Context()).Error("failed to check object", "key", key, "error", err)
+			http.Error(w, "failed to check referenced object", http.StatusInternalServerError)
+			return false
+		}
+		if !exists {
+			writeError(w, http.StatusBadRequest, job.CodeInputNotFound, fmt.Sprintf("object %q not found", key))
+			return false
+		}
+	}
+	return true
+}
+
+// attachOverlay sets overlayKey as the overlay of a watermark job, or of each
+// watermark step of a pipeline, that does not name one. It reports whether
+// any step uses the overlay.
+func attachOverlay(jobType string, params map[string]any, overlayKey string) bool {
+	switch jobType {
+	case string(job.TypeWatermark):
+		if _, ok := params["overlay"]; ok {
+			return false
+		}
+		params["overlay"] = overlayKey
+		return true
+	case string(job.TypePipeline):
+		steps, err := processors.PipelineSteps(params)
+		if err != nil {
+			return false
+		}
+		used := false
+		for _, step := range steps {
+			if _, ok := step.Params["overlay"]; step.Processor == "watermark" && !ok {
+				step.Params["overlay"] = overlayKey
+				used = true
+			}
+		}
+		params["steps"] = steps
+		return used
+	}
+	return false
+}
+
+// validateOverlay checks that an uploaded overlay is an image in an allowed
+// format, consistent with its declared content type and within the size
+// limits. It returns the sniffed content type, or writes the error response
+// and returns false.
+func (h *Handlers) validateOverlay(w http.ResponseWriter, overlay io.Reader, contentType string) (string, bool) {
+	data, err := io.ReadAll(io.LimitReader(overlay, maxUploadSize))
+	if err != nil {
+		http.Error(w, "failed to read overlay", http.StatusInternalServerError)
+		return "", false
+	}
+	_, format, err := decoder.DecodeConfig(data, h.limits)
+	if err == nil {
+		err = checkContentType(format, contentType)
+	}
+	if err != nil {
+		writeImageError(w, "invalid overlay", err)
+		return "", false
+	}
+	return decoder.ContentType(format), true
+}
+
+// checkContentType rejects a declared content type that contradicts the
+// sniffed format
+func checkContentType(format, contentType string) error {
+	if !decoder.MatchesContentType(format, contentType) {
+		return fmt.Errorf("content type %q does not match %s data: %w", contentType, format, decoder.ErrUnsupportedFormat)
+	}
+	return nil
+}
+
+// validateImage sniffs the image format and checks it against the allow-list
+// and the declared contentType, if any. It then reads the image header,
+// checks the output against the encoder it selects and, for processors that
+// depend on it, checks params against the image dimensions. It returns the
+// detected format and dimensions as a job input, or writes the error response
+// and returns false if the job is rejected.
+func (h *Handlers) validateImage(w http.ResponseWriter, proc processors.Processor, params map[string]any, output job.Output, img io.Reader, contentType string) (job.Input, bool) {
+	data, err := io.ReadAll(io.LimitReader(img, maxUploadSize))
+	if err != nil {
+		http.Error(w, "failed to read image", http.StatusInternalServerError)
+		return job.Input{}, false
+	}
+	cfg, format, err := decoder.DecodeConfig(data, h.limits)
+	if err == nil {
+		err = checkContentType(format, contentType)
+	}
+	if err != nil {
+		writeImageError(w, "invalid image", err)
+		return job.Input{}, false
+	}
+
+	// The worker orients the image before processing, so params apply to
+	// the oriented size. Unreadable metadata is ignored there too.
+	meta, _ := metadata.Extract(data)
+	width, height := processors.OrientedSize(cfg.Width, cfg.Height, meta.Orientation())
+
+	enc, err := h.encoders.ForOutput(output, format)
+	if err == nil {
+		err = enc.ValidateOptions(output)
+	}
+	if err == nil {
+		err = metadata.ValidateOptions(output)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, job.CodeInvalidParameters, fmt.Sprintf("invalid output: %v", err))
+		return job.Input{}, false
+	}
+
+	if v, ok := proc.(processors.DimensionValidator); ok {
+		if err := v.ValidateDimensions(params, width, height); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, job.CodeInvalidParameters,
+				fmt.Sprintf("invalid parameters for %dx%d image: %v", width, height, err))
+			return job.Input{}, false
+		}
+	}
+	return job.Input{
+		MimeType: decoder.ContentType(format),
+		Format:   format,
+		Width:    width,
+		Height:   height,
+	}, true
+}
+
+// outputFromQuery reads the optional format, quality, progressive,
+// compression, metadata and strip_gps query parameters.
+func outputFromQuery(q url.Values) (job.Output, error) {
+	output := job.Output{
+		Format:      q.Get("format"),
+		Compression: q.Get("compression"),
+		Metadata:    q.Get("metadata"),
+	}
+	if v := q.Get("quality"); v != "" {
+		quality, err := strconv.Atoi(v)
+		if err != nil {
+			return output, fmt.Errorf("invalid value for 'quality'")
+		}
+		output.Quality = quality
+	}
+	if v := q.Get("progressive"); v != "" {
+		progressive, err := strconv.ParseBool(v)
+		if err != nil {
+			return output, fmt.Errorf("invalid value for 'progressive'")
+		}
+		output.Progressive = progressive
+	}
+	if v := q.Get("strip_gps"); v != "" {
+		stripGPS, err := strconv.ParseBool(v)
+		if err != nil {
+			return output, fmt.Errorf("invalid value for 'strip_gps'")
+		}
+		output.StripGPS = stripGPS
+	}
+	return output, nil
+}
+
+// rewind seeks an upload back to the start after its header has been read.
+func rewind(w http.ResponseWriter, file io.Seeker) bool {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "failed to read image", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// storeInput uploads the image for a new job, completing the input that
+// validateImage detected.
+func (h *Handlers) storeInput(w http.ResponseWriter, r *http.Request, jobID string, file multipart.File, header *multipart.FileHeader, input job.Input) (job.Input, bool) {
+	storageKey := inputPrefix + jobID
+
+	if err := h.storage.Upload(r.Context(), storageKey, file, input.MimeType); err != nil {
+		h.logger.WithContext(r.Context()).Error("failed to upload image", "error", err)
+		http.Error(w, "failed to store image", http.StatusInternalServerError)
+		return job.Input{}, false
+	}
+
+	input.StorageKey = storageKey
+	input.Size = header.Size
+	return input, true
+}
+
+// discard deletes an object stored for a submission that then failed. It is
+// best effort: a failure is only logged.
+func (h *Handlers) discard(r *http.Request, key string) {
+	if err := h.storage.Delete(r.Context(), key); err != nil {
+		h.logger.WithContext(r.Context()).Error("failed to delete orphaned object", "key", key, "error", err)
+	}
+}
+
+// submit records a new job and publishes it for the workers. If either
+// fails, the objects stored for the submission are discarded.
+func (h *Handlers) submit(w http.ResponseWriter, r *http.Request, j *job.Job, stored ...string) {
+	logger := h.logger.WithContext(r.Context())
 
 	if err := h.jobs.Create(r.Context(), j); err != nil {
 		logger.Error("failed to create job", "error", err)
+		for _, key := range stored {
+			h.discard(r, key)
+		}
 		http.Error(w, "failed to create job", http.StatusInternalServerError)
 		return
 	}
 
 	if err := h.queue.Publish(r.Context(), j); err != nil {
 		logger.Error("failed to publish job", "error", err)
+		for _, key := range stored {
+			h.discard(r, key)
+		}
 		http.Error(w, "failed to queue job", http.StatusInternalServerError)
 		return
 	}
 
-	logger.Info("job queued", "job_id", jobID, "type", jobType)
+	logger.Info("job queued", "job_id", j.ID, "type", j.Type)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
-	json.NewEncoder(w).Encode(map[string]string{"job_id": jobID})
+	json.NewEncoder(w).Encode(map[string]string{"job_id": j.ID})
+}
+
+// writeImageError rejects an image that is not in an allowed format (415),
+// or that cannot be decoded or whose declared size exceeds the limits (422)
+func writeImageError(w http.ResponseWriter, prefix string, err error) {
+	code := decoder.Code(err)
+	status := http.StatusUnprocessableEntity
+	if code == job.CodeUnsupportedFormat {
+		status = http.StatusUnsupportedMediaType
+	}
+	writeError(w, status, code, fmt.Sprintf("%s: %v", prefix, err))
+}
+
+// errorResponse is the body of a rejected job submission
+type errorResponse struct {
+	Error     string        `json:"error"`
+	ErrorCode job.ErrorCode `json:"error_code,omitempty"`
+}
+
+// writeError writes a JSON error response. code is empty for malformed
+// requests that no job error code describes.
+func writeError(w http.ResponseWriter, status int, code job.ErrorCode, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: msg, ErrorCode: code})
 }
@@ -5,16 +5,29 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/mohammed-ysn/cluster-imager/internal/decoder"
+	"github.com/mohammed-ysn/cluster-imager/internal/encoders"
+	"github.com/mohammed-ysn/cluster-imager/internal/metadata"
+	"github.com/mohammed-ysn/cluster-imager/internal/metadata/metadatatest"
 	"github.com/mohammed-ysn/cluster-imager/internal/processors"
 	"github.com/mohammed-ysn/cluster-imager/pkg/job"
 	"github.com/mohammed-ysn/cluster-imager/pkg/logging"
+	"github.com/mohammed-ysn/cluster-imager/pkg/storage"
+	"golang.org/x/image/bmp"
 	"log/slog"
 )
 
@@ -43,7 +56,7 @@ func (m *mockJobStore) Get(_ context.Context, id string) (*job.Job, error) {
 	}
 	j, ok := m.jobs[id]
 	if !ok {
-		return nil, errors.New("job not found")
+		return nil, job.ErrNotFound
 	}
 	return j, nil
 }
@@ -58,20 +71,58 @@ func (m *mockJobStore) List(_ context.Context, _ job.Filter) ([]*job.Job, error)
 func (m *mockJobStore) Delete(_ context.Context, _ string) error { return m.err }
 
 type mockStorage struct {
-	err error
+	data         map[string][]byte
+	contentTypes map[string]string
+	uploaded     []string
+	deleted      []string
+	failUpload   string // Upload fails for keys with this prefix
+	err          error
 }
 
-func (m *mockStorage) Upload(_ context.Context, _ string, _ io.Reader, _ string) error {
-	return m.err
+func (m *mockStorage) Upload(_ context.Context, key string, _ io.Reader, _ string) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.failUpload != "" && strings.HasPrefix(key, m.failUpload) {
+		return errors.New("storage unavailable")
+	}
+	m.uploaded = append(m.uploaded, key)
+	return nil
 }
-func (m *mockStorage) Download(_ context.Context, _ string) (io.ReadCloser, error) {
-	return nil, m.err
+func (m *mockStorage) Download(_ context.Context, key string) (io.ReadCloser, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	b, ok := m.data[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+func (m *mockStorage) Delete(_ context.Context, key string) error {
+	m.deleted = append(m.deleted, key)
+	return m.err
 }
-func (m *mockStorage) Delete(_ context.Context, _ string) error { return m.err }
 func (m *mockStorage) GetURL(_ context.Context, _ string, _ time.Duration) (string, error) {
 	return "", m.err
 }
-func (m *mockStorage) Exists(_ context.Context, _ string) (bool, error) { return false, m.err }
+func (m *mockStorage) Exists(_ context.Context, key string) (bool, error) {
+	_, ok := m.data[key]
+	return ok, m.err
+}
+func (m *mockStorage) Stat(_ context.Context, key string) (storage.Metadata, error) {
+	if m.err != nil {
+		return storage.Metadata{}, m.err
+	}
+	b, ok := m.data[key]
+	if !ok {
+		return storage.Metadata{}, storage.ErrNotFound
+	}
+	return storage.Metadata{Key: key, ContentType: m.contentTypes[key], Size: int64(len(b))}, nil
+}
+func (m *mockStorage) List(_ context.Context, _, _ string) (storage.ListResult, error) {
+	return storage.ListResult{}, m.err
+}
 
 type mockQueue struct {
 	published []*job.Job
@@ -91,47 +142,72 @@ func (m *mockQueue) Close() error { return nil }
 func newHandlers(jobs *mockJobStore, stor *mockStorage, q *mockQueue) *Handlers {
 	logger := logging.NewLogger(slog.LevelError)
 	registry := processors.DefaultRegistry()
-	return New(logger, registry, jobs, stor, q)
+	if err := processors.RegisterStorageProcessors(registry, stor); err != nil {
+		panic(err)
+	}
+	return New(logger, registry, encoders.DefaultRegistry(), jobs, stor, q, decoder.Limits{}, nil)
+}
+
+// corruptPNG has a PNG signature but no valid chunks
+var corruptPNG = []byte("\x89PNG\r\n\x1a\nnot an image")
+
+// testJPEG is a 1x1 JPEG
+var testJPEG = []byte{
+	0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10, 0x4a, 0x46, 0x49, 0x46, 0x00, 0x01,
+	0x01, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0xff, 0xdb, 0x00, 0x43,
+	0x00, 0x08, 0x06, 0x06, 0x07, 0x06, 0x05, 0x08, 0x07, 0x07, 0x07, 0x09,
+	0x09, 0x08, 0x0a, 0x0c, 0x14, 0x0d, 0x0c, 0x0b, 0x0b, 0x0c, 0x19, 0x12,
+	0x13, 0x0f, 0x14, 0x1d, 0x1a, 0x1f, 0x1e, 0x1d, 0x1a, 0x1c, 0x1c, 0x20,
+	0x24, 0x2e, 0x27, 0x20, 0x22, 0x2c, 0x23, 0x1c, 0x1c, 0x28, 0x37, 0x29,
+	0x2c, 0x30, 0x31, 0x34, 0x34, 0x34, 0x1f, 0x27, 0x39, 0x3d, 0x38, 0x32,
+	0x3c, 0x2e, 0x33, 0x34, 0x32, 0xff, 0xc0, 0x00, 0x0b, 0x08, 0x00, 0x01,
+	0x00, 0x01, 0x01, 0x01, 0x11, 0x00, 0xff, 0xc4, 0x00, 0x1f, 0x00, 0x00,
+	0x01, 0x05, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+	0x09, 0x0a, 0x0b, 0xff, 0xc4, 0x00, 0xb5, 0x10, 0x00, 0x02, 0x01, 0x03,
+	0x03, 0x02, 0x04, 0x03, 0x05, 0x05, 0x04, 0x04, 0x00, 0x00, 0x01, 0x7d,
+	0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12, 0x21, 0x31, 0x41, 0x06,
+	0x13, 0x51, 0x61, 0x07, 0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+	0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0, 0x24, 0x33, 0x62, 0x72,
+	0x82, 0x09, 0x0a, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+	0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x43, 0x44, 0x45,
+	0x46, 0x47, 0x48, 0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+	0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0x6a, 0x73, 0x74, 0x75,
+	0x76, 0x77, 0x78, 0x79, 0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+	0x8a, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4,
+	0xa5, 0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6, 0xb7,
+	0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca,
+	0xd2, 0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2, 0xe3,
+	0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea, 0xf1, 0xf2, 0xf3, 0xf4, 0xf5,
+	0xf6, 0xf7, 0xf8, 0xf9, 0xfa, 0xff, 0xda, 0x00, 0x08, 0x01, 0x01, 0x00,
+	0x00, 0x3f, 0x00, 0xfb, 0xd6, 0xff, 0xd9,
 }
 
 func multipartImageRequest(t *testing.T, url string) *http.Request {
+	t.Helper()
+	return multipartFormRequest(t, url, nil, true)
+}
+
+func multipartFormRequest(t *testing.T, url string, fields map[string]string, withImage bool) *http.Request {
 	t.Helper()
 	var body bytes.Buffer
 	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !withImage {
+		w.Close()
+		req := httptest.NewRequest(http.MethodPost, url, &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		return req
+	}
 	fw, err := w.CreateFormFile("image", "test.jpg")
 	if err != nil {
 		t.Fatal(err)
 	}
-	fw.Write([]byte{
-		0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10, 0x4a, 0x46, 0x49, 0x46, 0x00, 0x01,
-		0x01, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0xff, 0xdb, 0x00, 0x43,
-		0x00, 0x08, 0x06, 0x06, 0x07, 0x06, 0x05, 0x08, 0x07, 0x07, 0x07, 0x09,
-		0x09, 0x08, 0x0a, 0x0c, 0x14, 0x0d, 0x0c, 0x0b, 0x0b, 0x0c, 0x19, 0x12,
-		0x13, 0x0f, 0x14, 0x1d, 0x1a, 0x1f, 0x1e, 0x1d, 0x1a, 0x1c, 0x1c, 0x20,
-		0x24, 0x2e, 0x27, 0x20, 0x22, 0x2c, 0x23, 0x1c, 0x1c, 0x28, 0x37, 0x29,
-		0x2c, 0x30, 0x31, 0x34, 0x34, 0x34, 0x1f, 0x27, 0x39, 0x3d, 0x38, 0x32,
-		0x3c, 0x2e, 0x33, 0x34, 0x32, 0xff, 0xc0, 0x00, 0x0b, 0x08, 0x00, 0x01,
-		0x00, 0x01, 0x01, 0x01, 0x11, 0x00, 0xff, 0xc4, 0x00, 0x1f, 0x00, 0x00,
-		0x01, 0x05, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
-		0x09, 0x0a, 0x0b, 0xff, 0xc4, 0x00, 0xb5, 0x10, 0x00, 0x02, 0x01, 0x03,
-		0x03, 0x02, 0x04, 0x03, 0x05, 0x05, 0x04, 0x04, 0x00, 0x00, 0x01, 0x7d,
-		0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12, 0x21, 0x31, 0x41, 0x06,
-		0x13, 0x51, 0x61, 0x07, 0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
-		0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0, 0x24, 0x33, 0x62, 0x72,
-		0x82, 0x09, 0x0a, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
-		0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x43, 0x44, 0x45,
-		0x46, 0x47, 0x48, 0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
-		0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0x6a, 0x73, 0x74, 0x75,
-		0x76, 0x77, 0x78, 0x79, 0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
-		0x8a, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4,
-		0xa5, 0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6, 0xb7,
-		0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca,
-		0xd2, 0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2, 0xe3,
-		0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea, 0xf1, 0xf2, 0xf3, 0xf4, 0xf5,
-		0xf6, 0xf7, 0xf8, 0xf9, 0xfa, 0xff, 0xda, 0x00, 0x08, 0x01, 0x01, 0x00,
-		0x00, 0x3f, 0x00, 0xfb, 0xd6, 0xff, 0xd9,
-	})
+	fw.Write(testJPEG)
 	w.Close()
 
 	req := httptest.NewRequest(http.MethodPost, url, &body)
@@ -149,11 +225,45 @@ func TestLiveHandler(t *testing.T) {
 }
 
 func TestReadyHandler(t *testing.T) {
-	h := newHandlers(newMockJobStore(), &mockStorage{}, &mockQueue{})
-	rr := httptest.NewRecorder()
-	h.ReadyHandler(rr, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
-	if rr.Code != http.StatusOK {
-		t.Errorf("expected 200, got %d", rr.Code)
+	ok := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name       string
+		checks     map[string]Check
+		wantStatus int
+		wantFailed []string
+	}{
+		{"no checks", nil, http.StatusOK, nil},
+		{"all pass", map[string]Check{"job_store": ok, "queue": ok}, http.StatusOK, nil},
+		{"one fails", map[string]Check{"job_store": ok, "queue": down}, http.StatusServiceUnavailable, []string{"queue"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHandlers(newMockJobStore(), &mockStorage{}, &mockQueue{})
+			h.checks = tt.checks
+			rr := httptest.NewRecorder()
+			h.ReadyHandler(rr, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, rr.Code)
+			}
+
+			var resp struct {
+				Checks map[string]string `json:"checks"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(resp.Checks) != len(tt.wantFailed) {
+				t.Errorf("expected failed checks %v, got %v", tt.wantFailed, resp.Checks)
+			}
+			for _, name := range tt.wantFailed {
+				if resp.Checks[name] == "" {
+					t.Errorf("expected check %s to be reported", name)
+				}
+			}
+		})
 	}
 }
 
@@ -231,7 +341,7 @@ func TestResizeHandler_WrongMethod(t *testing.T) {
 
 func TestResizeHandler_MissingParams(t *testing.T) {
 	h := newHandlers(newMockJobStore(), &mockStorage{}, &mockQueue{})
-	req := multipartImageRequest(t, "/api/v1/resize?width=10")
+	req := multipartImageRequest(t, "/api/v1/resize?mode=fit")
 	rr := httptest.NewRecorder()
 	h.ResizeHandler(rr, req)
 	if rr.Code != http.StatusBadRequest {
@@ -239,6 +349,70 @@ func TestResizeHandler_MissingParams(t *testing.T) {
 	}
 }
 
+func TestResizeHandler_ModeParams(t *testing.T) {
+	jobs := newMockJobStore()
+	h := newHandlers(jobs, &mockStorage{}, &mockQueue{})
+
+	req := multipartImageRequest(t, "/api/v1/resize?width=10&mode=fit&background=%23000000&filter=nearest&linear=true")
+	rr := httptest.NewRecorder()
+	h.ResizeHandler(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(jobs.created) != 1 {
+		t.Fatalf("expected 1 job created, got %d", len(jobs.created))
+	}
+	params := jobs.created[0].Parameters
+	if _, ok := params["height"]; ok {
+		t.Errorf("height should be omitted, got %v", params["height"])
+	}
+	if params["mode"] != "fit" || params["background"] != "#000000" || params["filter"] != "nearest" || params["linear"] != true {
+		t.Errorf("unexpected params: %v", params)
+	}
+}
+
+func TestOrientationHandlers(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		handler    func(*Handlers) http.HandlerFunc
+		wantType   job.Type
+		wantParams map[string]any
+	}{
+		{"rotate", "/api/v1/rotate?angle=-22.5&background=%23000&expand=true", func(h *Handlers) http.HandlerFunc { return h.RotateHandler }, job.TypeRotate, map[string]any{"angle": -22.5, "background": "#000", "expand": true}},
+		{"flip", "/api/v1/flip?direction=vertical", func(h *Handlers) http.HandlerFunc { return h.FlipHandler }, job.TypeFlip, map[string]any{"direction": "vertical"}},
+		{"transpose", "/api/v1/transpose", func(h *Handlers) http.HandlerFunc { return h.TransposeHandler }, job.TypeTranspose, map[string]any{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := newMockJobStore()
+			h := newHandlers(jobs, &mockStorage{}, &mockQueue{})
+
+			rr := httptest.NewRecorder()
+			tt.handler(h)(rr, multipartImageRequest(t, tt.url))
+
+			if rr.Code != http.StatusAccepted {
+				t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if len(jobs.created) != 1 {
+				t.Fatalf("expected 1 job created, got %d", len(jobs.created))
+			}
+			created := jobs.created[0]
+			if created.Type != tt.wantType || !reflect.DeepEqual(created.Parameters, tt.wantParams) {
+				t.Errorf("job = %s %v, want %s %v", created.Type, created.Parameters, tt.wantType, tt.wantParams)
+			}
+
+			rr = httptest.NewRecorder()
+			tt.handler(h)(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rr.Code != http.StatusMethodNotAllowed {
+				t.Errorf("expected 405, got %d", rr.Code)
+			}
+		})
+	}
+}
+
 func TestJobStatusHandler_Found(t *testing.T) {
 	jobs := newMockJobStore()
 	jobs.jobs["abc123"] = &job.Job{ID: "abc123", Status: job.StatusQueued}
@@ -272,6 +446,19 @@ func TestJobStatusHandler_NotFound(t *testing.T) {
 	}
 }
 
+func TestJobStatusHandler_StoreError(t *testing.T) {
+	jobs := newMockJobStore()
+	jobs.err = errors.New("connection refused")
+	h := newHandlers(jobs, &mockStorage{}, &mockQueue{})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/jobs/abc123", nil)
+	req.SetPathValue("id", "abc123")
+	rr := httptest.NewRecorder()
+	h.JobStatusHandler(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", rr.Code)
+	}
+}
+
 func TestJobStatusHandler_MissingID(t *testing.T) {
 	h := newHandlers(newMockJobStore(), &mockStorage{}, &mockQueue{})
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/jobs/", nil)
@@ -281,3 +468,882 @@ func TestJobStatusHandler_MissingID(t *testing.T) {
 		t.Errorf("expected 400, got %d", rr.Code)
 	}
 }
+
+func TestJobStatusHandler_ResultURL(t *testing.T) {
+	jobs := newMockJobStore()
+	jobs.jobs["abc123"] = &job.Job{
+		ID:     "abc123",
+		Status: job.StatusCompleted,
+		Result: &job.Result{StorageKey: "results/abc123.jpg"},
+	}
+	h := newHandlers(jobs, &mockStorage{}, &mockQueue{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/jobs/abc123", nil)
+	req.SetPathValue("id", "abc123")
+	rr := httptest.NewRecorder()
+	h.JobStatusHandler(rr, req)
+
+	var j job.Job
+	if err := json.NewDecoder(rr.Body).Decode(&j); err != nil {
+		t.Fatal(err)
+	}
+	if j.Result == nil || j.Result.URL != "/api/v1/jobs/abc123/result" {
+		t.Errorf("expected result url, got %+v", j.Result)
+	}
+}
+
+func newResultRequest(id string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+id+"/result", nil)
+	req.SetPathValue("id", id)
+	return req
+}
+
+func TestJobResultHandler_Success(t *testing.T) {
+	jobs := newMockJobStore()
+	jobs.jobs["abc123"] = &job.Job{
+		ID:     "abc123",
+		Status: job.StatusCompleted,
+		Result: &job.Result{StorageKey: "results/abc123.jpg", MimeType: "image/jpeg"},
+	}
+	stor := &mockStorage{data: map[string][]byte{"results/abc123.jpg": []byte("0123456789")}}
+	h := newHandlers(jobs, stor, &mockQueue{})
+
+	rr := httptest.NewRecorder()
+	h.JobResultHandler(rr, newResultRequest("abc123"))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "image/jpeg" {
+		t.Errorf("expected image/jpeg, got %s", ct)
+	}
+	if cl := rr.Header().Get("Content-Length"); cl != "10" {
+		t.Errorf("expected Content-Length 10, got %s", cl)
+	}
+	if rr.Header().Get("ETag") == "" {
+		t.Error("expected ETag header")
+	}
+	if rr.Body.String() != "0123456789" {
+		t.Errorf("unexpected body %q", rr.Body.String())
+	}
+}
+
+func TestJobResultHandler_Range(t *testing.T) {
+	jobs := newMockJobStore()
+	jobs.jobs["abc123"] = &job.Job{
+		ID:     "abc123",
+		Status: job.StatusCompleted,
+		Result: &job.Result{StorageKey: "results/abc123.jpg", MimeType: "image/jpeg"},
+	}
+	stor := &mockStorage{data: map[string][]byte{"results/abc123.jpg": []byte("0123456789")}}
+	h := newHandlers(jobs, stor, &mockQueue{})
+
+	req := newResultRequest("abc123")
+	req.Header.Set("Range", "bytes=2-5")
+	rr := httptest.NewRecorder()
+	h.JobResultHandler(rr, req)
+
+	if rr.Code != http.StatusPartialContent {
+		t.Fatalf("expected 206, got %d", rr.Code)
+	}
+	if rr.Body.String() != "2345" {
+		t.Errorf("unexpected body %q", rr.Body.String())
+	}
+}
+
+func TestJobResultHandler_NotModified(t *testing.T) {
+	jobs := newMockJobStore()
+	jobs.jobs["abc123"] = &job.Job{
+		ID:     "abc123",
+		Status: job.StatusCompleted,
+		Result: &job.Result{StorageKey: "results/abc123.jpg"},
+	}
+	stor := &mockStorage{data: map[string][]byte{"results/abc123.jpg": []byte("data")}}
+	h := newHandlers(jobs, stor, &mockQueue{})
+
+	rr := httptest.NewRecorder()
+	h.JobResultHandler(rr, newResultRequest("abc123"))
+
+	req := newResultRequest("abc123")
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	h.JobResultHandler(rr, req)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", rr.Code)
+	}
+}
+
+func TestJobResultHandler_StoredMetadata(t *testing.T) {
+	jobs := newMockJobStore()
+	jobs.jobs["abc123"] = &job.Job{
+		ID:     "abc123",
+		Status: job.StatusCompleted,
+		Result: &job.Result{StorageKey: "results/abc123"},
+	}
+	stor := &mockStorage{
+		data:         map[string][]byte{"results/abc123": []byte("data")},
+		contentTypes: map[string]string{"results/abc123": "image/webp"},
+	}
+	h := newHandlers(jobs, stor, &mockQueue{})
+
+	rr := httptest.NewRecorder()
+	h.JobResultHandler(rr, newResultRequest("abc123"))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "image/webp" {
+		t.Errorf("expected stored content type image/webp, got %s", ct)
+	}
+}
+
+func TestJobResultHandler_NotReady(t *testing.T) {
+	for _, status := range []job.Status{job.StatusQueued, job.StatusProcessing} {
+		t.Run(string(status), func(t *testing.T) {
+			jobs := newMockJobStore()
+			jobs.jobs["abc123"] = &job.Job{ID: "abc123", Status: status}
+			h := newHandlers(jobs, &mockStorage{}, &mockQueue{})
+
+			rr := httptest.NewRecorder()
+			h.JobResultHandler(rr, newResultRequest("abc123"))
+			if rr.Code != http.StatusConflict {
+				t.Errorf("expected 409, got %d", rr.Code)
+			}
+		})
+	}
+}
+
+func TestJobResultHandler_ObjectMissing(t *testing.T) {
+	jobs := newMockJobStore()
+	jobs.jobs["abc123"] = &job.Job{
+		ID:     "abc123",
+		Status: job.StatusCompleted,
+		Result: &job.Result{StorageKey: "results/abc123.jpg"},
+	}
+	h := newHandlers(jobs, &mockStorage{}, &mockQueue{})
+
+	rr := httptest.NewRecorder()
+	h.JobResultHandler(rr, newResultRequest("abc123"))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rr.Code)
+	}
+}
+
+func TestJobInputHandler_Success(t *testing.T) {
+	jobs := newMockJobStore()
+	jobs.jobs["abc123"] = &job.Job{
+		ID:     "abc123",
+		Status: job.StatusQueued,
+		Input:  job.Input{StorageKey: "inputs/abc123", MimeType: "image/png"},
+	}
+	stor := &mockStorage{data: map[string][]byte{"inputs/abc123": []byte("png")}}
+	h := newHandlers(jobs, stor, &mockQueue{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/jobs/abc123/input", nil)
+	req.SetPathValue("id", "abc123")
+	rr := httptest.NewRecorder()
+	h.JobInputHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("expected image/png, got %s", ct)
+	}
+}
+
+func TestSubmitJobHandler_Multipart(t *testing.T) {
+	jobs := newMockJobStore()
+	q := &mockQueue{}
+	h := newHandlers(jobs, &mockStorage{}, q)
+
+	req := multipartFormRequest(t, "/api/v1/jobs", map[string]string{
+		"type":       "resize",
+		"parameters": `{"width": 20, "height": 10}`,
+	}, true)
+	rr := httptest.NewRecorder()
+	h.SubmitJobHandler(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(jobs.created) != 1 || len(q.published) != 1 {
+		t.Fatalf("expected 1 job created and published, got %d and %d", len(jobs.created), len(q.published))
+	}
+	j := jobs.created[0]
+	if j.Type != job.TypeResize || j.Status != job.StatusQueued {
+		t.Errorf("job = %+v", j)
+	}
+	if j.Parameters["width"] != float64(20) || j.Parameters["height"] != float64(10) {
+		t.Errorf("parameters = %v", j.Parameters)
+	}
+	if j.Input.StorageKey != "inputs/"+j.ID {
+		t.Errorf("input key = %q, want inputs/%s", j.Input.StorageKey, j.ID)
+	}
+	want := job.Input{StorageKey: j.Input.StorageKey, MimeType: "image/jpeg", Size: j.Input.Size, Format: "jpeg", Width: 1, Height: 1}
+	if j.Input != want {
+		t.Errorf("input = %+v, want %+v", j.Input, want)
+	}
+}
+
+func TestSubmitJobHandler_ContentSniffing(t *testing.T) {
+	var pngData, bmpData bytes.Buffer
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := bmp.Encode(&bmpData, img); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		formats     []string
+		wantStatus  int
+		wantFormat  string
+	}{
+		{"jpeg", testJPEG, "image/jpeg", nil, http.StatusAccepted, "jpeg"},
+		{"jpeg alias", testJPEG, "image/jpg", nil, http.StatusAccepted, "jpeg"},
+		{"generic content type", testJPEG, "application/octet-stream", nil, http.StatusAccepted, "jpeg"},
+		{"png", pngData.Bytes(), "image/png", nil, http.StatusAccepted, "png"},
+		{"bmp", bmpData.Bytes(), "image/bmp", nil, http.StatusAccepted, "bmp"},
+		{"jpeg labelled png", testJPEG, "image/png", nil, http.StatusUnsupportedMediaType, ""},
+		{"text labelled png", []byte("not an image"), "image/png", nil, http.StatusUnsupportedMediaType, ""},
+		{"format not allowed", testJPEG, "image/jpeg", []string{"png"}, http.StatusUnsupportedMediaType, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := newMockJobStore()
+			stor := &mockStorage{}
+			h := newHandlers(jobs, stor, &mockQueue{})
+			h.limits.Formats = tt.formats
+
+			var body bytes.Buffer
+			w := multipart.NewWriter(&body)
+			w.WriteField("type", "grayscale")
+			part, err := w.CreatePart(textproto.MIMEHeader{
+				"Content-Disposition": {`form-data; name="image"; filename="upload"`},
+				"Content-Type":        {tt.contentType},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write(tt.data)
+			w.Close()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", &body)
+			req.Header.Set("Content-Type", w.FormDataContentType())
+
+			rr := httptest.NewRecorder()
+			h.SubmitJobHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusAccepted {
+				var resp errorResponse
+				if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp.ErrorCode != job.CodeUnsupportedFormat {
+					t.Errorf("error code = %s, want %s", resp.ErrorCode, job.CodeUnsupportedFormat)
+				}
+				if len(stor.uploaded) != 0 {
+					t.Errorf("expected no uploads, got %v", stor.uploaded)
+				}
+				return
+			}
+			if in := jobs.created[0].Input; in.Format != tt.wantFormat || in.MimeType != "image/"+tt.wantFormat {
+				t.Errorf("input = %+v, want format %s", in, tt.wantFormat)
+			}
+		})
+	}
+}
+
+func TestSubmitJobHandler_JSON(t *testing.T) {
+	jobs := newMockJobStore()
+	q := &mockQueue{}
+	stor := &mockStorage{data: map[string][]byte{"inputs/existing": testJPEG}}
+	h := newHandlers(jobs, stor, q)
+
+	body := `{"type": "crop", "parameters": {"x": 0, "y": 0, "width": 1, "height": 1}, "input_key": "inputs/existing"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	h.SubmitJobHandler(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(jobs.created) != 1 || len(q.published) != 1 {
+		t.Fatalf("expected 1 job created and published, got %d and %d", len(jobs.created), len(q.published))
+	}
+	if j := jobs.created[0]; j.Type != job.TypeCrop || j.Input.StorageKey != "inputs/existing" || j.Input.Size != int64(len(testJPEG)) {
+		t.Errorf("job = %+v", j)
+	}
+}
+
+func TestSubmitJobHandler_MultipartInputKey(t *testing.T) {
+	jobs := newMockJobStore()
+	stor := &mockStorage{data: map[string][]byte{"inputs/existing": testJPEG}}
+	h := newHandlers(jobs, stor, &mockQueue{})
+
+	req := multipartFormRequest(t, "/api/v1/jobs", map[string]string{
+		"type":       "resize",
+		"parameters": `{"width": 20, "height": 10}`,
+		"input_key":  "inputs/existing",
+	}, false)
+	rr := httptest.NewRecorder()
+	h.SubmitJobHandler(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if j := jobs.created[0]; j.Input.StorageKey != "inputs/existing" {
+		t.Errorf("input key = %q", j.Input.StorageKey)
+	}
+}
+
+func TestSubmitJobHandler_ImageAndInputKey(t *testing.T) {
+	jobs := newMockJobStore()
+	stor := &mockStorage{data: map[string][]byte{"inputs/existing": testJPEG}}
+	h := newHandlers(jobs, stor, &mockQueue{})
+
+	req := multipartFormRequest(t, "/api/v1/jobs", map[string]string{
+		"type":       "resize",
+		"parameters": `{"width": 20, "height": 10}`,
+		"input_key":  "inputs/existing",
+	}, true)
+	rr := httptest.NewRecorder()
+	h.SubmitJobHandler(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(jobs.created) != 0 || len(stor.uploaded) != 0 {
+		t.Error("rejected request should not store an input or create a job")
+	}
+}
+
+func TestSubmitJobHandler_Rejected(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{"unknown type", "application/json", `{"type": "explode", "input_key": "inputs/existing"}`, http.StatusBadRequest},
+		{"missing type", "application/json", `{"parameters": {}, "input_key": "inputs/existing"}`, http.StatusBadRequest},
+		{"invalid parameters", "application/json", `{"type": "resize", "parameters": {"width": 0, "height": 10}, "input_key": "inputs/existing"}`, http.StatusBadRequest},
+		{"missing parameters", "application/json", `{"type": "resize", "input_key": "inputs/existing"}`, http.StatusBadRequest},
+		{"missing input", "application/json", `{"type": "resize", "parameters": {"width": 10, "height": 10}}`, http.StatusBadRequest},
+		{"unknown input", "application/json", `{"type": "resize", "parameters": {"width": 10, "height": 10}, "input_key": "inputs/nope"}`, http.StatusBadRequest},
+		{"input key traversal", "application/json", `{"type": "resize", "parameters": {"width": 10, "height": 10}, "input_key": "../inputs/existing"}`, http.StatusBadRequest},
+		{"input key outside inputs", "application/json", `{"type": "resize", "parameters": {"width": 10, "height": 10}, "input_key": "results/existing"}`, http.StatusBadRequest},
+		{"overlay key traversal", "application/json", `{"type": "watermark", "parameters": {"overlay": "overlays/../../secret"}, "input_key": "inputs/existing"}`, http.StatusBadRequest},
+		{"unknown field", "application/json", `{"type": "resize", "params": {}, "input_key": "inputs/existing"}`, http.StatusBadRequest},
+		{"malformed JSON", "application/json", `{"type": `, http.StatusBadRequest},
+		{"unsupported content type", "text/plain", `resize`, http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := newMockJobStore()
+			q := &mockQueue{}
+			stor := &mockStorage{data: map[string][]byte{"inputs/existing": testJPEG}}
+			h := newHandlers(jobs, stor, q)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			h.SubmitJobHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if len(jobs.created) != 0 || len(q.published) != 0 {
+				t.Error("rejected request should not create or publish a job")
+			}
+		})
+	}
+}
+
+func TestSubmitJobHandler_InvalidParamsNotStored(t *testing.T) {
+	jobs := newMockJobStore()
+	stor := &mockStorage{}
+	h := newHandlers(jobs, stor, &mockQueue{})
+
+	req := multipartFormRequest(t, "/api/v1/jobs", map[string]string{
+		"type":       "crop",
+		"parameters": `{"x": -1, "y": 0, "width": 5, "height": 5}`,
+	}, true)
+	rr := httptest.NewRecorder()
+	h.SubmitJobHandler(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(stor.uploaded) != 0 {
+		t.Errorf("expected no uploads, got %v", stor.uploaded)
+	}
+}
+
+func TestSubmitJobHandler_ImageRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      string
+		params   string
+		image    []byte
+		wantCode job.ErrorCode
+	}{
+		{"crop outside image", "crop", `{"x": 0, "y": 0, "width": 2, "height": 1}`, testJPEG, job.CodeInvalidParameters},
+		{"crop offset outside image", "crop", `{"x": 1, "y": 0, "width": 1, "height": 1}`, testJPEG, job.CodeInvalidParameters},
+		{"undecodable image", "resize", `{"width": 10, "height": 10}`, corruptPNG, job.CodeInvalidImage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := newMockJobStore()
+			stor := &mockStorage{data: map[string][]byte{"inputs/existing": tt.image}}
+			h := newHandlers(jobs, stor, &mockQueue{})
+
+			body := fmt.Sprintf(`{"type": %q, "parameters": %s, "input_key": "inputs/existing"}`, tt.typ, tt.params)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			h.SubmitJobHandler(rr, req)
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("expected 422, got %d: %s", rr.Code, rr.Body.String())
+			}
+			var resp errorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.ErrorCode != tt.wantCode || resp.Error == "" {
+				t.Errorf("response = %+v, want code %s", resp, tt.wantCode)
+			}
+			if len(jobs.created) != 0 {
+				t.Error("rejected request should not create a job")
+			}
+		})
+	}
+}
+
+func TestSubmitJobHandler_ImageTooLarge(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		limits decoder.Limits
+		want   int
+	}{
+		{"within limits", decoder.Limits{MaxDimension: 20, MaxPixels: 200}, http.StatusAccepted},
+		{"exceeds dimension limit", decoder.Limits{MaxDimension: 19}, http.StatusUnprocessableEntity},
+		{"exceeds pixel limit", decoder.Limits{MaxPixels: 199}, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := newMockJobStore()
+			stor := &mockStorage{data: map[string][]byte{"inputs/existing": buf.Bytes()}}
+			h := newHandlers(jobs, stor, &mockQueue{})
+			h.limits = tt.limits
+
+			body := `{"type": "resize", "parameters": {"width": 5, "height": 5}, "input_key": "inputs/existing"}`
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			h.SubmitJobHandler(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+			if tt.want != http.StatusUnprocessableEntity {
+				return
+			}
+			var resp errorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.ErrorCode != job.CodeImageTooLarge {
+				t.Errorf("error code = %s, want %s", resp.ErrorCode, job.CodeImageTooLarge)
+			}
+		})
+	}
+}
+
+func TestSubmitJobHandler_OrientedDimensions(t *testing.T) {
+	// A 4x2 JPEG tagged as rotated 90 degrees is 2x4 upright
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	e := metadatatest.EXIF(t, metadatatest.Tag{IFD: metadata.IFD0, Tag: metadata.TagOrientation, Value: uint16(6)})
+	rotated, err := metadata.Embed(buf.Bytes(), "jpeg", &metadata.Metadata{EXIF: e})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		params     string
+		wantStatus int
+	}{
+		{"fits upright image", `{"x": 0, "y": 0, "width": 2, "height": 4}`, http.StatusAccepted},
+		{"fits stored image only", `{"x": 0, "y": 0, "width": 4, "height": 2}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stor := &mockStorage{data: map[string][]byte{"inputs/existing": rotated}}
+			h := newHandlers(newMockJobStore(), stor, &mockQueue{})
+
+			body := fmt.Sprintf(`{"type": "crop", "parameters": %s, "input_key": "inputs/existing"}`, tt.params)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			h.SubmitJobHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestEnqueue_ValidatesBeforeStoring(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		handler    func(*Handlers) http.HandlerFunc
+		wantStatus int
+		wantCode   job.ErrorCode
+	}{
+		{"resize zero width", "/api/v1/resize?width=0&height=10", func(h *Handlers) http.HandlerFunc { return h.ResizeHandler }, http.StatusBadRequest, job.CodeInvalidParameters},
+		{"resize unknown filter", "/api/v1/resize?width=10&filter=box", func(h *Handlers) http.HandlerFunc { return h.ResizeHandler }, http.StatusBadRequest, job.CodeInvalidParameters},
+		{"resize invalid linear", "/api/v1/resize?width=10&linear=maybe", func(h *Handlers) http.HandlerFunc { return h.ResizeHandler }, http.StatusBadRequest, job.CodeInvalidParameters},
+		{"resize unknown mode", "/api/v1/resize?width=10&height=10&mode=squash", func(h *Handlers) http.HandlerFunc { return h.ResizeHandler }, http.StatusBadRequest, job.CodeInvalidParameters},
+		{"resize too large", "/api/v1/resize?width=99999&height=10", func(h *Handlers) http.HandlerFunc { return h.ResizeHandler }, http.StatusBadRequest, job.CodeInvalidParameters},
+		{"crop negative", "/api/v1/crop?x=-1&y=0&width=1&height=1", func(h *Handlers) http.HandlerFunc { return h.CropHandler }, http.StatusBadRequest, job.CodeInvalidParameters},
+		{"crop outside image", "/api/v1/crop?x=0&y=0&width=50&height=50", func(h *Handlers) http.HandlerFunc { return h.CropHandler }, http.StatusUnprocessableEntity, job.CodeInvalidParameters},
+		{"rotate missing angle", "/api/v1/rotate", func(h *Handlers) http.HandlerFunc { return h.RotateHandler }, http.StatusBadRequest, job.CodeInvalidParameters},
+		{"rotate invalid expand", "/api/v1/rotate?angle=45&expand=maybe", func(h *Handlers) http.HandlerFunc { return h.RotateHandler }, http.StatusBadRequest, job.CodeInvalidParameters},
+		{"rotate invalid background", "/api/v1/rotate?angle=45&background=red", func(h *Handlers) http.HandlerFunc { return h.RotateHandler }, http.StatusBadRequest, job.CodeInvalidParameters},
+		{"flip unknown direction", "/api/v1/flip?direction=diagonal", func(h *Handlers) http.HandlerFunc { return h.FlipHandler }, http.StatusBadRequest, job.CodeInvalidParameters},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := newMockJobStore()
+			stor := &mockStorage{}
+			h := newHandlers(jobs, stor, &mockQueue{})
+
+			rr := httptest.NewRecorder()
+			tt.handler(h)(rr, multipartImageRequest(t, tt.url))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			var resp errorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.ErrorCode != tt.wantCode {
+				t.Errorf("error_code = %s, want %s", resp.ErrorCode, tt.wantCode)
+			}
+			if len(stor.uploaded) != 0 || len(jobs.created) != 0 {
+				t.Errorf("rejected request stored %v and created %d jobs", stor.uploaded, len(jobs.created))
+			}
+		})
+	}
+}
+
+func TestSubmitJobHandler_Pipeline(t *testing.T) {
+	tests := []struct {
+		name       string
+		steps      string
+		wantStatus int
+	}{
+		{"valid", `[{"processor": "crop", "params": {"x": 0, "y": 0, "width": 1, "height": 1}}, {"processor": "resize", "params": {"width": 10, "height": 10}}]`, http.StatusAccepted},
+		{"invalid step", `[{"processor": "resize", "params": {"width": 10, "height": 10}}, {"processor": "resize", "params": {"width": 0}}]`, http.StatusBadRequest},
+		{"unknown step", `[{"processor": "explode"}]`, http.StatusBadRequest},
+		{"first step outside image", `[{"processor": "crop", "params": {"x": 0, "y": 0, "width": 5, "height": 5}}]`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := newMockJobStore()
+			stor := &mockStorage{data: map[string][]byte{"inputs/existing": testJPEG}}
+			h := newHandlers(jobs, stor, &mockQueue{})
+
+			body := fmt.Sprintf(`{"type": "pipeline", "parameters": {"steps": %s}, "input_key": "inputs/existing"}`, tt.steps)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			h.SubmitJobHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusAccepted && jobs.created[0].Type != job.TypePipeline {
+				t.Errorf("type = %s, want pipeline", jobs.created[0].Type)
+			}
+		})
+	}
+}
+
+func TestSubmitJobHandler_Output(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		wantStatus int
+	}{
+		{"same as input", `{}`, http.StatusAccepted},
+		{"png", `{"format": "png", "compression": "best"}`, http.StatusAccepted},
+		{"jpeg quality", `{"format": "jpeg", "quality": 85}`, http.StatusAccepted},
+		{"unknown format", `{"format": "tiff"}`, http.StatusBadRequest},
+		{"quality out of range", `{"quality": 101}`, http.StatusBadRequest},
+		{"progressive jpeg", `{"format": "jpeg", "progressive": true}`, http.StatusAccepted},
+		{"unknown png compression", `{"format": "png", "compression": "max"}`, http.StatusBadRequest},
+		{"keep all metadata", `{"metadata": "all", "strip_gps": true}`, http.StatusAccepted},
+		{"unknown metadata policy", `{"metadata": "some"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := newMockJobStore()
+			stor := &mockStorage{data: map[string][]byte{"inputs/existing": testJPEG}}
+			h := newHandlers(jobs, stor, &mockQueue{})
+
+			body := fmt.Sprintf(`{"type": "resize", "parameters": {"width": 5, "height": 5}, "output": %s, "input_key": "inputs/existing"}`, tt.output)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			h.SubmitJobHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestResizeHandler_OutputQuery(t *testing.T) {
+	jobs := newMockJobStore()
+	h := newHandlers(jobs, &mockStorage{}, &mockQueue{})
+
+	rr := httptest.NewRecorder()
+	h.ResizeHandler(rr, multipartImageRequest(t, "/api/v1/resize?width=5&height=5&format=png&compression=fast"))
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if out := jobs.created[0].Output; out.Format != "png" || out.Compression != "fast" {
+		t.Errorf("output = %+v", out)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ResizeHandler(rr, multipartImageRequest(t, "/api/v1/resize?width=5&height=5&metadata=all&strip_gps=true"))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if out := jobs.created[1].Output; out.Metadata != "all" || !out.StripGPS {
+		t.Errorf("output = %+v", out)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ResizeHandler(rr, multipartImageRequest(t, "/api/v1/resize?width=5&height=5&quality=high"))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid quality, got %d", rr.Code)
+	}
+}
+
+func TestSubmitJobHandler_References(t *testing.T) {
+	tests := []struct {
+		name       string
+		typ        string
+		params     string
+		wantStatus int
+		wantCode   job.ErrorCode
+	}{
+		{"overlay exists", "watermark", `{"overlay": "overlays/logo"}`, http.StatusAccepted, ""},
+		{"overlay missing", "watermark", `{"overlay": "overlays/nope"}`, http.StatusBadRequest, job.CodeInputNotFound},
+		{"pipeline overlay exists", "pipeline", `{"steps": [{"processor": "watermark", "params": {"overlay": "overlays/logo"}}]}`, http.StatusAccepted, ""},
+		{"pipeline overlay missing", "pipeline", `{"steps": [{"processor": "grayscale"}, {"processor": "watermark", "params": {"overlay": "overlays/nope"}}]}`, http.StatusBadRequest, job.CodeInputNotFound},
+		{"font exists", "text", `{"text": "Hi", "font_key": "fonts/brand.ttf"}`, http.StatusAccepted, ""},
+		{"font missing", "text", `{"text": "Hi", "font_key": "fonts/nope.ttf"}`, http.StatusBadRequest, job.CodeInputNotFound},
+		{"overlay from another job's result", "watermark", `{"overlay": "results/other.jpg"}`, http.StatusBadRequest, job.CodeInvalidParameters},
+		{"font from another job's result", "text", `{"text": "Hi", "font_key": "results/other.jpg"}`, http.StatusBadRequest, job.CodeInvalidParameters},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := newMockJobStore()
+			stor := &mockStorage{data: map[string][]byte{"inputs/existing": testJPEG, "overlays/logo": testJPEG, "fonts/brand.ttf": {}, "results/other.jpg": testJPEG}}
+			h := newHandlers(jobs, stor, &mockQueue{})
+
+			body := fmt.Sprintf(`{"type": %q, "parameters": %s, "input_key": "inputs/existing"}`, tt.typ, tt.params)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			h.SubmitJobHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusBadRequest {
+				var resp errorResponse
+				if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || resp.ErrorCode != tt.wantCode {
+					t.Errorf("error_code = %q, want %q", resp.ErrorCode, tt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+// overlayFormRequest builds a job submission with the test image and an
+// overlay file
+func overlayFormRequest(t *testing.T, fields map[string]string, overlay []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, data := range map[string][]byte{"image": testJPEG, "overlay": overlay} {
+		fw, err := w.CreateFormFile(name, name+".jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestSubmitJobHandler_OverlayUpload(t *testing.T) {
+	tests := []struct {
+		name       string
+		typ        string
+		params     string
+		overlay    []byte
+		wantStatus int
+	}{
+		{"watermark", "watermark", `{"opacity": 0.5}`, testJPEG, http.StatusAccepted},
+		{"pipeline", "pipeline", `{"steps": [{"processor": "grayscale"}, {"processor": "watermark"}]}`, testJPEG, http.StatusAccepted},
+		{"overlay key given", "watermark", `{"overlay": "overlays/logo"}`, testJPEG, http.StatusBadRequest},
+		{"no watermark step", "resize", `{"width": 10}`, testJPEG, http.StatusBadRequest},
+		{"undecodable overlay", "watermark", `{}`, corruptPNG, http.StatusUnprocessableEntity},
+		{"overlay not an image", "watermark", `{}`, []byte("not an image"), http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := newMockJobStore()
+			stor := &mockStorage{data: map[string][]byte{"overlays/logo": testJPEG}}
+			h := newHandlers(jobs, stor, &mockQueue{})
+
+			rr := httptest.NewRecorder()
+			h.SubmitJobHandler(rr, overlayFormRequest(t, map[string]string{
+				"type":       tt.typ,
+				"parameters": tt.params,
+			}, tt.overlay))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusAccepted {
+				if len(stor.uploaded) != 0 {
+					t.Errorf("expected no uploads, got %v", stor.uploaded)
+				}
+				return
+			}
+
+			j := jobs.created[0]
+			overlayKey := "overlays/" + j.ID
+			if !reflect.DeepEqual(stor.uploaded, []string{"inputs/" + j.ID, overlayKey}) {
+				t.Errorf("uploaded = %v", stor.uploaded)
+			}
+			params := j.Parameters
+			if tt.typ == "pipeline" {
+				steps, err := processors.PipelineSteps(params)
+				if err != nil {
+					t.Fatal(err)
+				}
+				params = steps[1].Params
+			}
+			if params["overlay"] != overlayKey {
+				t.Errorf("overlay = %v, want %s", params["overlay"], overlayKey)
+			}
+		})
+	}
+}
+
+func TestSubmitJobHandler_OverlayUploadFails(t *testing.T) {
+	jobs := newMockJobStore()
+	stor := &mockStorage{failUpload: "overlays/"}
+	h := newHandlers(jobs, stor, &mockQueue{})
+
+	rr := httptest.NewRecorder()
+	h.SubmitJobHandler(rr, overlayFormRequest(t, map[string]string{
+		"type":       "watermark",
+		"parameters": `{}`,
+	}, testJPEG))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(stor.uploaded) != 1 || !reflect.DeepEqual(stor.deleted, stor.uploaded) {
+		t.Errorf("expected the stored input %v to be deleted, deleted %v", stor.uploaded, stor.deleted)
+	}
+	if len(jobs.created) != 0 {
+		t.Error("failed request should not create a job")
+	}
+}
+
+func TestSubmitJobHandler_SubmitFailsDiscardsUploads(t *testing.T) {
+	tests := []struct {
+		name     string
+		jobsErr  error
+		queueErr error
+	}{
+		{"job not created", errors.New("connection refused"), nil},
+		{"job not published", nil, errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := newMockJobStore()
+			jobs.err = tt.jobsErr
+			stor := &mockStorage{}
+			h := newHandlers(jobs, stor, &mockQueue{err: tt.queueErr})
+
+			rr := httptest.NewRecorder()
+			h.SubmitJobHandler(rr, overlayFormRequest(t, map[string]string{
+				"type":       "watermark",
+				"parameters": `{}`,
+			}, testJPEG))
+
+			if rr.Code != http.StatusInternalServerError {
+				t.Fatalf("expected 500, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if len(stor.uploaded) != 2 || !reflect.DeepEqual(stor.deleted, stor.uploaded) {
+				t.Errorf("expected the stored input and overlay %v to be deleted, deleted %v", stor.uploaded, stor.deleted)
+			}
+		})
+	}
+}
@@ -8,13 +8,17 @@ import (
 	"fmt"
 	"image"
 	"image/jpeg"
+	_ "image/png"
+	"io"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+	"golang.org/x/image/bmp"
 )
 
 var baseURL = func() string {
@@ -76,16 +80,96 @@ func TestCropJob_Completed(t *testing.T) {
 	}
 }
 
-func TestResizeJob_InvalidImage(t *testing.T) {
-	jobID := submitRaw(t, "/api/v1/resize?width=50&height=50", []byte("not an image"))
+func TestOrientationJobs_Completed(t *testing.T) {
+	tests := []struct {
+		path       string
+		wantWidth  int
+		wantHeight int
+	}{
+		{"/api/v1/rotate?angle=90", 50, 100},
+		{"/api/v1/rotate?angle=30&expand=true&background=%23000", 112, 94},
+		{"/api/v1/flip?direction=horizontal", 100, 50},
+		{"/api/v1/transpose", 50, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			jobID := submitImage(t, tt.path, 100, 50)
+			j := pollJob(t, jobID, 5*time.Second)
+
+			if j.Status != job.StatusCompleted {
+				t.Fatalf("expected completed, got %s (error: %s)", j.Status, j.Error)
+			}
+			if j.Result.Width != tt.wantWidth || j.Result.Height != tt.wantHeight {
+				t.Errorf("expected %dx%d, got %dx%d", tt.wantWidth, tt.wantHeight, j.Result.Width, j.Result.Height)
+			}
+		})
+	}
+}
+
+func TestResizeJob_DownloadResult(t *testing.T) {
+	jobID := submitImage(t, "/api/v1/resize?width=50&height=50", 100, 100)
 	j := pollJob(t, jobID, 5*time.Second)
+	if j.Status != job.StatusCompleted {
+		t.Fatalf("expected completed, got %s (error: %s)", j.Status, j.Error)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("%s/api/v1/jobs/%s/result", baseURL, jobID))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != j.Result.MimeType {
+		t.Errorf("expected Content-Type %s, got %s", j.Result.MimeType, ct)
+	}
+	img, _, err := image.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 50 || b.Dy() != 50 {
+		t.Errorf("expected 50x50, got %dx%d", b.Dx(), b.Dy())
+	}
+}
 
-	if j.Status != job.StatusFailed {
-		t.Errorf("expected failed, got %s", j.Status)
+func TestResizeJob_InvalidImage(t *testing.T) {
+	body, ct := buildMultipart(t, []byte("\xff\xd8\xffnot an image"))
+	resp, err := http.Post(baseURL+"/api/v1/resize?width=50&height=50", ct, body)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Error     string        `json:"error"`
+		ErrorCode job.ErrorCode `json:"error_code"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
 	}
-	if j.Error == "" {
+	if result.Error == "" {
 		t.Error("expected error message, got empty")
 	}
+	if result.ErrorCode != job.CodeInvalidImage {
+		t.Errorf("expected error code %s, got %s", job.CodeInvalidImage, result.ErrorCode)
+	}
+}
+
+func TestCropJob_OutOfBounds(t *testing.T) {
+	body, ct := buildMultipart(t, makeJPEG(t, 100, 100))
+	resp, err := http.Post(baseURL+"/api/v1/crop?x=80&y=0&width=40&height=40", ct, body)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", resp.StatusCode)
+	}
 }
 
 func TestJobStatus_NotFound(t *testing.T) {
@@ -101,7 +185,179 @@ func TestJobStatus_NotFound(t *testing.T) {
 
 func TestResizeJob_MissingParam(t *testing.T) {
 	body, ct := buildMultipart(t, makeJPEG(t, 100, 100))
-	resp, err := http.Post(baseURL+"/api/v1/resize?width=50", ct, body)
+	resp, err := http.Post(baseURL+"/api/v1/resize?mode=fit", ct, body)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestSubmitJob_Completed(t *testing.T) {
+	body, ct := buildMultipartFields(t, map[string]string{
+		"type":       "resize",
+		"parameters": `{"width": 30, "height": 20}`,
+	}, makeJPEG(t, 100, 100))
+	jobID := postJob(t, ct, body)
+	j := pollJob(t, jobID, 5*time.Second)
+
+	if j.Status != job.StatusCompleted {
+		t.Fatalf("expected completed, got %s (error: %s)", j.Status, j.Error)
+	}
+	if j.Result.Width != 30 || j.Result.Height != 20 {
+		t.Errorf("expected 30x20, got %dx%d", j.Result.Width, j.Result.Height)
+	}
+
+	// Crop the same upload again by reference.
+	reqBody := fmt.Sprintf(`{"type": "crop", "parameters": {"x": 10, "y": 10, "width": 25, "height": 25}, "input_key": %q}`, j.Input.StorageKey)
+	jobID = postJob(t, "application/json", bytes.NewBufferString(reqBody))
+	j = pollJob(t, jobID, 5*time.Second)
+
+	if j.Status != job.StatusCompleted {
+		t.Fatalf("expected completed, got %s (error: %s)", j.Status, j.Error)
+	}
+	if j.Result.Width != 25 || j.Result.Height != 25 {
+		t.Errorf("expected 25x25, got %dx%d", j.Result.Width, j.Result.Height)
+	}
+}
+
+func TestSubmitJob_ResizeModes(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     string
+		wantWidth  int
+		wantHeight int
+	}{
+		{"derived height", `{"width": 50}`, 50, 25},
+		{"fit", `{"width": 50, "height": 50, "mode": "fit"}`, 50, 25},
+		{"cover", `{"width": 50, "height": 50, "mode": "cover", "gravity": "east"}`, 50, 50},
+		{"pad", `{"width": 50, "height": 50, "mode": "pad", "background": "#000"}`, 50, 50},
+		{"linear lanczos3", `{"width": 40, "filter": "lanczos3", "linear": true}`, 40, 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, ct := buildMultipartFields(t, map[string]string{
+				"type":       "resize",
+				"parameters": tt.params,
+			}, makeJPEG(t, 200, 100))
+			jobID := postJob(t, ct, body)
+			j := pollJob(t, jobID, 5*time.Second)
+
+			if j.Status != job.StatusCompleted {
+				t.Fatalf("expected completed, got %s (error: %s)", j.Status, j.Error)
+			}
+			if j.Result.Width != tt.wantWidth || j.Result.Height != tt.wantHeight {
+				t.Errorf("expected %dx%d, got %dx%d", tt.wantWidth, tt.wantHeight, j.Result.Width, j.Result.Height)
+			}
+		})
+	}
+}
+
+func TestSubmitJob_Filters(t *testing.T) {
+	tests := []struct {
+		jobType string
+		params  string
+	}{
+		{"grayscale", `{}`},
+		{"hue", `{"degrees": 90}`},
+		{"blur", `{"sigma": 6, "x": 10, "y": 10, "width": 40, "height": 20}`},
+		{"sharpen", `{"amount": 2}`},
+		{"pixelate", `{"size": 8}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.jobType, func(t *testing.T) {
+			body, ct := buildMultipartFields(t, map[string]string{
+				"type":       tt.jobType,
+				"parameters": tt.params,
+			}, makeJPEG(t, 100, 50))
+			jobID := postJob(t, ct, body)
+			j := pollJob(t, jobID, 5*time.Second)
+
+			if j.Status != job.StatusCompleted {
+				t.Fatalf("expected completed, got %s (error: %s)", j.Status, j.Error)
+			}
+			if j.Result.Width != 100 || j.Result.Height != 50 {
+				t.Errorf("expected 100x50, got %dx%d", j.Result.Width, j.Result.Height)
+			}
+		})
+	}
+}
+
+func TestSubmitJob_Text(t *testing.T) {
+	body, ct := buildMultipartFields(t, map[string]string{
+		"type": "text",
+		"parameters": `{"text": "Hello, world", "font": "go-bold", "size": 24, "color": "#fff",
+			"stroke_width": 2, "align": "center", "valign": "middle", "angle": -10}`,
+	}, makeJPEG(t, 200, 100))
+	jobID := postJob(t, ct, body)
+	j := pollJob(t, jobID, 5*time.Second)
+
+	if j.Status != job.StatusCompleted {
+		t.Fatalf("expected completed, got %s (error: %s)", j.Status, j.Error)
+	}
+	if j.Result.Width != 200 || j.Result.Height != 100 {
+		t.Errorf("expected 200x100, got %dx%d", j.Result.Width, j.Result.Height)
+	}
+}
+
+func TestSubmitJob_Pipeline(t *testing.T) {
+	body, ct := buildMultipartFields(t, map[string]string{
+		"type": "pipeline",
+		"parameters": `{"steps": [
+			{"processor": "crop", "params": {"x": 0, "y": 0, "width": 60, "height": 60}},
+			{"processor": "resize", "params": {"width": 30, "height": 15}}
+		]}`,
+	}, makeJPEG(t, 100, 100))
+	jobID := postJob(t, ct, body)
+	j := pollJob(t, jobID, 5*time.Second)
+
+	if j.Status != job.StatusCompleted {
+		t.Fatalf("expected completed, got %s (error: %s)", j.Status, j.Error)
+	}
+	if j.Result.Width != 30 || j.Result.Height != 15 {
+		t.Errorf("expected 30x15, got %dx%d", j.Result.Width, j.Result.Height)
+	}
+	if len(j.Result.Steps) != 2 || j.Result.Steps[0].Processor != "crop" || j.Result.Steps[1].Processor != "resize" {
+		t.Errorf("expected crop and resize steps, got %+v", j.Result.Steps)
+	}
+}
+
+func TestSubmitJob_OutputFormat(t *testing.T) {
+	body, ct := buildMultipartFields(t, map[string]string{
+		"type":       "resize",
+		"parameters": `{"width": 30, "height": 30}`,
+		"output":     `{"format": "png"}`,
+	}, makeJPEG(t, 100, 100))
+	jobID := postJob(t, ct, body)
+	j := pollJob(t, jobID, 5*time.Second)
+
+	if j.Status != job.StatusCompleted {
+		t.Fatalf("expected completed, got %s (error: %s)", j.Status, j.Error)
+	}
+	if j.Result.MimeType != "image/png" {
+		t.Errorf("expected image/png, got %s", j.Result.MimeType)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("%s/api/v1/jobs/%s/result", baseURL, jobID))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if _, format, err := image.Decode(resp.Body); err != nil || format != "png" {
+		t.Errorf("expected png result, got %q (error: %v)", format, err)
+	}
+}
+
+func TestSubmitJob_InvalidParams(t *testing.T) {
+	body, ct := buildMultipartFields(t, map[string]string{
+		"type":       "resize",
+		"parameters": `{"width": 0, "height": 20}`,
+	}, makeJPEG(t, 100, 100))
+	resp, err := http.Post(baseURL+"/api/v1/jobs", ct, body)
 	if err != nil {
 		t.Fatalf("request failed: %v", err)
 	}
@@ -111,6 +367,102 @@ func TestResizeJob_MissingParam(t *testing.T) {
 	}
 }
 
+func TestSubmitJob_FilterRegionOutOfBounds(t *testing.T) {
+	body, ct := buildMultipartFields(t, map[string]string{
+		"type":       "blur",
+		"parameters": `{"sigma": 2, "x": 90, "y": 0, "width": 20, "height": 20}`,
+	}, makeJPEG(t, 100, 100))
+	resp, err := http.Post(baseURL+"/api/v1/jobs", ct, body)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", resp.StatusCode)
+	}
+}
+
+func TestSubmitJob_Watermark(t *testing.T) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("type", "watermark")
+	w.WriteField("parameters", `{"scale": 0.25, "margin": 4, "opacity": 0.5}`)
+	for name, data := range map[string][]byte{"image": makeJPEG(t, 100, 50), "overlay": makeJPEG(t, 20, 10)} {
+		fw, err := w.CreateFormFile(name, name+".jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	w.Close()
+
+	jobID := postJob(t, w.FormDataContentType(), &body)
+	j := pollJob(t, jobID, 5*time.Second)
+	if j.Status != job.StatusCompleted {
+		t.Fatalf("expected completed, got %s (error: %s)", j.Status, j.Error)
+	}
+	if j.Result.Width != 100 || j.Result.Height != 50 {
+		t.Errorf("expected 100x50, got %dx%d", j.Result.Width, j.Result.Height)
+	}
+
+	// The uploaded overlay can be reused by key; a missing one is rejected.
+	reqBody := fmt.Sprintf(`{"type": "watermark", "parameters": {"overlay": "overlays/%s", "tile": true}, "input_key": %q}`, jobID, j.Input.StorageKey)
+	j = pollJob(t, postJob(t, "application/json", bytes.NewBufferString(reqBody)), 5*time.Second)
+	if j.Status != job.StatusCompleted {
+		t.Fatalf("expected completed, got %s (error: %s)", j.Status, j.Error)
+	}
+
+	reqBody = fmt.Sprintf(`{"type": "watermark", "parameters": {"overlay": "overlays/missing"}, "input_key": %q}`, j.Input.StorageKey)
+	resp, err := http.Post(baseURL+"/api/v1/jobs", "application/json", bytes.NewBufferString(reqBody))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestSubmitJob_ContentSniffing(t *testing.T) {
+	var bmpData bytes.Buffer
+	if err := bmp.Encode(&bmpData, image.NewRGBA(image.Rect(0, 0, 30, 20))); err != nil {
+		t.Fatal(err)
+	}
+	jobID := submitRaw(t, "/api/v1/resize?width=15&height=10", bmpData.Bytes())
+	j := pollJob(t, jobID, 5*time.Second)
+	if j.Status != job.StatusCompleted {
+		t.Fatalf("expected completed, got %s (error: %s)", j.Status, j.Error)
+	}
+	if j.Input.Format != "bmp" || j.Input.MimeType != "image/bmp" || j.Input.Width != 30 || j.Input.Height != 20 {
+		t.Errorf("input = %+v", j.Input)
+	}
+	if j.Result.MimeType != "image/png" {
+		t.Errorf("expected BMP to be written as PNG, got %s", j.Result.MimeType)
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("type", "grayscale")
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="image"; filename="fake.png"`},
+		"Content-Type":        {"image/png"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("not really a png"))
+	w.Close()
+
+	resp, err := http.Post(baseURL+"/api/v1/jobs", w.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415, got %d", resp.StatusCode)
+	}
+}
+
 func submitImage(t *testing.T, path string, w, h int) string {
 	t.Helper()
 	return submitRaw(t, path, makeJPEG(t, w, h))
@@ -119,7 +471,17 @@ func submitImage(t *testing.T, path string, w, h int) string {
 func submitRaw(t *testing.T, path string, data []byte) string {
 	t.Helper()
 	body, ct := buildMultipart(t, data)
-	resp, err := http.Post(baseURL+path, ct, body)
+	return post(t, path, ct, body)
+}
+
+func postJob(t *testing.T, contentType string, body io.Reader) string {
+	t.Helper()
+	return post(t, "/api/v1/jobs", contentType, body)
+}
+
+func post(t *testing.T, path, contentType string, body io.Reader) string {
+	t.Helper()
+	resp, err := http.Post(baseURL+path, contentType, body)
 	if err != nil {
 		t.Fatalf("request failed: %v", err)
 	}
@@ -162,9 +524,19 @@ func pollJob(t *testing.T, jobID string, timeout time.Duration) *job.Job {
 }
 
 func buildMultipart(t *testing.T, data []byte) (*bytes.Buffer, string) {
+	t.Helper()
+	return buildMultipartFields(t, nil, data)
+}
+
+func buildMultipartFields(t *testing.T, fields map[string]string, data []byte) (*bytes.Buffer, string) {
 	t.Helper()
 	var body bytes.Buffer
 	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
 	fw, err := w.CreateFormFile("image", "test.jpg")
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,339 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// IFD selects a directory of EXIF tags
+type IFD int
+
+const (
+	IFD0    IFD = iota // main image tags, e.g. orientation and copyright
+	IFDExif            // camera and capture tags
+	IFDGPS             // location tags
+)
+
+// EXIF tags
+const (
+	TagOrientation = 0x0112
+	TagArtist      = 0x013b
+	TagCopyright   = 0x8298
+
+	tagImageWidth          = 0x0100
+	tagImageLength         = 0x0101
+	tagStripOffsets        = 0x0111
+	tagStripByteCounts     = 0x0117
+	tagJPEGInterchange     = 0x0201
+	tagJPEGInterchangeSize = 0x0202
+	tagExifIFD             = 0x8769
+	tagGPSIFD              = 0x8825
+	tagInteropIFD          = 0xa005
+	tagMakerNote           = 0x927c
+	tagPixelXDimension     = 0xa002
+	tagPixelYDimension     = 0xa003
+)
+
+// TIFF field types
+const (
+	typeASCII = 2
+	typeShort = 3
+	typeLong  = 4
+	typeIFD   = 13
+)
+
+// typeSizes is the size in bytes of one value of each TIFF field type
+var typeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 13: 4,
+}
+
+// maxIFDEntries bounds the entries read from one directory of untrusted input
+const maxIFDEntries = 1000
+
+// staleTags describe the encoded image data or point into the original file,
+// so they are wrong once the image is re-encoded
+var staleTags = map[IFD][]uint16{
+	IFD0:    {tagImageWidth, tagImageLength, tagStripOffsets, tagStripByteCounts, tagJPEGInterchange, tagJPEGInterchangeSize},
+	IFDExif: {tagPixelXDimension, tagPixelYDimension, tagInteropIFD, tagMakerNote},
+}
+
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+type entry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte // raw value in the EXIF byte order
+}
+
+// EXIF is a parsed EXIF block. IFD0 and its EXIF and GPS sub-IFDs are kept;
+// the thumbnail IFD and tags that point into the original file are dropped.
+type EXIF struct {
+	order byteOrder
+	ifds  [3][]entry
+}
+
+// newEXIF returns an empty little-endian EXIF block
+func newEXIF() *EXIF {
+	return &EXIF{order: binary.LittleEndian}
+}
+
+// ParseEXIF parses a TIFF-structured EXIF block, as found after the "Exif"
+// header of a JPEG APP1 segment or in a PNG eXIf chunk
+func ParseEXIF(b []byte) (*EXIF, error) {
+	if len(b) < 8 {
+		return nil, errors.New("exif: short header")
+	}
+
+	e := &EXIF{}
+	switch string(b[:2]) {
+	case "II":
+		e.order = binary.LittleEndian
+	case "MM":
+		e.order = binary.BigEndian
+	default:
+		return nil, errors.New("exif: invalid byte order")
+	}
+	if e.order.Uint16(b[2:]) != 42 {
+		return nil, errors.New("exif: invalid TIFF header")
+	}
+
+	var err error
+	if e.ifds[IFD0], err = e.readIFD(b, e.order.Uint32(b[4:])); err != nil {
+		return nil, err
+	}
+	for ifd, tag := range map[IFD]uint16{IFDExif: tagExifIFD, IFDGPS: tagGPSIFD} {
+		off, ok := e.pointer(tag)
+		if !ok {
+			continue
+		}
+		if e.ifds[ifd], err = e.readIFD(b, off); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sub-IFD offsets are recomputed by Encode
+	e.delete(IFD0, tagExifIFD, tagGPSIFD)
+	for ifd, tags := range staleTags {
+		e.delete(ifd, tags...)
+	}
+	return e, nil
+}
+
+func (e *EXIF) readIFD(b []byte, off uint32) ([]entry, error) {
+	if uint64(off)+2 > uint64(len(b)) {
+		return nil, fmt.Errorf("exif: IFD offset %d out of range", off)
+	}
+	n := uint32(e.order.Uint16(b[off:]))
+	if n > maxIFDEntries {
+		return nil, fmt.Errorf("exif: too many IFD entries (%d)", n)
+	}
+	start := uint64(off) + 2
+	if start+uint64(n)*12 > uint64(len(b)) {
+		return nil, errors.New("exif: truncated IFD")
+	}
+
+	entries := make([]entry, 0, n)
+	for i := range uint64(n) {
+		p := b[start+12*i : start+12*i+12]
+		en := entry{
+			tag:   e.order.Uint16(p),
+			typ:   e.order.Uint16(p[2:]),
+			count: e.order.Uint32(p[4:]),
+		}
+		size, ok := typeSizes[en.typ]
+		if !ok {
+			continue
+		}
+
+		total := uint64(size) * uint64(en.count)
+		if total <= 4 {
+			en.value = bytes.Clone(p[8 : 8+total])
+		} else {
+			valueOff := uint64(e.order.Uint32(p[8:]))
+			if valueOff+total > uint64(len(b)) {
+				return nil, fmt.Errorf("exif: value of tag %#04x out of range", en.tag)
+			}
+			en.value = bytes.Clone(b[valueOff : valueOff+total])
+		}
+		entries = append(entries, en)
+	}
+	return entries, nil
+}
+
+// pointer reads a sub-IFD offset from IFD0
+func (e *EXIF) pointer(tag uint16) (uint32, bool) {
+	en := e.find(IFD0, tag)
+	if en == nil || (en.typ != typeLong && en.typ != typeIFD) || en.count != 1 {
+		return 0, false
+	}
+	return e.order.Uint32(en.value), true
+}
+
+func (e *EXIF) find(ifd IFD, tag uint16) *entry {
+	for i := range e.ifds[ifd] {
+		if e.ifds[ifd][i].tag == tag {
+			return &e.ifds[ifd][i]
+		}
+	}
+	return nil
+}
+
+func (e *EXIF) delete(ifd IFD, tags ...uint16) {
+	e.ifds[ifd] = slices.DeleteFunc(e.ifds[ifd], func(en entry) bool {
+		return slices.Contains(tags, en.tag)
+	})
+}
+
+func (e *EXIF) set(ifd IFD, en entry) {
+	if existing := e.find(ifd, en.tag); existing != nil {
+		*existing = en
+		return
+	}
+	e.ifds[ifd] = append(e.ifds[ifd], en)
+}
+
+// setASCII sets a string tag
+func (e *EXIF) setASCII(ifd IFD, tag uint16, s string) {
+	value := append([]byte(s), 0)
+	e.set(ifd, entry{tag: tag, typ: typeASCII, count: uint32(len(value)), value: value}) //nolint:gosec
+}
+
+// setShort sets a 16-bit integer tag
+func (e *EXIF) setShort(ifd IFD, tag, v uint16) {
+	e.set(ifd, entry{tag: tag, typ: typeShort, count: 1, value: e.order.AppendUint16(nil, v)})
+}
+
+// ASCII returns a string tag
+func (e *EXIF) ASCII(ifd IFD, tag uint16) (string, bool) {
+	en := e.find(ifd, tag)
+	if en == nil || en.typ != typeASCII {
+		return "", false
+	}
+	return string(bytes.TrimRight(en.value, "\x00")), true
+}
+
+// Orientation returns the orientation tag, 1-8, defaulting to 1 (upright)
+func (e *EXIF) Orientation() int {
+	en := e.find(IFD0, TagOrientation)
+	if en == nil || en.typ != typeShort || en.count != 1 {
+		return 1
+	}
+	o := int(e.order.Uint16(en.value))
+	if o < 1 || o > 8 {
+		return 1
+	}
+	return o
+}
+
+// Clone returns a deep copy
+func (e *EXIF) Clone() *EXIF {
+	c := &EXIF{order: e.order}
+	for i, entries := range e.ifds {
+		c.ifds[i] = make([]entry, len(entries))
+		for j, en := range entries {
+			en.value = bytes.Clone(en.value)
+			c.ifds[i][j] = en
+		}
+	}
+	return c
+}
+
+// credits returns a copy holding only the artist and copyright tags
+func (e *EXIF) credits() *EXIF {
+	c := &EXIF{order: e.order}
+	for _, tag := range []uint16{TagArtist, TagCopyright} {
+		if en := e.find(IFD0, tag); en != nil {
+			c.set(IFD0, *en)
+		}
+	}
+	return c
+}
+
+// Encode serialises the EXIF block as TIFF, without a thumbnail IFD. It
+// returns nil if there are no tags.
+func (e *EXIF) Encode() []byte {
+	type subIFD struct {
+		tag     uint16
+		entries []entry
+	}
+	var subs []subIFD
+	if len(e.ifds[IFDExif]) > 0 {
+		subs = append(subs, subIFD{tagExifIFD, e.ifds[IFDExif]})
+	}
+	if len(e.ifds[IFDGPS]) > 0 {
+		subs = append(subs, subIFD{tagGPSIFD, e.ifds[IFDGPS]})
+	}
+	if len(e.ifds[IFD0]) == 0 && len(subs) == 0 {
+		return nil
+	}
+
+	// Sub-IFDs follow IFD0, so their offsets depend on its size
+	ifd0 := slices.Clone(e.ifds[IFD0])
+	for _, sub := range subs {
+		ifd0 = append(ifd0, entry{tag: sub.tag, typ: typeLong, count: 1, value: make([]byte, 4)})
+	}
+	off := 8 + ifdSize(ifd0)
+	for i, sub := range subs {
+		e.order.PutUint32(ifd0[len(ifd0)-len(subs)+i].value, off)
+		off += ifdSize(sub.entries)
+	}
+
+	out := make([]byte, 0, off)
+	if e.order == binary.BigEndian {
+		out = append(out, "MM"...)
+	} else {
+		out = append(out, "II"...)
+	}
+	out = e.order.AppendUint16(out, 42)
+	out = e.order.AppendUint32(out, 8)
+	out = e.appendIFD(out, ifd0)
+	for _, sub := range subs {
+		out = e.appendIFD(out, sub.entries)
+	}
+	return out
+}
+
+// ifdSize is the encoded size of an IFD including its out-of-line values
+func ifdSize(entries []entry) uint32 {
+	size := 2 + 12*len(entries) + 4
+	for _, en := range entries {
+		if len(en.value) > 4 {
+			size += len(en.value) + len(en.value)%2
+		}
+	}
+	return uint32(size) //nolint:gosec
+}
+
+func (e *EXIF) appendIFD(out []byte, entries []entry) []byte {
+	entries = slices.Clone(entries)
+	slices.SortFunc(entries, func(a, b entry) int { return int(a.tag) - int(b.tag) })
+
+	dataOff := uint32(len(out)) + 2 + 12*uint32(len(entries)) + 4 //nolint:gosec
+	var data []byte
+	out = e.order.AppendUint16(out, uint16(len(entries))) //nolint:gosec
+	for _, en := range entries {
+		out = e.order.AppendUint16(out, en.tag)
+		out = e.order.AppendUint16(out, en.typ)
+		out = e.order.AppendUint32(out, en.count)
+		if len(en.value) <= 4 {
+			var inline [4]byte
+			copy(inline[:], en.value)
+			out = append(out, inline[:]...)
+			continue
+		}
+		out = e.order.AppendUint32(out, dataOff+uint32(len(data))) //nolint:gosec
+		data = append(data, en.value...)
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	out = e.order.AppendUint32(out, 0) // no next IFD
+	return append(out, data...)
+}
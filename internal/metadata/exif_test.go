@@ -0,0 +1,126 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func testEXIF(order byteOrder) *EXIF {
+	e := &EXIF{order: order}
+	e.setShort(IFD0, TagOrientation, 6)
+	e.setASCII(IFD0, TagCopyright, "(c) Example Ltd")
+	e.setASCII(IFD0, TagArtist, "Jo")
+	e.setASCII(IFDExif, 0x9003, "2024:01:02 03:04:05") // DateTimeOriginal
+	e.setASCII(IFDGPS, 0x0001, "N")                    // GPSLatitudeRef
+	return e
+}
+
+func TestEXIF_RoundTrip(t *testing.T) {
+	for name, order := range map[string]byteOrder{"little endian": binary.LittleEndian, "big endian": binary.BigEndian} {
+		t.Run(name, func(t *testing.T) {
+			e, err := ParseEXIF(testEXIF(order).Encode())
+			if err != nil {
+				t.Fatalf("ParseEXIF() error = %v", err)
+			}
+
+			if got := e.Orientation(); got != 6 {
+				t.Errorf("Orientation() = %d, want 6", got)
+			}
+			if got, _ := e.ASCII(IFD0, TagCopyright); got != "(c) Example Ltd" {
+				t.Errorf("copyright = %q", got)
+			}
+			if got, _ := e.ASCII(IFDExif, 0x9003); got != "2024:01:02 03:04:05" {
+				t.Errorf("date = %q", got)
+			}
+			if got, _ := e.ASCII(IFDGPS, 0x0001); got != "N" {
+				t.Errorf("GPS latitude ref = %q", got)
+			}
+			if e.find(IFD0, tagExifIFD) != nil || e.find(IFD0, tagGPSIFD) != nil {
+				t.Error("sub-IFD pointers should not be exposed as tags")
+			}
+		})
+	}
+}
+
+func TestEXIF_DropsStaleTags(t *testing.T) {
+	e := newEXIF()
+	e.setShort(IFD0, tagImageWidth, 100)
+	e.setShort(IFDExif, tagPixelXDimension, 100)
+	e.setASCII(IFDExif, tagMakerNote, "vendor data")
+
+	parsed, err := ParseEXIF(e.Encode())
+	if err != nil {
+		t.Fatalf("ParseEXIF() error = %v", err)
+	}
+	if len(parsed.ifds[IFD0]) != 0 || len(parsed.ifds[IFDExif]) != 0 {
+		t.Errorf("expected stale tags dropped, got %d and %d tags", len(parsed.ifds[IFD0]), len(parsed.ifds[IFDExif]))
+	}
+}
+
+func TestEXIF_Orientation(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(e *EXIF)
+		want int
+	}{
+		{"missing", func(e *EXIF) {}, 1},
+		{"rotated", func(e *EXIF) { e.setShort(IFD0, TagOrientation, 8) }, 8},
+		{"out of range", func(e *EXIF) { e.setShort(IFD0, TagOrientation, 9) }, 1},
+		{"wrong type", func(e *EXIF) { e.setASCII(IFD0, TagOrientation, "6") }, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEXIF()
+			tt.set(e)
+			if got := e.Orientation(); got != tt.want {
+				t.Errorf("Orientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncode_Empty(t *testing.T) {
+	if got := newEXIF().Encode(); got != nil {
+		t.Errorf("Encode() = %v, want nil", got)
+	}
+}
+
+func TestParseEXIF_Malformed(t *testing.T) {
+	valid := testEXIF(binary.LittleEndian).Encode()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short header", []byte("II*\x00")},
+		{"bad byte order", []byte("XX*\x00\x08\x00\x00\x00")},
+		{"bad magic", []byte("II+\x00\x08\x00\x00\x00")},
+		{"IFD out of range", []byte("II*\x00\xff\x00\x00\x00")},
+		{"truncated IFD", []byte("II*\x00\x08\x00\x00\x00\x05\x00")},
+		{"truncated values", valid[:len(valid)-8]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseEXIF(tt.data); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func FuzzParseEXIF(f *testing.F) {
+	f.Add(testEXIF(binary.LittleEndian).Encode())
+	f.Add(testEXIF(binary.BigEndian).Encode())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		e, err := ParseEXIF(data)
+		if err != nil {
+			return
+		}
+		if _, err := ParseEXIF(e.Encode()); err != nil && e.Encode() != nil {
+			t.Errorf("re-encoded EXIF does not parse: %v", err)
+		}
+	})
+}
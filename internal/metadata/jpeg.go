@@ -0,0 +1,133 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	markerSOS  = 0xda
+	markerEOI  = 0xd9
+	markerAPP1 = 0xe1
+	markerAPP2 = 0xe2
+
+	// maxICCChunk is the ICC payload that fits in one APP2 segment after the
+	// length, header and chunk numbering
+	maxICCChunk = 0xffff - 2 - 12 - 2
+)
+
+var (
+	jpegSOI    = []byte{0xff, 0xd8}
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	iccHeader  = []byte("ICC_PROFILE\x00")
+)
+
+func extractJPEG(data []byte) (*Metadata, error) {
+	m := &Metadata{}
+	type iccChunk struct {
+		seq  byte
+		data []byte
+	}
+	var icc []iccChunk
+
+segments:
+	for p := len(jpegSOI); p+4 <= len(data); {
+		if data[p] != 0xff {
+			return m, fmt.Errorf("jpeg: invalid marker at offset %d", p)
+		}
+		marker := data[p+1]
+		switch {
+		case marker == 0xff: // fill byte
+			p++
+			continue
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7): // no payload
+			p += 2
+			continue
+		case marker == markerSOS || marker == markerEOI: // image data follows
+			break segments
+		}
+
+		length := int(binary.BigEndian.Uint16(data[p+2:]))
+		if length < 2 || p+2+length > len(data) {
+			return m, errors.New("jpeg: truncated segment")
+		}
+		seg := data[p+4 : p+2+length]
+		p += 2 + length
+
+		switch {
+		case marker == markerAPP1 && bytes.HasPrefix(seg, exifHeader) && m.EXIF == nil:
+			e, err := ParseEXIF(seg[len(exifHeader):])
+			if err != nil {
+				return m, err
+			}
+			m.EXIF = e
+		case marker == markerAPP1 && bytes.HasPrefix(seg, xmpHeader) && m.XMP == nil:
+			m.XMP = bytes.Clone(seg[len(xmpHeader):])
+		case marker == markerAPP2 && bytes.HasPrefix(seg, iccHeader) && len(seg) >= len(iccHeader)+2:
+			icc = append(icc, iccChunk{seq: seg[len(iccHeader)], data: seg[len(iccHeader)+2:]})
+		}
+	}
+
+	// ICC profiles are split across numbered APP2 segments
+	slices.SortStableFunc(icc, func(a, b iccChunk) int { return int(a.seq) - int(b.seq) })
+	for _, c := range icc {
+		m.ICC = append(m.ICC, c.data...)
+	}
+	return m, nil
+}
+
+// embedJPEG inserts metadata segments directly after the SOI marker
+func embedJPEG(data []byte, m *Metadata) ([]byte, error) {
+	if !bytes.HasPrefix(data, jpegSOI) {
+		return nil, errors.New("jpeg: missing SOI marker")
+	}
+
+	var segs []byte
+	var err error
+	if m.EXIF != nil {
+		if exif := m.EXIF.Encode(); exif != nil {
+			if segs, err = appendSegment(segs, markerAPP1, exifHeader, exif); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(m.XMP) > 0 {
+		if segs, err = appendSegment(segs, markerAPP1, xmpHeader, m.XMP); err != nil {
+			return nil, err
+		}
+	}
+	if len(m.ICC) > 0 {
+		chunks := slices.Collect(slices.Chunk(m.ICC, maxICCChunk))
+		if len(chunks) > 255 {
+			return nil, fmt.Errorf("jpeg: ICC profile too large (%d bytes)", len(m.ICC))
+		}
+		for i, chunk := range chunks {
+			header := append(slices.Clone(iccHeader), byte(i+1), byte(len(chunks))) //nolint:gosec
+			if segs, err = appendSegment(segs, markerAPP2, header, chunk); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return slices.Concat(data[:len(jpegSOI)], segs, data[len(jpegSOI):]), nil
+}
+
+// fitsSegment reports whether header and payload fit in one JPEG segment
+func fitsSegment(header, payload []byte) bool {
+	return 2+len(header)+len(payload) <= 0xffff
+}
+
+func appendSegment(out []byte, marker byte, header, payload []byte) ([]byte, error) {
+	length := 2 + len(header) + len(payload)
+	if !fitsSegment(header, payload) {
+		return nil, fmt.Errorf("jpeg: metadata segment too large (%d bytes)", length)
+	}
+	out = append(out, 0xff, marker)
+	out = binary.BigEndian.AppendUint16(out, uint16(length)) //nolint:gosec
+	out = append(out, header...)
+	return append(out, payload...), nil
+}
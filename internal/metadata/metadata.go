@@ -0,0 +1,180 @@
+// Package metadata reads and writes image metadata: EXIF, ICC colour profiles
+// and XMP. JPEG and PNG are supported; other formats carry no metadata.
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+// Metadata policies for job.Output.Metadata
+const (
+	// PolicyStrip drops all metadata
+	PolicyStrip = "strip"
+
+	// PolicyCopyright keeps the EXIF artist and copyright tags and the ICC
+	// profile. It is the default.
+	PolicyCopyright = "copyright"
+
+	// PolicyAll keeps EXIF, ICC and XMP. GPS tags are dropped if
+	// job.Output.StripGPS is set.
+	PolicyAll = "all"
+)
+
+// Metadata is the metadata carried by an encoded image
+type Metadata struct {
+	EXIF *EXIF
+	ICC  []byte
+	XMP  []byte
+}
+
+// xmpOrientation matches the orientation property in XMP, in attribute or
+// element form
+var xmpOrientation = regexp.MustCompile(`tiff:Orientation(="\d"|>\d<)`)
+
+// Extract reads the metadata of an encoded JPEG or PNG image. Other formats
+// have none. On malformed metadata it returns what was read before the error.
+func Extract(data []byte) (*Metadata, error) {
+	switch {
+	case bytes.HasPrefix(data, jpegSOI):
+		return extractJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return extractPNG(data)
+	}
+	return &Metadata{}, nil
+}
+
+// Orientation returns the EXIF orientation, 1-8, defaulting to 1 (upright)
+func (m *Metadata) Orientation() int {
+	if m == nil || m.EXIF == nil {
+		return 1
+	}
+	return m.EXIF.Orientation()
+}
+
+// ValidateOptions checks the metadata options in out
+func ValidateOptions(out job.Output) error {
+	switch out.Metadata {
+	case "", PolicyStrip, PolicyCopyright, PolicyAll:
+		return nil
+	}
+	return fmt.Errorf("unknown metadata policy %q", out.Metadata)
+}
+
+// Filter returns the metadata kept under out's policy. The orientation is
+// always reset, as images are oriented before processing.
+func (m *Metadata) Filter(out job.Output) *Metadata {
+	kept := &Metadata{}
+	if m == nil {
+		return kept
+	}
+
+	switch out.Metadata {
+	case PolicyStrip:
+		return kept
+	case PolicyAll:
+		if m.EXIF != nil {
+			kept.EXIF = m.EXIF.Clone()
+			kept.EXIF.delete(IFD0, TagOrientation)
+			if out.StripGPS {
+				kept.EXIF.ifds[IFDGPS] = nil
+			}
+		}
+		// XMP may repeat the location, which can't be removed reliably
+		if !(out.StripGPS && bytes.Contains(m.XMP, []byte("exif:GPS"))) {
+			kept.XMP = xmpOrientation.ReplaceAllFunc(m.XMP, func(b []byte) []byte {
+				// The digit is second to last in either form
+				return slices.Concat(b[:len(b)-2], []byte("1"), b[len(b)-1:])
+			})
+		}
+	default:
+		if m.EXIF != nil {
+			kept.EXIF = m.EXIF.credits()
+		}
+	}
+	kept.ICC = m.ICC
+	return kept
+}
+
+// Fit drops metadata that cannot accompany img encoded in the named format,
+// returning a description of each change for the caller to log. An ICC
+// profile for another colour space, e.g. CMYK or gray input re-encoded as
+// RGB, would misrender the output. A JPEG segment holds at most 64 KB, so
+// larger EXIF is cut back to the artist and copyright tags and larger XMP
+// is dropped.
+func (m *Metadata) Fit(format string, img image.Image) []string {
+	if m == nil {
+		return nil
+	}
+
+	var changes []string
+	if space := iccColorSpace(m.ICC); space != "" {
+		if want := outputColorSpace(format, img); space != want {
+			changes = append(changes, fmt.Sprintf("dropped %q ICC profile from %q output", space, want))
+			m.ICC = nil
+		}
+	}
+
+	if format != "jpeg" {
+		return changes
+	}
+	if m.EXIF != nil && !fitsSegment(exifHeader, m.EXIF.Encode()) {
+		m.EXIF = m.EXIF.credits()
+		if !fitsSegment(exifHeader, m.EXIF.Encode()) {
+			m.EXIF = nil
+			changes = append(changes, "dropped EXIF larger than a JPEG segment")
+		} else {
+			changes = append(changes, "trimmed EXIF larger than a JPEG segment to artist and copyright")
+		}
+	}
+	if !fitsSegment(xmpHeader, m.XMP) {
+		m.XMP = nil
+		changes = append(changes, "dropped XMP larger than a JPEG segment")
+	}
+	return changes
+}
+
+// iccColorSpace returns the data colour space declared in an ICC profile
+// header, e.g. "RGB", "GRAY" or "CMYK", or "" if the profile is too short
+func iccColorSpace(icc []byte) string {
+	if len(icc) < 20 {
+		return ""
+	}
+	return strings.TrimRight(string(icc[16:20]), " ")
+}
+
+// outputColorSpace returns the ICC colour space img is encoded in: the
+// encoders write gray images as single-channel data and everything else as
+// RGB (YCbCr in JPEG, which ICC profiles describe as RGB)
+func outputColorSpace(format string, img image.Image) string {
+	switch img.(type) {
+	case *image.Gray:
+		return "GRAY"
+	case *image.Gray16:
+		if format == "png" {
+			return "GRAY"
+		}
+	}
+	return "RGB"
+}
+
+// Embed writes m into encoded image data of the named format. Formats without
+// metadata support are returned unchanged.
+func Embed(data []byte, format string, m *Metadata) ([]byte, error) {
+	if m == nil {
+		return data, nil
+	}
+	switch format {
+	case "jpeg":
+		return embedJPEG(data, m)
+	case "png":
+		return embedPNG(data, m)
+	}
+	return data, nil
+}
@@ -0,0 +1,299 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+func encode(t testing.TB, format string) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("encode %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+func decode(t *testing.T, data []byte) {
+	t.Helper()
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("image no longer decodes: %v", err)
+	}
+}
+
+func TestEmbedExtract(t *testing.T) {
+	// Large enough to need several JPEG APP2 segments
+	icc := bytes.Repeat([]byte("icc profile "), 12000)
+	xmp := []byte(`<x:xmpmeta><rdf:Description dc:rights="(c) Example Ltd"/></x:xmpmeta>`)
+
+	for _, format := range []string{"jpeg", "png"} {
+		t.Run(format, func(t *testing.T) {
+			data, err := Embed(encode(t, format), format, &Metadata{
+				EXIF: testEXIF(binary.LittleEndian),
+				ICC:  icc,
+				XMP:  xmp,
+			})
+			if err != nil {
+				t.Fatalf("Embed() error = %v", err)
+			}
+			decode(t, data)
+
+			m, err := Extract(data)
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if m.Orientation() != 6 {
+				t.Errorf("Orientation() = %d, want 6", m.Orientation())
+			}
+			if got, _ := m.EXIF.ASCII(IFD0, TagCopyright); got != "(c) Example Ltd" {
+				t.Errorf("copyright = %q", got)
+			}
+			if !bytes.Equal(m.ICC, icc) {
+				t.Errorf("ICC profile of %d bytes, want %d", len(m.ICC), len(icc))
+			}
+			if !bytes.Equal(m.XMP, xmp) {
+				t.Errorf("XMP = %q, want %q", m.XMP, xmp)
+			}
+		})
+	}
+}
+
+func TestEmbed_UnsupportedFormat(t *testing.T) {
+	data := encode(t, "gif")
+	got, err := Embed(data, "gif", &Metadata{EXIF: testEXIF(binary.LittleEndian)})
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("expected gif data unchanged")
+	}
+}
+
+func TestExtract_NoMetadata(t *testing.T) {
+	for _, format := range []string{"jpeg", "png", "gif"} {
+		t.Run(format, func(t *testing.T) {
+			m, err := Extract(encode(t, format))
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if m.EXIF != nil || m.ICC != nil || m.XMP != nil {
+				t.Errorf("expected no metadata, got %+v", m)
+			}
+			if m.Orientation() != 1 {
+				t.Errorf("Orientation() = %d, want 1", m.Orientation())
+			}
+		})
+	}
+}
+
+func TestExtract_Truncated(t *testing.T) {
+	data, err := Embed(encode(t, "jpeg"), "jpeg", &Metadata{EXIF: testEXIF(binary.LittleEndian)})
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+
+	m, err := Extract(data[:20])
+	if err == nil {
+		t.Error("expected error for truncated segment")
+	}
+	if m == nil {
+		t.Error("expected partial metadata, got nil")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	src := &Metadata{
+		EXIF: testEXIF(binary.LittleEndian),
+		ICC:  []byte("icc"),
+		XMP:  []byte(`<rdf:Description tiff:Orientation="6" exif:GPSLatitude="51,30N"/>`),
+	}
+
+	tests := []struct {
+		name       string
+		out        job.Output
+		wantEXIF   []IFD // IFDs expected to have tags
+		wantICC    bool
+		wantXMP    bool
+		wantArtist bool
+	}{
+		{"default keeps copyright", job.Output{}, []IFD{IFD0}, true, false, true},
+		{"copyright", job.Output{Metadata: PolicyCopyright}, []IFD{IFD0}, true, false, true},
+		{"strip", job.Output{Metadata: PolicyStrip}, nil, false, false, false},
+		{"all", job.Output{Metadata: PolicyAll}, []IFD{IFD0, IFDExif, IFDGPS}, true, true, true},
+		{"all without GPS", job.Output{Metadata: PolicyAll, StripGPS: true}, []IFD{IFD0, IFDExif}, true, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := src.Filter(tt.out)
+
+			for _, ifd := range []IFD{IFD0, IFDExif, IFDGPS} {
+				want := false
+				for _, w := range tt.wantEXIF {
+					want = want || w == ifd
+				}
+				if has := got.EXIF != nil && len(got.EXIF.ifds[ifd]) > 0; has != want {
+					t.Errorf("IFD %d has tags = %v, want %v", ifd, has, want)
+				}
+			}
+			if got.EXIF != nil {
+				if got.EXIF.find(IFD0, TagOrientation) != nil {
+					t.Error("orientation should be dropped")
+				}
+				if has := got.EXIF.find(IFD0, TagArtist) != nil; has != tt.wantArtist {
+					t.Errorf("artist kept = %v, want %v", has, tt.wantArtist)
+				}
+			}
+			if has := got.ICC != nil; has != tt.wantICC {
+				t.Errorf("ICC kept = %v, want %v", has, tt.wantICC)
+			}
+			if has := got.XMP != nil; has != tt.wantXMP {
+				t.Errorf("XMP kept = %v, want %v", has, tt.wantXMP)
+			}
+		})
+	}
+
+	if src.EXIF.Orientation() != 6 {
+		t.Error("Filter modified its receiver")
+	}
+}
+
+func TestFilter_XMPOrientation(t *testing.T) {
+	src := &Metadata{XMP: []byte(`<a tiff:Orientation="8"/><tiff:Orientation>6</tiff:Orientation>`)}
+	got := src.Filter(job.Output{Metadata: PolicyAll})
+	want := `<a tiff:Orientation="1"/><tiff:Orientation>1</tiff:Orientation>`
+	if string(got.XMP) != want {
+		t.Errorf("XMP = %q, want %q", got.XMP, want)
+	}
+}
+
+// iccProfile returns a profile header declaring the given colour space
+func iccProfile(space string) []byte {
+	icc := make([]byte, 128)
+	copy(icc[16:], space)
+	return icc
+}
+
+func TestFit(t *testing.T) {
+	big := testEXIF(binary.LittleEndian)
+	big.setASCII(IFDExif, 0x9286, strings.Repeat("x", 70000)) // UserComment
+	huge := testEXIF(binary.LittleEndian)
+	huge.setASCII(IFD0, TagCopyright, strings.Repeat("x", 70000))
+
+	rgb := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	gray := image.NewGray(image.Rect(0, 0, 1, 1))
+	gray16 := image.NewGray16(image.Rect(0, 0, 1, 1))
+
+	tests := []struct {
+		name        string
+		format      string
+		img         image.Image
+		m           Metadata
+		wantICC     bool
+		wantEXIF    bool
+		wantComment bool
+		wantXMP     bool
+		wantChanges int
+	}{
+		{"matching RGB profile", "jpeg", rgb, Metadata{ICC: iccProfile("RGB ")}, true, false, false, false, 0},
+		{"CMYK profile on RGB output", "jpeg", rgb, Metadata{ICC: iccProfile("CMYK")}, false, false, false, false, 1},
+		{"gray profile on RGB output", "png", rgb, Metadata{ICC: iccProfile("GRAY")}, false, false, false, false, 1},
+		{"gray profile on gray output", "jpeg", gray, Metadata{ICC: iccProfile("GRAY")}, true, false, false, false, 0},
+		{"gray16 is RGB in jpeg", "jpeg", gray16, Metadata{ICC: iccProfile("GRAY")}, false, false, false, false, 1},
+		{"gray16 is gray in png", "png", gray16, Metadata{ICC: iccProfile("GRAY")}, true, false, false, false, 0},
+		{"unreadable profile kept", "jpeg", rgb, Metadata{ICC: []byte("icc")}, true, false, false, false, 0},
+		{"small EXIF kept", "jpeg", rgb, Metadata{EXIF: testEXIF(binary.LittleEndian)}, false, true, false, false, 0},
+		{"large EXIF trimmed", "jpeg", rgb, Metadata{EXIF: big}, false, true, false, false, 1},
+		{"large EXIF fits png", "png", rgb, Metadata{EXIF: big}, false, true, true, false, 0},
+		{"oversized credits dropped", "jpeg", rgb, Metadata{EXIF: huge}, false, false, false, false, 1},
+		{"large XMP dropped", "jpeg", rgb, Metadata{XMP: make([]byte, 70000)}, false, false, false, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.m
+			changes := m.Fit(tt.format, tt.img)
+			if len(changes) != tt.wantChanges {
+				t.Errorf("Fit() changes = %q, want %d", changes, tt.wantChanges)
+			}
+			if has := m.ICC != nil; has != tt.wantICC {
+				t.Errorf("ICC kept = %v, want %v", has, tt.wantICC)
+			}
+			if has := m.EXIF != nil; has != tt.wantEXIF {
+				t.Fatalf("EXIF kept = %v, want %v", has, tt.wantEXIF)
+			}
+			if m.EXIF != nil {
+				if has := m.EXIF.find(IFDExif, 0x9286) != nil; has != tt.wantComment {
+					t.Errorf("comment kept = %v, want %v", has, tt.wantComment)
+				}
+				if _, ok := m.EXIF.ASCII(IFD0, TagCopyright); !ok {
+					t.Error("copyright should be kept")
+				}
+			}
+			if has := m.XMP != nil; has != tt.wantXMP {
+				t.Errorf("XMP kept = %v, want %v", has, tt.wantXMP)
+			}
+			if _, err := Embed(encode(t, tt.format), tt.format, &m); err != nil {
+				t.Errorf("Embed() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{"", false},
+		{PolicyStrip, false},
+		{PolicyCopyright, false},
+		{PolicyAll, false},
+		{"some", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			err := ValidateOptions(job.Output{Metadata: tt.policy})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func FuzzExtract(f *testing.F) {
+	for _, format := range []string{"jpeg", "png"} {
+		data, err := Embed(encode(f, format), format, &Metadata{
+			EXIF: testEXIF(binary.LittleEndian), ICC: []byte("icc"), XMP: []byte("xmp"),
+		})
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, _ := Extract(data)
+		if m == nil {
+			t.Error("Extract() returned nil metadata")
+		}
+	})
+}
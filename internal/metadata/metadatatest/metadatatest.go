@@ -0,0 +1,103 @@
+// Package metadatatest builds EXIF blocks for tests outside the metadata
+// package.
+package metadatatest
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/mohammed-ysn/cluster-imager/internal/metadata"
+)
+
+// Tag is an EXIF tag with a string (ASCII) or uint16 (SHORT) value
+type Tag struct {
+	IFD   metadata.IFD
+	Tag   uint16
+	Value any
+}
+
+// subIFDTags are the IFD0 tags pointing to the EXIF and GPS sub-IFDs
+var subIFDTags = map[metadata.IFD]uint16{metadata.IFDExif: 0x8769, metadata.IFDGPS: 0x8825}
+
+type field struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte
+}
+
+// EXIF returns a parsed little-endian EXIF block holding tags
+func EXIF(t testing.TB, tags ...Tag) *metadata.EXIF {
+	t.Helper()
+	le := binary.LittleEndian
+
+	var ifds [3][]field
+	for _, tag := range tags {
+		switch v := tag.Value.(type) {
+		case string:
+			ifds[tag.IFD] = append(ifds[tag.IFD], field{tag.Tag, 2, uint32(len(v) + 1), append([]byte(v), 0)}) //nolint:gosec
+		case uint16:
+			ifds[tag.IFD] = append(ifds[tag.IFD], field{tag.Tag, 3, 1, le.AppendUint16(nil, v)})
+		default:
+			t.Fatalf("unsupported value %T for tag %#x", v, tag.Tag)
+		}
+	}
+
+	// IFD0 points to the sub-IFDs, which follow it in order
+	for _, ifd := range []metadata.IFD{metadata.IFDExif, metadata.IFDGPS} {
+		if len(ifds[ifd]) > 0 {
+			ifds[metadata.IFD0] = append(ifds[metadata.IFD0], field{subIFDTags[ifd], 4, 1, make([]byte, 4)})
+		}
+	}
+	off := 8 + size(ifds[metadata.IFD0])
+	for _, ifd := range []metadata.IFD{metadata.IFDExif, metadata.IFDGPS} {
+		if len(ifds[ifd]) > 0 {
+			i := slices.IndexFunc(ifds[metadata.IFD0], func(f field) bool { return f.tag == subIFDTags[ifd] })
+			le.PutUint32(ifds[metadata.IFD0][i].value, off)
+			off += size(ifds[ifd])
+		}
+	}
+
+	out := le.AppendUint32([]byte("II\x2a\x00"), 8)
+	for _, fields := range ifds {
+		if len(fields) == 0 {
+			continue
+		}
+		dataOff := uint32(len(out)) + 2 + 12*uint32(len(fields)) + 4 //nolint:gosec
+		var data []byte
+		out = le.AppendUint16(out, uint16(len(fields))) //nolint:gosec
+		for _, f := range fields {
+			out = le.AppendUint16(out, f.tag)
+			out = le.AppendUint16(out, f.typ)
+			out = le.AppendUint32(out, f.count)
+			if len(f.value) <= 4 {
+				out = append(out, append(slices.Clone(f.value), make([]byte, 4-len(f.value))...)...)
+				continue
+			}
+			out = le.AppendUint32(out, dataOff+uint32(len(data))) //nolint:gosec
+			data = append(data, f.value...)
+			if len(data)%2 == 1 {
+				data = append(data, 0)
+			}
+		}
+		out = le.AppendUint32(out, 0)
+		out = append(out, data...)
+	}
+
+	e, err := metadata.ParseEXIF(out)
+	if err != nil {
+		t.Fatalf("parse EXIF: %v", err)
+	}
+	return e
+}
+
+// size is the encoded size of an IFD including its out-of-line values
+func size(fields []field) uint32 {
+	n := 2 + 12*len(fields) + 4
+	for _, f := range fields {
+		if len(f.value) > 4 {
+			n += len(f.value) + len(f.value)%2
+		}
+	}
+	return uint32(n) //nolint:gosec
+}
@@ -0,0 +1,145 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"slices"
+)
+
+const (
+	// xmpKeyword identifies the iTXt chunk holding XMP
+	xmpKeyword = "XML:com.adobe.xmp"
+
+	// maxICCSize bounds a decompressed ICC profile from untrusted input
+	maxICCSize = 4 << 20
+
+	// ihdrEnd is the offset after the signature and IHDR chunk, which is
+	// always first
+	ihdrEnd = 8 + 12 + 13
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func extractPNG(data []byte) (*Metadata, error) {
+	m := &Metadata{}
+	for p := len(pngSignature); p+8 <= len(data); {
+		length := uint64(binary.BigEndian.Uint32(data[p:]))
+		typ := string(data[p+4 : p+8])
+		end := uint64(p) + 12 + length
+		if end > uint64(len(data)) {
+			return m, errors.New("png: truncated chunk")
+		}
+		body := data[p+8 : p+8+int(length)] //nolint:gosec
+		p = int(end)                        //nolint:gosec
+
+		switch typ {
+		case "eXIf":
+			e, err := ParseEXIF(body)
+			if err != nil {
+				return m, err
+			}
+			m.EXIF = e
+		case "iCCP":
+			icc, err := parseICCP(body)
+			if err != nil {
+				return m, err
+			}
+			m.ICC = icc
+		case "iTXt":
+			if xmp, ok := parseXMP(body); ok {
+				m.XMP = xmp
+			}
+		case "IDAT", "IEND": // metadata chunks come before image data
+			return m, nil
+		}
+	}
+	return m, nil
+}
+
+// parseICCP reads an iCCP chunk: profile name, NUL, compression method and
+// the zlib-compressed profile
+func parseICCP(body []byte) ([]byte, error) {
+	name, rest, ok := bytes.Cut(body, []byte{0})
+	if !ok || len(name) == 0 || len(rest) < 1 {
+		return nil, errors.New("png: malformed iCCP chunk")
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(rest[1:]))
+	if err != nil {
+		return nil, fmt.Errorf("png: failed to read ICC profile: %w", err)
+	}
+	defer zr.Close()
+
+	icc, err := io.ReadAll(io.LimitReader(zr, maxICCSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("png: failed to read ICC profile: %w", err)
+	}
+	if len(icc) > maxICCSize {
+		return nil, errors.New("png: ICC profile too large")
+	}
+	return icc, nil
+}
+
+// parseXMP reads XMP from an uncompressed iTXt chunk: keyword, NUL,
+// compression flag and method, language tag, NUL, translated keyword, NUL,
+// text
+func parseXMP(body []byte) ([]byte, bool) {
+	keyword, rest, ok := bytes.Cut(body, []byte{0})
+	if !ok || string(keyword) != xmpKeyword || len(rest) < 2 || rest[0] != 0 {
+		return nil, false
+	}
+	_, rest, ok = bytes.Cut(rest[2:], []byte{0})
+	if !ok {
+		return nil, false
+	}
+	_, text, ok := bytes.Cut(rest, []byte{0})
+	if !ok {
+		return nil, false
+	}
+	return bytes.Clone(text), true
+}
+
+// embedPNG inserts metadata chunks directly after IHDR, which puts them
+// before PLTE and IDAT as the PNG specification requires
+func embedPNG(data []byte, m *Metadata) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) || len(data) < ihdrEnd || string(data[12:16]) != "IHDR" {
+		return nil, errors.New("png: missing IHDR chunk")
+	}
+
+	var chunks []byte
+	if len(m.ICC) > 0 {
+		var buf bytes.Buffer
+		buf.WriteString("ICC Profile\x00\x00")
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(m.ICC); err != nil {
+			return nil, fmt.Errorf("png: failed to compress ICC profile: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("png: failed to compress ICC profile: %w", err)
+		}
+		chunks = appendChunk(chunks, "iCCP", buf.Bytes())
+	}
+	if m.EXIF != nil {
+		if exif := m.EXIF.Encode(); exif != nil {
+			chunks = appendChunk(chunks, "eXIf", exif)
+		}
+	}
+	if len(m.XMP) > 0 {
+		body := slices.Concat([]byte(xmpKeyword), []byte{0, 0, 0, 0, 0}, m.XMP)
+		chunks = appendChunk(chunks, "iTXt", body)
+	}
+
+	return slices.Concat(data[:ihdrEnd], chunks, data[ihdrEnd:]), nil
+}
+
+func appendChunk(out []byte, typ string, body []byte) []byte {
+	out = binary.BigEndian.AppendUint32(out, uint32(len(body))) //nolint:gosec
+	start := len(out)
+	out = append(out, typ...)
+	out = append(out, body...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out[start:]))
+}
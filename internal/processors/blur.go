@@ -0,0 +1,56 @@
+package processors
+
+import (
+	"context"
+	"image"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/validation"
+)
+
+// BlurProcessor applies a Gaussian blur of the given sigma (0.1-100), to the
+// whole image or to the region set by x, y, width and height
+type BlurProcessor struct{}
+
+func NewBlurProcessor() *BlurProcessor {
+	return &BlurProcessor{}
+}
+
+func (p *BlurProcessor) Process(_ context.Context, img image.Image, params map[string]interface{}) (image.Image, error) {
+	sigma, err := blurSigma(params)
+	if err != nil {
+		return nil, err
+	}
+	return applyToRegion(img, params, func(src *image.NRGBA) *image.NRGBA {
+		f := newFloatImage(src)
+		f.gaussianBlur(sigma)
+		return f.toNRGBA()
+	})
+}
+
+func (p *BlurProcessor) ValidateParams(params map[string]interface{}) error {
+	if _, err := blurSigma(params); err != nil {
+		return err
+	}
+	_, _, err := paramRegion(params)
+	return err
+}
+
+// ValidateDimensions checks that the region, if any, lies within the image
+func (p *BlurProcessor) ValidateDimensions(params map[string]interface{}, width, height int) error {
+	return validateRegion(params, width, height)
+}
+
+// WorkingMemory counts the floating-point copy of the blurred area
+func (p *BlurProcessor) WorkingMemory(params map[string]interface{}, width, height int) int64 {
+	return regionPixels(params, width, height) * floatBytesPerPixel
+}
+
+func (p *BlurProcessor) Name() string { return "blur" }
+
+func blurSigma(params map[string]interface{}) (float64, error) {
+	sigma, err := paramFloat(params, "sigma")
+	if err != nil {
+		return 0, err
+	}
+	return sigma, validation.ValidateRange(sigma, 0.1, 100, "sigma")
+}
@@ -0,0 +1,133 @@
+package processors
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// stripes returns a width x height image of alternating black and white
+// columns
+func stripes(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(0)
+			if x%2 == 0 {
+				v = 255
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	return img
+}
+
+func TestBlurProcessor_Name(t *testing.T) {
+	p := NewBlurProcessor()
+	if p.Name() != "blur" {
+		t.Errorf("Expected name 'blur', got '%s'", p.Name())
+	}
+}
+
+func TestBlurProcessor_ValidateParams(t *testing.T) {
+	p := NewBlurProcessor()
+
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		wantErr bool
+	}{
+		{"valid sigma", map[string]interface{}{"sigma": 2}, false},
+		{"with region", map[string]interface{}{"sigma": 2, "x": 0, "y": 0, "width": 10, "height": 10}, false},
+		{"missing sigma", map[string]interface{}{}, true},
+		{"sigma too large", map[string]interface{}{"sigma": 101}, true},
+		{"partial region", map[string]interface{}{"sigma": 2, "x": 0, "y": 0}, true},
+		{"negative region", map[string]interface{}{"sigma": 2, "x": -1, "y": 0, "width": 10, "height": 10}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.ValidateParams(tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBlurProcessor_ValidateDimensions(t *testing.T) {
+	p := NewBlurProcessor()
+
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		wantErr bool
+	}{
+		{"whole image", map[string]interface{}{"sigma": 2}, false},
+		{"region inside", map[string]interface{}{"sigma": 2, "x": 10, "y": 10, "width": 50, "height": 50}, false},
+		{"region outside", map[string]interface{}{"sigma": 2, "x": 60, "y": 0, "width": 50, "height": 50}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.ValidateDimensions(tt.params, 100, 80)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateDimensions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBlurProcessor_Process(t *testing.T) {
+	p := NewBlurProcessor()
+
+	// Both the exact kernel and the box approximation should average the
+	// stripes to mid-grey
+	for _, sigma := range []float64{2, 10} {
+		result, err := p.Process(context.Background(), stripes(60, 60), map[string]interface{}{"sigma": sigma})
+		if err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		got := color.NRGBAModel.Convert(result.At(30, 30)).(color.NRGBA)
+		if got.R < 120 || got.R > 135 || got.A != 255 {
+			t.Errorf("sigma %v: centre = %v, want mid-grey", sigma, got)
+		}
+	}
+}
+
+func TestBlurProcessor_Region(t *testing.T) {
+	p := NewBlurProcessor()
+	img := stripes(40, 40)
+
+	result, err := p.Process(context.Background(), img, map[string]interface{}{"sigma": 3, "x": 10, "y": 10, "width": 20, "height": 20})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := color.NRGBAModel.Convert(result.At(2, 2)); got != img.At(2, 2) {
+		t.Errorf("outside region changed: %v", got)
+	}
+	if got := color.NRGBAModel.Convert(result.At(20, 20)).(color.NRGBA); got.R == 0 || got.R == 255 {
+		t.Errorf("inside region not blurred: %v", got)
+	}
+
+	if _, err := p.Process(context.Background(), img, map[string]interface{}{"sigma": 3, "x": 30, "y": 0, "width": 20, "height": 20}); err == nil {
+		t.Error("expected error for region outside image")
+	}
+}
+
+func TestBoxSizes(t *testing.T) {
+	// Three boxes of widths w have variance sum((w*w-1)/12)
+	for _, sigma := range []float64{4, 10, 50} {
+		var variance float64
+		for _, w := range boxSizes(sigma, 3) {
+			if w%2 == 0 {
+				t.Errorf("sigma %v: even box width %d", sigma, w)
+			}
+			variance += float64(w*w-1) / 12
+		}
+		if diff := variance - sigma*sigma; diff > sigma || diff < -sigma {
+			t.Errorf("sigma %v: box variance %v, want about %v", sigma, variance, sigma*sigma)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/validation"
+)
+
+// Rec. 709 luma weights
+const (
+	lumaR = 0.2126
+	lumaG = 0.7152
+	lumaB = 0.0722
+)
+
+// colorParam describes a numeric parameter of a colour adjustment
+type colorParam struct {
+	key      string
+	min, max float64
+	def      float64
+	required bool
+}
+
+// colorFunc maps one pixel's colour channels, each in [0, 1]. Results are
+// clamped.
+type colorFunc func(r, g, b float64) (float64, float64, float64)
+
+// ColorProcessor applies a per-pixel colour adjustment. Alpha is unchanged.
+type ColorProcessor struct {
+	name   string
+	params []colorParam
+	adjust func(values map[string]float64) colorFunc
+}
+
+// NewGrayscaleProcessor converts to grayscale by luma. It takes no parameters.
+func NewGrayscaleProcessor() *ColorProcessor {
+	return &ColorProcessor{
+		name: "grayscale",
+		adjust: func(map[string]float64) colorFunc {
+			return func(r, g, b float64) (float64, float64, float64) {
+				y := lumaR*r + lumaG*g + lumaB*b
+				return y, y, y
+			}
+		},
+	}
+}
+
+// NewSepiaProcessor applies a sepia tone. amount (0-1, default 1) blends
+// between the original and full sepia.
+func NewSepiaProcessor() *ColorProcessor {
+	return &ColorProcessor{
+		name:   "sepia",
+		params: []colorParam{{key: "amount", min: 0, max: 1, def: 1}},
+		adjust: func(v map[string]float64) colorFunc {
+			amount := v["amount"]
+			return func(r, g, b float64) (float64, float64, float64) {
+				sr := 0.393*r + 0.769*g + 0.189*b
+				sg := 0.349*r + 0.686*g + 0.168*b
+				sb := 0.272*r + 0.534*g + 0.131*b
+				return mix(r, sr, amount), mix(g, sg, amount), mix(b, sb, amount)
+			}
+		},
+	}
+}
+
+// NewBrightnessProcessor adds amount (-1 to 1) to each channel
+func NewBrightnessProcessor() *ColorProcessor {
+	return &ColorProcessor{
+		name:   "brightness",
+		params: []colorParam{{key: "amount", min: -1, max: 1, required: true}},
+		adjust: func(v map[string]float64) colorFunc {
+			amount := v["amount"]
+			return func(r, g, b float64) (float64, float64, float64) {
+				return r + amount, g + amount, b + amount
+			}
+		},
+	}
+}
+
+// NewContrastProcessor scales each channel away from mid-grey by 1+amount.
+// amount is -1 (flat grey) to 1 (double contrast).
+func NewContrastProcessor() *ColorProcessor {
+	return &ColorProcessor{
+		name:   "contrast",
+		params: []colorParam{{key: "amount", min: -1, max: 1, required: true}},
+		adjust: func(v map[string]float64) colorFunc {
+			factor := 1 + v["amount"]
+			return func(r, g, b float64) (float64, float64, float64) {
+				return (r-0.5)*factor + 0.5, (g-0.5)*factor + 0.5, (b-0.5)*factor + 0.5
+			}
+		},
+	}
+}
+
+// NewSaturationProcessor scales colourfulness by 1+amount. amount is -1
+// (grayscale) to 1 (double saturation).
+func NewSaturationProcessor() *ColorProcessor {
+	return &ColorProcessor{
+		name:   "saturation",
+		params: []colorParam{{key: "amount", min: -1, max: 1, required: true}},
+		adjust: func(v map[string]float64) colorFunc {
+			factor := 1 + v["amount"]
+			return func(r, g, b float64) (float64, float64, float64) {
+				y := lumaR*r + lumaG*g + lumaB*b
+				return y + (r-y)*factor, y + (g-y)*factor, y + (b-y)*factor
+			}
+		},
+	}
+}
+
+// NewHueProcessor rotates hue by degrees (-360 to 360), keeping luma
+func NewHueProcessor() *ColorProcessor {
+	return &ColorProcessor{
+		name:   "hue",
+		params: []colorParam{{key: "degrees", min: -360, max: 360, required: true}},
+		adjust: func(v map[string]float64) colorFunc {
+			sin, cos := math.Sincos(v["degrees"] * math.Pi / 180)
+			m := [9]float64{
+				0.213 + cos*0.787 - sin*0.213, 0.715 - cos*0.715 - sin*0.715, 0.072 - cos*0.072 + sin*0.928,
+				0.213 - cos*0.213 + sin*0.143, 0.715 + cos*0.285 + sin*0.140, 0.072 - cos*0.072 - sin*0.283,
+				0.213 - cos*0.213 - sin*0.787, 0.715 - cos*0.715 + sin*0.715, 0.072 + cos*0.928 + sin*0.072,
+			}
+			return func(r, g, b float64) (float64, float64, float64) {
+				return m[0]*r + m[1]*g + m[2]*b, m[3]*r + m[4]*g + m[5]*b, m[6]*r + m[7]*g + m[8]*b
+			}
+		},
+	}
+}
+
+// NewGammaProcessor applies gamma correction. gamma (0.1-10) above 1
+// brightens midtones; below 1 darkens them.
+func NewGammaProcessor() *ColorProcessor {
+	return &ColorProcessor{
+		name:   "gamma",
+		params: []colorParam{{key: "gamma", min: 0.1, max: 10, required: true}},
+		adjust: func(v map[string]float64) colorFunc {
+			exp := 1 / v["gamma"]
+			return func(r, g, b float64) (float64, float64, float64) {
+				return math.Pow(r, exp), math.Pow(g, exp), math.Pow(b, exp)
+			}
+		},
+	}
+}
+
+// NewInvertProcessor inverts each channel. It takes no parameters.
+func NewInvertProcessor() *ColorProcessor {
+	return &ColorProcessor{
+		name: "invert",
+		adjust: func(map[string]float64) colorFunc {
+			return func(r, g, b float64) (float64, float64, float64) {
+				return 1 - r, 1 - g, 1 - b
+			}
+		},
+	}
+}
+
+func (p *ColorProcessor) Process(_ context.Context, img image.Image, params map[string]interface{}) (image.Image, error) {
+	values, err := p.values(params)
+	if err != nil {
+		return nil, err
+	}
+	f := p.adjust(values)
+
+	out := toNRGBA(img)
+	for i := 0; i < len(out.Pix); i += 4 {
+		px := out.Pix[i : i+3 : i+3]
+		r, g, b := f(float64(px[0])/255, float64(px[1])/255, float64(px[2])/255)
+		px[0], px[1], px[2] = toUint8(r), toUint8(g), toUint8(b)
+	}
+	return out, nil
+}
+
+func (p *ColorProcessor) ValidateParams(params map[string]interface{}) error {
+	_, err := p.values(params)
+	return err
+}
+
+func (p *ColorProcessor) Name() string { return p.name }
+
+// values reads and range checks the processor's parameters
+func (p *ColorProcessor) values(params map[string]interface{}) (map[string]float64, error) {
+	values := make(map[string]float64, len(p.params))
+	for _, spec := range p.params {
+		if _, ok := params[spec.key]; !ok && spec.required {
+			return nil, fmt.Errorf("%s parameter is required", spec.key)
+		}
+		v, err := paramFloatOr(params, spec.key, spec.def)
+		if err != nil {
+			return nil, err
+		}
+		if err := validation.ValidateRange(v, spec.min, spec.max, spec.key); err != nil {
+			return nil, err
+		}
+		values[spec.key] = v
+	}
+	return values, nil
+}
+
+func mix(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
+
+// toUint8 converts a [0, 1] channel value to 8 bits, clamping
+func toUint8(v float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+}
+
+// toNRGBA returns a copy of img as NRGBA, with its origin at (0, 0)
+func toNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), img, b.Min, draw.Src)
+	return out
+}
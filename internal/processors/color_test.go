@@ -0,0 +1,121 @@
+package processors
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestColorProcessors_Name(t *testing.T) {
+	tests := []struct {
+		p    *ColorProcessor
+		want string
+	}{
+		{NewGrayscaleProcessor(), "grayscale"},
+		{NewSepiaProcessor(), "sepia"},
+		{NewBrightnessProcessor(), "brightness"},
+		{NewContrastProcessor(), "contrast"},
+		{NewSaturationProcessor(), "saturation"},
+		{NewHueProcessor(), "hue"},
+		{NewGammaProcessor(), "gamma"},
+		{NewInvertProcessor(), "invert"},
+	}
+
+	for _, tt := range tests {
+		if tt.p.Name() != tt.want {
+			t.Errorf("Expected name '%s', got '%s'", tt.want, tt.p.Name())
+		}
+	}
+}
+
+func TestColorProcessors_ValidateParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       *ColorProcessor
+		params  map[string]interface{}
+		wantErr bool
+	}{
+		{"grayscale", NewGrayscaleProcessor(), map[string]interface{}{}, false},
+		{"sepia default amount", NewSepiaProcessor(), map[string]interface{}{}, false},
+		{"sepia amount too large", NewSepiaProcessor(), map[string]interface{}{"amount": 1.5}, true},
+		{"brightness", NewBrightnessProcessor(), map[string]interface{}{"amount": -0.2}, false},
+		{"brightness missing amount", NewBrightnessProcessor(), map[string]interface{}{}, true},
+		{"brightness wrong type", NewBrightnessProcessor(), map[string]interface{}{"amount": "0.2"}, true},
+		{"contrast out of range", NewContrastProcessor(), map[string]interface{}{"amount": -2}, true},
+		{"saturation", NewSaturationProcessor(), map[string]interface{}{"amount": 1}, false},
+		{"hue", NewHueProcessor(), map[string]interface{}{"degrees": 180}, false},
+		{"hue out of range", NewHueProcessor(), map[string]interface{}{"degrees": 400}, true},
+		{"gamma", NewGammaProcessor(), map[string]interface{}{"gamma": 2.2}, false},
+		{"gamma zero", NewGammaProcessor(), map[string]interface{}{"gamma": 0}, true},
+		{"invert", NewInvertProcessor(), map[string]interface{}{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.ValidateParams(tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestColorProcessors_Process(t *testing.T) {
+	src := color.NRGBA{R: 200, G: 100, B: 50, A: 128}
+
+	tests := []struct {
+		name   string
+		p      *ColorProcessor
+		params map[string]interface{}
+		want   color.NRGBA
+	}{
+		{"grayscale", NewGrayscaleProcessor(), nil, color.NRGBA{R: 118, G: 118, B: 118, A: 128}},
+		{"sepia", NewSepiaProcessor(), nil, color.NRGBA{R: 165, G: 147, B: 114, A: 128}},
+		{"sepia none", NewSepiaProcessor(), map[string]interface{}{"amount": 0}, src},
+		{"brightness", NewBrightnessProcessor(), map[string]interface{}{"amount": 0.2}, color.NRGBA{R: 251, G: 151, B: 101, A: 128}},
+		{"brightness clamps", NewBrightnessProcessor(), map[string]interface{}{"amount": 1}, color.NRGBA{R: 255, G: 255, B: 255, A: 128}},
+		{"contrast flat", NewContrastProcessor(), map[string]interface{}{"amount": -1}, color.NRGBA{R: 128, G: 128, B: 128, A: 128}},
+		{"contrast none", NewContrastProcessor(), map[string]interface{}{"amount": 0}, src},
+		{"saturation none", NewSaturationProcessor(), map[string]interface{}{"amount": -1}, color.NRGBA{R: 118, G: 118, B: 118, A: 128}},
+		{"hue full turn", NewHueProcessor(), map[string]interface{}{"degrees": 360}, src},
+		{"gamma identity", NewGammaProcessor(), map[string]interface{}{"gamma": 1}, src},
+		{"invert", NewInvertProcessor(), nil, color.NRGBA{R: 55, G: 155, B: 205, A: 128}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(5, 5, 7, 7))
+			for y := 5; y < 7; y++ {
+				for x := 5; x < 7; x++ {
+					img.SetNRGBA(x, y, src)
+				}
+			}
+
+			result, err := tt.p.Process(context.Background(), img, tt.params)
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			if result.Bounds() != image.Rect(0, 0, 2, 2) {
+				t.Errorf("bounds = %v", result.Bounds())
+			}
+			if got := color.NRGBAModel.Convert(result.At(1, 1)).(color.NRGBA); got != tt.want {
+				t.Errorf("pixel = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHueProcessor_Rotates(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 255})
+
+	result, err := NewHueProcessor().Process(context.Background(), img, map[string]interface{}{"degrees": 120})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	got := color.NRGBAModel.Convert(result.At(0, 0)).(color.NRGBA)
+	if got.G <= got.R || got.G <= got.B {
+		t.Errorf("expected red rotated towards green, got %v", got)
+	}
+}
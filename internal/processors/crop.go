@@ -1,6 +1,7 @@
 package processors
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"image/draw"
@@ -14,7 +15,7 @@ func NewCropProcessor() *CropProcessor {
 	return &CropProcessor{}
 }
 
-func (p *CropProcessor) Process(img image.Image, params map[string]interface{}) (image.Image, error) {
+func (p *CropProcessor) Process(_ context.Context, img image.Image, params map[string]interface{}) (image.Image, error) {
 	x, err := paramInt(params, "x")
 	if err != nil {
 		return nil, err
@@ -68,4 +69,38 @@ func (p *CropProcessor) ValidateParams(params map[string]interface{}) error {
 	return validation.ValidateDimension(height, "height")
 }
 
+// ValidateDimensions checks that the crop area lies within a width x height image
+func (p *CropProcessor) ValidateDimensions(params map[string]interface{}, width, height int) error {
+	x, err := paramInt(params, "x")
+	if err != nil {
+		return err
+	}
+	y, err := paramInt(params, "y")
+	if err != nil {
+		return err
+	}
+	cropWidth, err := paramInt(params, "width")
+	if err != nil {
+		return err
+	}
+	cropHeight, err := paramInt(params, "height")
+	if err != nil {
+		return err
+	}
+	return validation.ValidateCropParams(x, y, cropWidth, cropHeight, width, height)
+}
+
+// OutputSize returns the size of the crop area
+func (p *CropProcessor) OutputSize(params map[string]interface{}, _, _ int) (int, int, error) {
+	width, err := paramInt(params, "width")
+	if err != nil {
+		return 0, 0, err
+	}
+	height, err := paramInt(params, "height")
+	if err != nil {
+		return 0, 0, err
+	}
+	return width, height, nil
+}
+
 func (p *CropProcessor) Name() string { return "crop" }
@@ -1,6 +1,7 @@
 package processors
 
 import (
+	"context"
 	"image"
 	"testing"
 )
@@ -91,6 +92,32 @@ func TestCropProcessor_ValidateParams(t *testing.T) {
 	}
 }
 
+func TestCropProcessor_ValidateDimensions(t *testing.T) {
+	p := NewCropProcessor()
+
+	tests := []struct {
+		name          string
+		x, y          int
+		width, height int
+		wantErr       bool
+	}{
+		{"inside image", 10, 10, 50, 50, false},
+		{"full image", 0, 0, 100, 80, false},
+		{"exceeds width", 60, 0, 50, 50, true},
+		{"exceeds height", 0, 40, 50, 50, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := map[string]interface{}{"x": tt.x, "y": tt.y, "width": tt.width, "height": tt.height}
+			err := p.ValidateDimensions(params, 100, 80)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateDimensions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestCropProcessor_Process(t *testing.T) {
 	p := NewCropProcessor()
 
@@ -136,7 +163,7 @@ func TestCropProcessor_Process(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := p.Process(img, tt.params)
+			result, err := p.Process(context.Background(), img, tt.params)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Process() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -0,0 +1,265 @@
+package processors
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"slices"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/validation"
+)
+
+// boxBlurSigma is the sigma from which Gaussian blur is approximated by
+// three box blurs, whose cost does not grow with the radius
+const boxBlurSigma = 4
+
+// floatBytesPerPixel is the size of one floatImage pixel
+const floatBytesPerPixel = 16
+
+// floatImage holds premultiplied RGBA in [0, 1], four values per pixel, so
+// that filters weight colour by coverage. float32 keeps it at four times the
+// size of the 8-bit image while leaving ample precision for 8-bit output.
+type floatImage struct {
+	w, h int
+	pix  []float32
+}
+
+func newFloatImage(img *image.NRGBA) *floatImage {
+	b := img.Bounds()
+	f := &floatImage{w: b.Dx(), h: b.Dy(), pix: make([]float32, 4*b.Dx()*b.Dy())}
+	for y := 0; y < f.h; y++ {
+		for x := 0; x < f.w; x++ {
+			src := img.Pix[img.PixOffset(b.Min.X+x, b.Min.Y+y):]
+			dst := f.pix[4*(y*f.w+x):]
+			a := float32(src[3]) / 255
+			dst[0] = float32(src[0]) / 255 * a
+			dst[1] = float32(src[1]) / 255 * a
+			dst[2] = float32(src[2]) / 255 * a
+			dst[3] = a
+		}
+	}
+	return f
+}
+
+// clone returns a copy
+func (f *floatImage) clone() *floatImage {
+	return &floatImage{w: f.w, h: f.h, pix: slices.Clone(f.pix)}
+}
+
+// toNRGBA converts back to 8-bit non-premultiplied colour, clamping
+func (f *floatImage) toNRGBA() *image.NRGBA {
+	out := image.NewNRGBA(image.Rect(0, 0, f.w, f.h))
+	for i := 0; i < len(f.pix); i += 4 {
+		a := float64(max(0, min(1, f.pix[i+3])))
+		if a == 0 {
+			continue
+		}
+		out.Pix[i] = toUint8(float64(f.pix[i]) / a)
+		out.Pix[i+1] = toUint8(float64(f.pix[i+1]) / a)
+		out.Pix[i+2] = toUint8(float64(f.pix[i+2]) / a)
+		out.Pix[i+3] = toUint8(a)
+	}
+	return out
+}
+
+// gaussianBlur blurs f in place. Edges are extended.
+func (f *floatImage) gaussianBlur(sigma float64) {
+	if sigma >= boxBlurSigma {
+		for _, size := range boxSizes(sigma, 3) {
+			f.boxBlur(size / 2)
+		}
+		return
+	}
+
+	radius := int(math.Ceil(3 * sigma))
+	kernel := make([]float64, 2*radius+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	f.convolve(kernel, true)
+	f.convolve(kernel, false)
+}
+
+// lines calls fn for each row (horizontal) or column of f with a copy of
+// the line's pixels and the index of each of its pixels in f.pix, so that a
+// pass can write its result in place while reading the original values
+func (f *floatImage) lines(horizontal bool, fn func(line []float32, index func(i int) int)) {
+	lines, length := f.h, f.w
+	if !horizontal {
+		lines, length = f.w, f.h
+	}
+	buf := make([]float32, 4*length)
+	for l := 0; l < lines; l++ {
+		index := func(i int) int {
+			if horizontal {
+				return 4 * (l*f.w + i)
+			}
+			return 4 * (i*f.w + l)
+		}
+		for i := 0; i < length; i++ {
+			copy(buf[4*i:4*i+4], f.pix[index(i):])
+		}
+		fn(buf, index)
+	}
+}
+
+// convolve applies a 1D kernel along rows (horizontal) or columns, in place
+func (f *floatImage) convolve(kernel []float64, horizontal bool) {
+	radius := len(kernel) / 2
+	f.lines(horizontal, func(line []float32, index func(int) int) {
+		length := len(line) / 4
+		for i := 0; i < length; i++ {
+			var acc [4]float64
+			for k, weight := range kernel {
+				src := line[4*clampInt(i+k-radius, 0, length-1):]
+				for c := range acc {
+					acc[c] += float64(src[c]) * weight
+				}
+			}
+			dst := f.pix[index(i):]
+			for c := range acc {
+				dst[c] = float32(acc[c])
+			}
+		}
+	})
+}
+
+// boxBlur averages over a (2*radius+1) square using running sums, in place
+func (f *floatImage) boxBlur(radius int) {
+	if radius < 1 {
+		return
+	}
+	f.boxPass(radius, true)
+	f.boxPass(radius, false)
+}
+
+func (f *floatImage) boxPass(radius int, horizontal bool) {
+	scale := 1 / float64(2*radius+1)
+	f.lines(horizontal, func(line []float32, index func(int) int) {
+		length := len(line) / 4
+		at := func(i int) []float32 { return line[4*clampInt(i, 0, length-1):] }
+
+		var acc [4]float64
+		for i := -radius; i <= radius; i++ {
+			for c, v := range at(i)[:4] {
+				acc[c] += float64(v)
+			}
+		}
+		for i := 0; i < length; i++ {
+			dst := f.pix[index(i):]
+			for c := range acc {
+				dst[c] = float32(acc[c] * scale)
+			}
+			add, remove := at(i+radius+1), at(i-radius)
+			for c := range acc {
+				acc[c] += float64(add[c]) - float64(remove[c])
+			}
+		}
+	})
+}
+
+// boxSizes returns n odd box widths whose successive application
+// approximates a Gaussian of the given sigma
+func boxSizes(sigma float64, n int) []int {
+	ideal := math.Sqrt(12*sigma*sigma/float64(n) + 1)
+	lower := int(math.Floor(ideal))
+	if lower%2 == 0 {
+		lower--
+	}
+	upper := lower + 2
+	m := int(math.Round((12*sigma*sigma - float64(n*lower*lower+4*n*lower+3*n)) / float64(-4*lower-4)))
+
+	sizes := make([]int, n)
+	for i := range sizes {
+		if i < m {
+			sizes[i] = lower
+		} else {
+			sizes[i] = upper
+		}
+	}
+	return sizes
+}
+
+func clampInt(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+// paramRegion reads the optional x, y, width and height params that limit a
+// filter to part of the image. They must be given together.
+func paramRegion(params map[string]interface{}) (image.Rectangle, bool, error) {
+	keys := []string{"x", "y", "width", "height"}
+	present := 0
+	for _, key := range keys {
+		if _, ok := params[key]; ok {
+			present++
+		}
+	}
+	if present == 0 {
+		return image.Rectangle{}, false, nil
+	}
+
+	var v [4]int
+	for i, key := range keys {
+		n, err := paramInt(params, key)
+		if err != nil {
+			return image.Rectangle{}, false, err
+		}
+		v[i] = n
+	}
+	if v[0] < 0 || v[1] < 0 {
+		return image.Rectangle{}, false, fmt.Errorf("coordinates cannot be negative")
+	}
+	if err := validation.ValidateDimension(v[2], "width"); err != nil {
+		return image.Rectangle{}, false, err
+	}
+	if err := validation.ValidateDimension(v[3], "height"); err != nil {
+		return image.Rectangle{}, false, err
+	}
+	return image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]), true, nil
+}
+
+// validateRegion checks that an optional region lies within a width x height
+// image
+func validateRegion(params map[string]interface{}, width, height int) error {
+	region, ok, err := paramRegion(params)
+	if err != nil || !ok {
+		return err
+	}
+	return validation.ValidateCropParams(region.Min.X, region.Min.Y, region.Dx(), region.Dy(), width, height)
+}
+
+// regionPixels returns the number of pixels a filter limited by the optional
+// region in params works on in a width x height image
+func regionPixels(params map[string]interface{}, width, height int) int64 {
+	if region, ok, err := paramRegion(params); err == nil && ok {
+		return int64(region.Dx()) * int64(region.Dy())
+	}
+	return int64(width) * int64(height)
+}
+
+// applyToRegion runs filter over the region of img given in params, or the
+// whole image, leaving the rest unchanged
+func applyToRegion(img image.Image, params map[string]interface{}, filter func(*image.NRGBA) *image.NRGBA) (image.Image, error) {
+	out := toNRGBA(img)
+	region, ok, err := paramRegion(params)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return filter(out), nil
+	}
+	if err := validateRegion(params, out.Bounds().Dx(), out.Bounds().Dy()); err != nil {
+		return nil, err
+	}
+
+	filtered := filter(out.SubImage(region).(*image.NRGBA))
+	draw.Draw(out, region, filtered, image.Point{}, draw.Src)
+	return out, nil
+}
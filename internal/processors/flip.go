@@ -0,0 +1,42 @@
+package processors
+
+import (
+	"context"
+	"image"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/validation"
+)
+
+// FlipProcessor mirrors an image horizontally (left to right) or vertically
+// (top to bottom)
+type FlipProcessor struct{}
+
+func NewFlipProcessor() *FlipProcessor {
+	return &FlipProcessor{}
+}
+
+func (p *FlipProcessor) Process(_ context.Context, img image.Image, params map[string]interface{}) (image.Image, error) {
+	direction, err := flipDirection(params)
+	if err != nil {
+		return nil, err
+	}
+	if direction == "vertical" {
+		return flipVertical(img), nil
+	}
+	return flipHorizontal(img), nil
+}
+
+func (p *FlipProcessor) ValidateParams(params map[string]interface{}) error {
+	_, err := flipDirection(params)
+	return err
+}
+
+func (p *FlipProcessor) Name() string { return "flip" }
+
+func flipDirection(params map[string]interface{}) (string, error) {
+	direction, err := paramString(params, "direction", "")
+	if err != nil {
+		return "", err
+	}
+	return direction, validation.ValidateFlipParams(direction)
+}
@@ -0,0 +1,75 @@
+package processors
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFlipProcessor_Name(t *testing.T) {
+	p := NewFlipProcessor()
+	if p.Name() != "flip" {
+		t.Errorf("Expected name 'flip', got '%s'", p.Name())
+	}
+}
+
+func TestFlipProcessor_ValidateParams(t *testing.T) {
+	p := NewFlipProcessor()
+
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		wantErr bool
+	}{
+		{"horizontal", map[string]interface{}{"direction": "horizontal"}, false},
+		{"vertical", map[string]interface{}{"direction": "vertical"}, false},
+		{"missing direction", map[string]interface{}{}, true},
+		{"unknown direction", map[string]interface{}{"direction": "diagonal"}, true},
+		{"wrong type for direction", map[string]interface{}{"direction": 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.ValidateParams(tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFlipProcessor_Process(t *testing.T) {
+	p := NewFlipProcessor()
+
+	marked := color.NRGBA{R: 255, A: 255}
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	img.SetNRGBA(0, 0, marked)
+
+	tests := []struct {
+		direction    string
+		markX, markY int
+	}{
+		{"horizontal", 3, 0},
+		{"vertical", 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.direction, func(t *testing.T) {
+			result, err := p.Process(context.Background(), img, map[string]interface{}{"direction": tt.direction})
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			if result.Bounds().Dx() != 4 || result.Bounds().Dy() != 2 {
+				t.Errorf("Process() changed dimensions to %v", result.Bounds())
+			}
+			if c := color.NRGBAModel.Convert(result.At(tt.markX, tt.markY)); c != marked {
+				t.Errorf("pixel (%d,%d) = %v, want marked", tt.markX, tt.markY, c)
+			}
+		})
+	}
+
+	if _, err := p.Process(context.Background(), img, map[string]interface{}{}); err == nil {
+		t.Error("expected error for missing direction")
+	}
+}
@@ -0,0 +1,81 @@
+package processors
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync"
+)
+
+// srgbToLinear maps 16-bit sRGB values to 16-bit linear light
+var srgbToLinear = sync.OnceValue(func() []uint16 {
+	lut := make([]uint16, 1<<16)
+	for i := range lut {
+		v := float64(i) / 0xffff
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		lut[i] = uint16(math.Round(v * 0xffff))
+	}
+	return lut
+})
+
+// linearToSRGB maps 16-bit linear light values to 8-bit sRGB
+var linearToSRGB = sync.OnceValue(func() []uint8 {
+	lut := make([]uint8, 1<<16)
+	for i := range lut {
+		v := float64(i) / 0xffff
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		lut[i] = uint8(math.Round(v * 0xff))
+	}
+	return lut
+})
+
+// linearize converts img to premultiplied 16-bit linear light, so that
+// resampling averages light intensity rather than encoded sRGB values
+func linearize(img image.Image) *image.RGBA64 {
+	lut := srgbToLinear()
+	b := img.Bounds()
+	out := image.NewRGBA64(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			a := uint32(c.A)
+			out.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(uint32(lut[c.R]) * a / 0xffff), //nolint:gosec
+				G: uint16(uint32(lut[c.G]) * a / 0xffff), //nolint:gosec
+				B: uint16(uint32(lut[c.B]) * a / 0xffff), //nolint:gosec
+				A: c.A,
+			})
+		}
+	}
+	return out
+}
+
+// delinearize converts a premultiplied linear light image back to 8-bit sRGB
+func delinearize(img image.Image) *image.NRGBA {
+	lut := linearToSRGB()
+	b := img.Bounds()
+	out := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			if a == 0 {
+				continue
+			}
+			out.SetNRGBA(x, y, color.NRGBA{
+				R: lut[min(r*0xffff/a, 0xffff)],
+				G: lut[min(g*0xffff/a, 0xffff)],
+				B: lut[min(bl*0xffff/a, 0xffff)],
+				A: uint8(a >> 8), //nolint:gosec
+			})
+		}
+	}
+	return out
+}
@@ -0,0 +1,74 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+	"github.com/mohammed-ysn/cluster-imager/pkg/storage"
+)
+
+// objectTimeout bounds fetching an object a processor references
+const objectTimeout = 30 * time.Second
+
+// Prefixes of the objects processors may reference. Keys elsewhere, such as
+// other jobs' inputs and results, are rejected.
+const (
+	OverlayPrefix = "overlays/"
+	FontPrefix    = "fonts/"
+)
+
+// Referencer is implemented by processors whose params name other stored
+// objects, so that submissions can be rejected when one is missing.
+type Referencer interface {
+	References(params map[string]interface{}) []string
+}
+
+// validateObjectKey checks that key is a valid key under prefix
+func validateObjectKey(key, prefix string) error {
+	if err := storage.ValidateKey(key); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(key, prefix) {
+		return fmt.Errorf("%q is not under %q", key, prefix)
+	}
+	return nil
+}
+
+// downloadObject reads a referenced object of at most limit bytes, giving up
+// when ctx is done or after objectTimeout. what names it in errors.
+func downloadObject(ctx context.Context, stor storage.Storage, key, what string, limit int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, objectTimeout)
+	defer cancel()
+
+	rc, err := stor.Download(ctx, key)
+	if err != nil {
+		return nil, objectError(fmt.Errorf("download %s: %w", what, err))
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, job.Transient(job.CodeStorageUnavailable, fmt.Errorf("read %s: %w", what, err))
+	}
+	if int64(len(data)) > limit {
+		return nil, job.Permanent(job.CodeInvalidParameters, fmt.Errorf("%s exceeds %d bytes", what, limit))
+	}
+	return data, nil
+}
+
+// objectError classifies a storage error for a referenced object. A missing
+// object or invalid key fails permanently; a storage outage may be retried.
+func objectError(err error) error {
+	if errors.Is(err, storage.ErrNotFound) {
+		return job.Permanent(job.CodeInputNotFound, err)
+	}
+	if errors.Is(err, storage.ErrInvalidKey) {
+		return job.Permanent(job.CodeInvalidParameters, err)
+	}
+	return job.Transient(job.CodeStorageUnavailable, err)
+}
@@ -0,0 +1,98 @@
+package processors
+
+import (
+	"image"
+	"image/color"
+)
+
+// Orient transforms img so that it is upright, given its EXIF orientation
+// (1-8). Orientation 1 and unknown values return img unchanged.
+func Orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return flipHorizontal(img)
+	case 3:
+		return rotate180(img)
+	case 4:
+		return flipVertical(img)
+	case 5:
+		return transpose(img)
+	case 6:
+		return rotate90(img)
+	case 7:
+		return transverse(img)
+	case 8:
+		return rotate270(img)
+	}
+	return img
+}
+
+// OrientedSize returns the size of a width x height image after Orient
+func OrientedSize(width, height, orientation int) (int, int) {
+	if orientation >= 5 && orientation <= 8 {
+		return height, width
+	}
+	return width, height
+}
+
+// OrientMemory returns the bytes Orient allocates for a width x height
+// upright image: a copy, unless the orientation leaves it unchanged
+func OrientMemory(width, height, orientation int) int64 {
+	if orientation < 2 || orientation > 8 {
+		return 0
+	}
+	return imageBytes(width, height)
+}
+
+func flipHorizontal(img image.Image) image.Image {
+	return remap(img, false, func(x, y, w, h int) (int, int) { return w - 1 - x, y })
+}
+
+func flipVertical(img image.Image) image.Image {
+	return remap(img, false, func(x, y, w, h int) (int, int) { return x, h - 1 - y })
+}
+
+func rotate180(img image.Image) image.Image {
+	return remap(img, false, func(x, y, w, h int) (int, int) { return w - 1 - x, h - 1 - y })
+}
+
+// rotate90 rotates clockwise
+func rotate90(img image.Image) image.Image {
+	return remap(img, true, func(x, y, w, h int) (int, int) { return h - 1 - y, x })
+}
+
+// rotate270 rotates anticlockwise
+func rotate270(img image.Image) image.Image {
+	return remap(img, true, func(x, y, w, h int) (int, int) { return y, w - 1 - x })
+}
+
+// transpose mirrors across the top-left to bottom-right diagonal
+func transpose(img image.Image) image.Image {
+	return remap(img, true, func(x, y, w, h int) (int, int) { return y, x })
+}
+
+// transverse mirrors across the top-right to bottom-left diagonal
+func transverse(img image.Image) image.Image {
+	return remap(img, true, func(x, y, w, h int) (int, int) { return h - 1 - y, w - 1 - x })
+}
+
+// remap copies each pixel of img to the position given by dst, which maps
+// source coordinates relative to the image origin. swap exchanges the output
+// width and height.
+func remap(img image.Image, swap bool, dst func(x, y, w, h int) (int, int)) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if swap {
+		w, h = h, w
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+			dx, dy := dst(x, y, b.Dx(), b.Dy())
+			out.SetNRGBA(dx, dy, c)
+		}
+	}
+	return out
+}
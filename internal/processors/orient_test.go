@@ -0,0 +1,60 @@
+package processors
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOrient(t *testing.T) {
+	// 3x2 image with a marked top-left pixel
+	marked := color.NRGBA{R: 255, A: 255}
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.SetNRGBA(0, 0, marked)
+
+	tests := []struct {
+		orientation   int
+		width, height int
+		markX, markY  int // where the marked pixel ends up
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+		{9, 3, 2, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("orientation %d", tt.orientation), func(t *testing.T) {
+			got := Orient(img, tt.orientation)
+			b := got.Bounds()
+			if b.Dx() != tt.width || b.Dy() != tt.height {
+				t.Fatalf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.width, tt.height)
+			}
+			if w, h := OrientedSize(3, 2, tt.orientation); w != tt.width || h != tt.height {
+				t.Errorf("OrientedSize() = %dx%d, want %dx%d", w, h, tt.width, tt.height)
+			}
+			if c := color.NRGBAModel.Convert(got.At(tt.markX, tt.markY)); c != marked {
+				t.Errorf("pixel (%d,%d) = %v, want marked", tt.markX, tt.markY, c)
+			}
+		})
+	}
+}
+
+func TestOrient_OffsetBounds(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(10, 20, 13, 22))
+	img.SetNRGBA(10, 20, color.NRGBA{G: 255, A: 255})
+
+	got := Orient(img, 6)
+	if got.Bounds() != image.Rect(0, 0, 2, 3) {
+		t.Fatalf("bounds = %v", got.Bounds())
+	}
+	if c := color.NRGBAModel.Convert(got.At(1, 0)).(color.NRGBA); c.G != 255 {
+		t.Errorf("expected marked pixel at top right, got %v", c)
+	}
+}
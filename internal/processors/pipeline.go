@@ -0,0 +1,208 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+// MaxPipelineSteps bounds the number of steps in a pipeline job
+const MaxPipelineSteps = 16
+
+// Step is one operation of a pipeline: a registered processor and its params
+type Step struct {
+	Processor string                 `json:"processor"`
+	Params    map[string]interface{} `json:"params"`
+}
+
+// PipelineProcessor runs an ordered list of steps, each through the processor
+// registered under its name. Its params are {"steps": [{"processor", "params"}, ...]}.
+type PipelineProcessor struct {
+	registry *Registry
+}
+
+func NewPipelineProcessor(registry *Registry) *PipelineProcessor {
+	return &PipelineProcessor{registry: registry}
+}
+
+func (p *PipelineProcessor) Process(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, error) {
+	steps, err := PipelineSteps(params)
+	if err != nil {
+		return nil, err
+	}
+	return RunSteps(ctx, p.registry, img, steps, nil)
+}
+
+// RunSteps applies steps in order, each through the processor registered
+// under its name, stopping early once ctx is done. If observe is not nil, it is called after each step with
+// the step's output and how long it took.
+func RunSteps(ctx context.Context, registry *Registry, img image.Image, steps []Step, observe func(step Step, out image.Image, elapsed time.Duration)) (image.Image, error) {
+	for i, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return nil, job.Transient(job.CodeInternal, err)
+		}
+		proc, err := registry.Get(step.Processor)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+
+		start := time.Now()
+		if img, err = proc.Process(ctx, img, step.Params); err != nil {
+			if len(steps) > 1 {
+				err = fmt.Errorf("step %d (%s): %w", i+1, step.Processor, err)
+			}
+			return nil, err
+		}
+		if observe != nil {
+			observe(step, img, time.Since(start))
+		}
+	}
+	return img, nil
+}
+
+// ValidateParams validates each step with its own processor
+func (p *PipelineProcessor) ValidateParams(params map[string]interface{}) error {
+	steps, err := PipelineSteps(params)
+	if err != nil {
+		return err
+	}
+
+	for i, step := range steps {
+		if step.Processor == p.Name() {
+			return fmt.Errorf("step %d: pipelines cannot be nested", i+1)
+		}
+		proc, err := p.registry.Get(step.Processor)
+		if err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+		if err := proc.ValidateParams(step.Params); err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, step.Processor, err)
+		}
+	}
+	return nil
+}
+
+// ValidateDimensions checks each step against the size of its input: the
+// width x height image for the first step, then the output of the step before.
+func (p *PipelineProcessor) ValidateDimensions(params map[string]interface{}, width, height int) error {
+	_, _, err := p.walkSizes(params, width, height, func(proc Processor, params map[string]interface{}, width, height int) error {
+		if v, ok := proc.(DimensionValidator); ok {
+			return v.ValidateDimensions(params, width, height)
+		}
+		return nil
+	})
+	return err
+}
+
+// OutputSize returns the size of the final step's output
+func (p *PipelineProcessor) OutputSize(params map[string]interface{}, width, height int) (int, int, error) {
+	return p.walkSizes(params, width, height, nil)
+}
+
+// WorkingMemory returns the most any one step needs beyond the pipeline's
+// output. A step holds its input, the output of the step before, while it
+// allocates its own output and buffers; both are released before the next
+// runs.
+func (p *PipelineProcessor) WorkingMemory(params map[string]interface{}, width, height int) int64 {
+	// Invalid steps are rejected by ValidateParams; they need nothing here
+	var most int64
+	first := true
+	outW, outH, err := p.walkSizes(params, width, height, func(proc Processor, params map[string]interface{}, width, height int) error {
+		n := Memory(proc, params, width, height)
+		if !first {
+			n += imageBytes(width, height)
+		}
+		first = false
+		most = max(most, n)
+		return nil
+	})
+	if err != nil {
+		return most
+	}
+	return max(0, most-imageBytes(outW, outH))
+}
+
+// walkSizes follows the image size through each step, calling visit, if not
+// nil, with each step and the size of its input
+func (p *PipelineProcessor) walkSizes(params map[string]interface{}, width, height int, visit func(proc Processor, params map[string]interface{}, width, height int) error) (int, int, error) {
+	steps, err := PipelineSteps(params)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for i, step := range steps {
+		proc, err := p.registry.Get(step.Processor)
+		if err != nil {
+			return 0, 0, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		if visit != nil {
+			if err := visit(proc, step.Params, width, height); err != nil {
+				return 0, 0, fmt.Errorf("step %d (%s): %w", i+1, step.Processor, err)
+			}
+		}
+		if width, height, err = OutputSize(proc, step.Params, width, height); err != nil {
+			return 0, 0, fmt.Errorf("step %d (%s): %w", i+1, step.Processor, err)
+		}
+	}
+	return width, height, nil
+}
+
+// References collects the stored objects named by each step
+func (p *PipelineProcessor) References(params map[string]interface{}) []string {
+	steps, err := PipelineSteps(params)
+	if err != nil {
+		return nil
+	}
+
+	var keys []string
+	for _, step := range steps {
+		proc, err := p.registry.Get(step.Processor)
+		if err != nil {
+			continue
+		}
+		if r, ok := proc.(Referencer); ok {
+			keys = append(keys, r.References(step.Params)...)
+		}
+	}
+	return keys
+}
+
+func (p *PipelineProcessor) Name() string { return "pipeline" }
+
+// PipelineSteps extracts the steps from pipeline params, which may have been
+// decoded from JSON or built in Go.
+func PipelineSteps(params map[string]interface{}) ([]Step, error) {
+	raw, ok := params["steps"]
+	if !ok {
+		return nil, fmt.Errorf("steps parameter is required")
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("steps parameter is invalid: %w", err)
+	}
+	var steps []Step
+	if err := json.Unmarshal(data, &steps); err != nil {
+		return nil, fmt.Errorf("steps parameter must be a list of {processor, params}")
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("steps parameter must contain at least one step")
+	}
+	if len(steps) > MaxPipelineSteps {
+		return nil, fmt.Errorf("steps parameter cannot have more than %d steps", MaxPipelineSteps)
+	}
+	for i := range steps {
+		if steps[i].Processor == "" {
+			return nil, fmt.Errorf("step %d: processor is required", i+1)
+		}
+		if steps[i].Params == nil {
+			steps[i].Params = map[string]interface{}{}
+		}
+	}
+	return steps, nil
+}
@@ -0,0 +1,233 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+func step(processor string, params map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"processor": processor, "params": params}
+}
+
+func TestPipelineProcessor_Name(t *testing.T) {
+	p := NewPipelineProcessor(NewRegistry())
+	if p.Name() != "pipeline" {
+		t.Errorf("Expected name 'pipeline', got '%s'", p.Name())
+	}
+}
+
+func TestPipelineProcessor_ValidateParams(t *testing.T) {
+	p, _ := DefaultRegistry().Get("pipeline")
+
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "valid steps",
+			params: map[string]interface{}{"steps": []interface{}{
+				step("crop", map[string]interface{}{"x": 0, "y": 0, "width": 10, "height": 10}),
+				step("resize", map[string]interface{}{"width": 5, "height": 5}),
+			}},
+			wantErr: false,
+		},
+		{
+			name:    "missing steps",
+			params:  map[string]interface{}{},
+			wantErr: true,
+		},
+		{
+			name:    "empty steps",
+			params:  map[string]interface{}{"steps": []interface{}{}},
+			wantErr: true,
+		},
+		{
+			name:    "steps not a list",
+			params:  map[string]interface{}{"steps": "resize"},
+			wantErr: true,
+		},
+		{
+			name: "unknown processor",
+			params: map[string]interface{}{"steps": []interface{}{
+				step("explode", nil),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "missing processor",
+			params: map[string]interface{}{"steps": []interface{}{
+				map[string]interface{}{"params": map[string]interface{}{"width": 5, "height": 5}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "invalid step params",
+			params: map[string]interface{}{"steps": []interface{}{
+				step("resize", map[string]interface{}{"width": 5, "height": 5}),
+				step("resize", map[string]interface{}{"width": 0, "height": 5}),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "nested pipeline",
+			params: map[string]interface{}{"steps": []interface{}{
+				step("pipeline", map[string]interface{}{"steps": []interface{}{}}),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "too many steps",
+			params: func() map[string]interface{} {
+				steps := make([]interface{}, MaxPipelineSteps+1)
+				for i := range steps {
+					steps[i] = step("resize", map[string]interface{}{"width": 5, "height": 5})
+				}
+				return map[string]interface{}{"steps": steps}
+			}(),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.ValidateParams(tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPipelineProcessor_ValidateDimensions(t *testing.T) {
+	p := NewPipelineProcessor(DefaultRegistry())
+
+	tests := []struct {
+		name          string
+		steps         []interface{}
+		width, height int
+		wantErr       bool
+	}{
+		{
+			name:  "first step fits",
+			steps: []interface{}{step("crop", map[string]interface{}{"x": 50, "y": 0, "width": 60, "height": 10})},
+			width: 200, height: 100,
+		},
+		{
+			name:  "first step outside the image",
+			steps: []interface{}{step("crop", map[string]interface{}{"x": 50, "y": 0, "width": 60, "height": 10})},
+			width: 100, height: 100, wantErr: true,
+		},
+		{
+			name: "later step outside an earlier step's output",
+			steps: []interface{}{
+				step("resize", map[string]interface{}{"width": 50, "height": 50}),
+				step("crop", map[string]interface{}{"x": 0, "y": 0, "width": 60, "height": 10}),
+			},
+			width: 100, height: 100, wantErr: true,
+		},
+		{
+			name: "later step sees transposed size",
+			steps: []interface{}{
+				step("transpose", nil),
+				step("crop", map[string]interface{}{"x": 0, "y": 0, "width": 10, "height": 150}),
+			},
+			width: 200, height: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.ValidateDimensions(map[string]interface{}{"steps": tt.steps}, tt.width, tt.height)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateDimensions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPipelineProcessor_OutputSize(t *testing.T) {
+	p := NewPipelineProcessor(DefaultRegistry())
+
+	w, h, err := p.OutputSize(map[string]interface{}{"steps": []interface{}{
+		step("crop", map[string]interface{}{"x": 0, "y": 0, "width": 80, "height": 40}),
+		step("rotate", map[string]interface{}{"angle": 90}),
+		step("resize", map[string]interface{}{"width": 20}),
+		step("grayscale", nil),
+	}}, 100, 100)
+	if err != nil {
+		t.Fatalf("OutputSize() error = %v", err)
+	}
+	if w != 20 || h != 40 {
+		t.Errorf("OutputSize() = %dx%d, want 20x40", w, h)
+	}
+}
+
+func TestRunSteps_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := RunSteps(ctx, DefaultRegistry(), image.NewRGBA(image.Rect(0, 0, 10, 10)), []Step{{Processor: "grayscale"}}, nil)
+	if !errors.Is(err, context.Canceled) || errors.Is(err, job.ErrPermanent) {
+		t.Errorf("RunSteps() error = %v, want a transient cancellation", err)
+	}
+}
+
+func TestWorkingMemory(t *testing.T) {
+	pipeline := NewPipelineProcessor(DefaultRegistry())
+	region := map[string]interface{}{"sigma": 2, "x": 0, "y": 0, "width": 10, "height": 20}
+
+	tests := []struct {
+		name   string
+		proc   Processor
+		params map[string]interface{}
+		want   int64
+	}{
+		// 10x100 scaled across, then 10x10
+		{"resize", NewResizeProcessor(), map[string]interface{}{"width": 10}, (10*100 + 10*10) * wideBytesPerPixel},
+		{"resize in linear light", NewResizeProcessor(), map[string]interface{}{"width": 10, "linear": true}, (10*100 + 10*10 + 100*100) * wideBytesPerPixel},
+		// fill scales to cover 20x10, then crops
+		{"resize fill", NewResizeProcessor(), map[string]interface{}{"width": 20, "height": 10, "mode": "fill"}, (20*100 + 20*20) * wideBytesPerPixel},
+		{"rotate needs no buffers", NewRotateProcessor(), map[string]interface{}{"angle": 30, "expand": true}, 0},
+		{"text", NewTextProcessor(nil), map[string]interface{}{"text": "hi"}, 100 * 100 * (1 + rgbaBytesPerPixel)},
+		{"tiled watermark", NewWatermarkProcessor(nil), map[string]interface{}{"overlay": "overlays/logo.png", "tile": true},
+			maxOverlayPixels*(wideBytesPerPixel+rgbaBytesPerPixel) + 100*100*rgbaBytesPerPixel},
+		{"blur", NewBlurProcessor(), map[string]interface{}{"sigma": 2}, 100 * 100 * floatBytesPerPixel},
+		{"blur region", NewBlurProcessor(), region, 10 * 20 * floatBytesPerPixel},
+		{"sharpen", NewSharpenProcessor(), map[string]interface{}{}, 2 * 100 * 100 * floatBytesPerPixel},
+		// blur's buffers and output, less the pipeline's 50x50 output
+		{"pipeline takes the largest step at its input size", pipeline, map[string]interface{}{"steps": []interface{}{
+			step("blur", map[string]interface{}{"sigma": 2}),
+			step("resize", map[string]interface{}{"width": 50}),
+			step("sharpen", nil),
+		}}, 100*100*(floatBytesPerPixel+rgbaBytesPerPixel) - 50*50*rgbaBytesPerPixel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WorkingMemory(tt.proc, tt.params, 100, 100); got != tt.want {
+				t.Errorf("WorkingMemory() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipelineProcessor_Process(t *testing.T) {
+	p := NewPipelineProcessor(DefaultRegistry())
+	img := image.NewRGBA(image.Rect(0, 0, 100, 80))
+
+	out, err := p.Process(context.Background(), img, map[string]interface{}{"steps": []interface{}{
+		step("crop", map[string]interface{}{"x": 10, "y": 10, "width": 40, "height": 40}),
+		step("resize", map[string]interface{}{"width": 20, "height": 10}),
+	}})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if b := out.Bounds(); b.Dx() != 20 || b.Dy() != 10 {
+		t.Errorf("Expected 20x10, got %dx%d", b.Dx(), b.Dy())
+	}
+}
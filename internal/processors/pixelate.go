@@ -0,0 +1,82 @@
+package processors
+
+import (
+	"context"
+	"image"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/validation"
+)
+
+// PixelateProcessor replaces each size x size block with its average colour,
+// over the whole image or the region set by x, y, width and height
+type PixelateProcessor struct{}
+
+func NewPixelateProcessor() *PixelateProcessor {
+	return &PixelateProcessor{}
+}
+
+func (p *PixelateProcessor) Process(_ context.Context, img image.Image, params map[string]interface{}) (image.Image, error) {
+	size, err := pixelateSize(params)
+	if err != nil {
+		return nil, err
+	}
+	return applyToRegion(img, params, func(src *image.NRGBA) *image.NRGBA {
+		return pixelate(newFloatImage(src), size).toNRGBA()
+	})
+}
+
+func (p *PixelateProcessor) ValidateParams(params map[string]interface{}) error {
+	if _, err := pixelateSize(params); err != nil {
+		return err
+	}
+	_, _, err := paramRegion(params)
+	return err
+}
+
+// ValidateDimensions checks that the region, if any, lies within the image
+func (p *PixelateProcessor) ValidateDimensions(params map[string]interface{}, width, height int) error {
+	return validateRegion(params, width, height)
+}
+
+// WorkingMemory counts the floating-point copy of the pixelated area
+func (p *PixelateProcessor) WorkingMemory(params map[string]interface{}, width, height int) int64 {
+	return regionPixels(params, width, height) * floatBytesPerPixel
+}
+
+func (p *PixelateProcessor) Name() string { return "pixelate" }
+
+func pixelateSize(params map[string]interface{}) (int, error) {
+	size, err := paramInt(params, "size")
+	if err != nil {
+		return 0, err
+	}
+	return size, validation.ValidateRange(float64(size), 2, validation.MaxImageDimension, "size")
+}
+
+// pixelate averages f in place over blocks aligned to its top-left corner.
+// Blocks at the right and bottom edges may be smaller.
+func pixelate(f *floatImage, size int) *floatImage {
+	for by := 0; by < f.h; by += size {
+		for bx := 0; bx < f.w; bx += size {
+			maxX, maxY := min(bx+size, f.w), min(by+size, f.h)
+
+			var acc [4]float64
+			for y := by; y < maxY; y++ {
+				for x := bx; x < maxX; x++ {
+					for c, v := range f.pix[4*(y*f.w+x) : 4*(y*f.w+x)+4] {
+						acc[c] += float64(v)
+					}
+				}
+			}
+			n := float64((maxX - bx) * (maxY - by))
+			for y := by; y < maxY; y++ {
+				for x := bx; x < maxX; x++ {
+					for c := range acc {
+						f.pix[4*(y*f.w+x)+c] = float32(acc[c] / n)
+					}
+				}
+			}
+		}
+	}
+	return f
+}
@@ -0,0 +1,83 @@
+package processors
+
+import (
+	"context"
+	"image/color"
+	"testing"
+)
+
+func TestPixelateProcessor_Name(t *testing.T) {
+	p := NewPixelateProcessor()
+	if p.Name() != "pixelate" {
+		t.Errorf("Expected name 'pixelate', got '%s'", p.Name())
+	}
+}
+
+func TestPixelateProcessor_ValidateParams(t *testing.T) {
+	p := NewPixelateProcessor()
+
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		wantErr bool
+	}{
+		{"valid size", map[string]interface{}{"size": 8}, false},
+		{"with region", map[string]interface{}{"size": 8, "x": 0, "y": 0, "width": 16, "height": 16}, false},
+		{"missing size", map[string]interface{}{}, true},
+		{"size too small", map[string]interface{}{"size": 1}, true},
+		{"zero width region", map[string]interface{}{"size": 8, "x": 0, "y": 0, "width": 0, "height": 16}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.ValidateParams(tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPixelateProcessor_Process(t *testing.T) {
+	p := NewPixelateProcessor()
+
+	result, err := p.Process(context.Background(), stripes(10, 4), map[string]interface{}{"size": 4})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if result.Bounds().Dx() != 10 || result.Bounds().Dy() != 4 {
+		t.Fatalf("Process() changed dimensions to %v", result.Bounds())
+	}
+
+	// Each full block averages two white and two black columns
+	block := color.NRGBAModel.Convert(result.At(0, 0)).(color.NRGBA)
+	for x := 0; x < 4; x++ {
+		if got := color.NRGBAModel.Convert(result.At(x, 3)); got != block {
+			t.Errorf("pixel (%d,3) = %v, want block colour %v", x, got, block)
+		}
+	}
+	if block.R < 126 || block.R > 129 {
+		t.Errorf("block = %v, want mid-grey", block)
+	}
+
+	// The partial block at the right edge averages one white, one black column
+	if got := color.NRGBAModel.Convert(result.At(9, 0)).(color.NRGBA); got.R < 126 || got.R > 129 {
+		t.Errorf("edge block = %v, want mid-grey", got)
+	}
+}
+
+func TestPixelateProcessor_Region(t *testing.T) {
+	p := NewPixelateProcessor()
+	img := stripes(20, 20)
+
+	result, err := p.Process(context.Background(), img, map[string]interface{}{"size": 4, "x": 4, "y": 4, "width": 8, "height": 8})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := color.NRGBAModel.Convert(result.At(0, 0)); got != img.At(0, 0) {
+		t.Errorf("outside region changed: %v", got)
+	}
+	if got := color.NRGBAModel.Convert(result.At(4, 4)).(color.NRGBA); got.R == 255 {
+		t.Errorf("inside region not pixelated: %v", got)
+	}
+}
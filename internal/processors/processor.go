@@ -1,17 +1,83 @@
 package processors
 
 import (
+	"context"
 	"fmt"
 	"image"
+	"image/color"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/validation"
 )
 
 // Processor defines the interface for image processors
 type Processor interface {
-	Process(img image.Image, params map[string]interface{}) (image.Image, error)
+	Process(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, error)
 	ValidateParams(params map[string]interface{}) error
 	Name() string
 }
 
+// DimensionValidator is implemented by processors whose parameters are only
+// valid for some input sizes, so they can be checked against the image header
+// before the image is decoded.
+type DimensionValidator interface {
+	ValidateDimensions(params map[string]interface{}, width, height int) error
+}
+
+// Sizer is implemented by processors whose output size differs from their
+// input size. Processors that do not implement it keep the input size.
+type Sizer interface {
+	OutputSize(params map[string]interface{}, width, height int) (int, int, error)
+}
+
+// OutputSize returns the size of the image proc produces from a width x
+// height input
+func OutputSize(proc Processor, params map[string]interface{}, width, height int) (int, int, error) {
+	if s, ok := proc.(Sizer); ok {
+		return s.OutputSize(params, width, height)
+	}
+	return width, height, nil
+}
+
+const (
+	// rgbaBytesPerPixel is the size of a pixel of the 8-bit images steps
+	// produce
+	rgbaBytesPerPixel = 4
+
+	// wideBytesPerPixel is the size of a 16-bit RGBA pixel, the widest a
+	// decoded or resampled image has
+	wideBytesPerPixel = 8
+)
+
+// WorkingMemoryEstimator is implemented by processors that allocate buffers
+// beyond their input and output images, e.g. floating-point copies
+type WorkingMemoryEstimator interface {
+	WorkingMemory(params map[string]interface{}, width, height int) int64
+}
+
+// WorkingMemory returns the bytes proc allocates, beyond its input and output
+// images, to process a width x height image
+func WorkingMemory(proc Processor, params map[string]interface{}, width, height int) int64 {
+	if e, ok := proc.(WorkingMemoryEstimator); ok {
+		return e.WorkingMemory(params, width, height)
+	}
+	return 0
+}
+
+// Memory approximates the bytes proc allocates to process a width x height
+// image: its output, counted as 8-bit RGBA, and its working memory
+func Memory(proc Processor, params map[string]interface{}, width, height int) int64 {
+	n := WorkingMemory(proc, params, width, height)
+	if w, h, err := OutputSize(proc, params, width, height); err == nil {
+		n += imageBytes(w, h)
+	}
+	return n
+}
+
+// imageBytes returns the size of a width x height 8-bit RGBA image
+func imageBytes(width, height int) int64 {
+	return int64(width) * int64(height) * rgbaBytesPerPixel
+}
+
 // toInt extracts an int from a param value that may be int or float64 (JSON round-trip).
 func toInt(v any) (int, bool) {
 	switch n := v.(type) {
@@ -30,3 +96,74 @@ func paramInt(params map[string]any, key string) (int, error) {
 	}
 	return v, nil
 }
+
+// paramOptionalInt extracts an int param, reporting whether it was present
+func paramOptionalInt(params map[string]any, key string) (int, bool, error) {
+	if _, ok := params[key]; !ok {
+		return 0, false, nil
+	}
+	v, ok := toInt(params[key])
+	if !ok {
+		return 0, false, fmt.Errorf("%s parameter must be an integer", key)
+	}
+	return v, true, nil
+}
+
+// paramString extracts an optional string param, returning def if it is absent
+func paramString(params map[string]any, key, def string) (string, error) {
+	v, ok := params[key]
+	if !ok {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s parameter must be a string", key)
+	}
+	return s, nil
+}
+
+// paramBool extracts an optional bool param, returning false if it is absent
+func paramBool(params map[string]any, key string) (bool, error) {
+	v, ok := params[key]
+	if !ok {
+		return false, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s parameter must be a boolean", key)
+	}
+	return b, nil
+}
+
+// paramFloat extracts a numeric param as a float64
+func paramFloat(params map[string]any, key string) (float64, error) {
+	switch n := params[key].(type) {
+	case int:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	}
+	return 0, fmt.Errorf("%s parameter must be a number", key)
+}
+
+// paramFloatOr extracts an optional numeric param, returning def if it is absent
+func paramFloatOr(params map[string]any, key string, def float64) (float64, error) {
+	if _, ok := params[key]; !ok {
+		return def, nil
+	}
+	return paramFloat(params, key)
+}
+
+// paramColor extracts an optional hex colour param, returning def if it is
+// absent
+func paramColor(params map[string]any, key, def string) (color.NRGBA, error) {
+	s, err := paramString(params, key, def)
+	if err != nil {
+		return color.NRGBA{}, err
+	}
+	c, err := validation.ParseColor(s)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("%s: %w", key, err)
+	}
+	return c, nil
+}
@@ -3,6 +3,8 @@ package processors
 import (
 	"fmt"
 	"sync"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/storage"
 )
 
 // Registry manages available image processors
@@ -66,5 +68,48 @@ func DefaultRegistry() *Registry {
 	if err := registry.Register("resize", NewResizeProcessor()); err != nil {
 		panic(err)
 	}
+	if err := registry.Register("rotate", NewRotateProcessor()); err != nil {
+		panic(err)
+	}
+	if err := registry.Register("flip", NewFlipProcessor()); err != nil {
+		panic(err)
+	}
+	if err := registry.Register("transpose", NewTransposeProcessor()); err != nil {
+		panic(err)
+	}
+	for _, p := range []Processor{
+		NewGrayscaleProcessor(),
+		NewSepiaProcessor(),
+		NewBrightnessProcessor(),
+		NewContrastProcessor(),
+		NewSaturationProcessor(),
+		NewHueProcessor(),
+		NewGammaProcessor(),
+		NewInvertProcessor(),
+		NewBlurProcessor(),
+		NewSharpenProcessor(),
+		NewPixelateProcessor(),
+	} {
+		if err := registry.Register(p.Name(), p); err != nil {
+			panic(err)
+		}
+	}
+	if err := registry.Register("pipeline", NewPipelineProcessor(registry)); err != nil {
+		panic(err)
+	}
 	return registry
 }
+
+// RegisterStorageProcessors adds the processors that read the objects they
+// reference, such as overlays and fonts, from stor
+func RegisterStorageProcessors(registry *Registry, stor storage.Storage) error {
+	for _, p := range []Processor{
+		NewWatermarkProcessor(stor),
+		NewTextProcessor(stor),
+	} {
+		if err := registry.Register(p.Name(), p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
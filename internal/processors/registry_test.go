@@ -95,5 +95,15 @@ func TestRegistry(t *testing.T) {
 		if err != nil {
 			t.Error("DefaultRegistry should have resize processor")
 		}
+
+		for _, name := range []string{
+			"rotate", "flip", "transpose",
+			"grayscale", "sepia", "brightness", "contrast", "saturation", "hue", "gamma", "invert",
+			"blur", "sharpen", "pixelate",
+		} {
+			if _, err := registry.Get(name); err != nil {
+				t.Errorf("DefaultRegistry should have %s processor", name)
+			}
+		}
 	})
 }
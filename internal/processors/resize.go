@@ -1,7 +1,12 @@
 package processors
 
 import (
+	"context"
+	"fmt"
 	"image"
+	"image/draw"
+	"math"
+	"strings"
 
 	"github.com/mohammed-ysn/cluster-imager/pkg/validation"
 	"github.com/nfnt/resize"
@@ -13,28 +18,218 @@ func NewResizeProcessor() *ResizeProcessor {
 	return &ResizeProcessor{}
 }
 
-func (p *ResizeProcessor) Process(img image.Image, params map[string]interface{}) (image.Image, error) {
-	width, err := paramInt(params, "width")
+func (p *ResizeProcessor) Process(_ context.Context, img image.Image, params map[string]interface{}) (image.Image, error) {
+	rp, err := resizeParams(params)
 	if err != nil {
 		return nil, err
 	}
-	height, err := paramInt(params, "height")
-	if err != nil {
+	if err := validation.ValidateResizeParams(rp); err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	width, height := targetSize(rp, bounds.Dx(), bounds.Dy())
+	if err := validateOutputSize(width, height); err != nil {
 		return nil, err
 	}
-	return resize.Resize(uint(width), uint(height), img, resize.Lanczos2), nil //nolint:gosec
+
+	switch rp.Mode {
+	case validation.ResizeFill, validation.ResizeCover:
+		return fill(img, width, height, rp), nil
+	case validation.ResizePad:
+		bg, _ := validation.ParseColor(rp.Background)
+		return pad(img, width, height, rp, image.NewUniform(bg)), nil
+	default:
+		return scale(img, width, height, rp), nil
+	}
 }
 
 func (p *ResizeProcessor) ValidateParams(params map[string]interface{}) error {
-	width, err := paramInt(params, "width")
+	rp, err := resizeParams(params)
 	if err != nil {
 		return err
 	}
-	height, err := paramInt(params, "height")
+	return validation.ValidateResizeParams(rp)
+}
+
+// ValidateDimensions checks that a derived width or height stays within limits
+func (p *ResizeProcessor) ValidateDimensions(params map[string]interface{}, width, height int) error {
+	rp, err := resizeParams(params)
 	if err != nil {
 		return err
 	}
-	return validation.ValidateResizeParams(width, height)
+	return validateOutputSize(targetSize(rp, width, height))
+}
+
+// OutputSize returns the size of the resized image
+func (p *ResizeProcessor) OutputSize(params map[string]interface{}, width, height int) (int, int, error) {
+	rp, err := resizeParams(params)
+	if err != nil {
+		return 0, 0, err
+	}
+	w, h := targetSize(rp, width, height)
+	return w, h, nil
+}
+
+// WorkingMemory counts the resampler's images, which are 16-bit for some
+// inputs: the intermediate scaled in one direction and the fully scaled one,
+// which fill and pad then copy. Linear mode adds a 16-bit copy of the input.
+func (p *ResizeProcessor) WorkingMemory(params map[string]interface{}, width, height int) int64 {
+	rp, err := resizeParams(params)
+	if err != nil {
+		return 0
+	}
+	w, h := targetSize(rp, width, height)
+	sw, sh := scaledSize(rp, width, height, w, h)
+	n := (int64(sw)*int64(height) + int64(sw)*int64(sh)) * wideBytesPerPixel
+	if rp.Linear {
+		n += int64(width) * int64(height) * wideBytesPerPixel
+	}
+	return n
 }
 
 func (p *ResizeProcessor) Name() string { return "resize" }
+
+// resizeParams reads resize params. Width and height are optional, but must
+// be positive when given.
+func resizeParams(params map[string]interface{}) (validation.ResizeParams, error) {
+	var rp validation.ResizeParams
+	for _, dim := range []struct {
+		key string
+		dst *int
+	}{{"width", &rp.Width}, {"height", &rp.Height}} {
+		v, ok, err := paramOptionalInt(params, dim.key)
+		if err != nil {
+			return rp, err
+		}
+		if ok {
+			if err := validation.ValidateDimension(v, dim.key); err != nil {
+				return rp, err
+			}
+			*dim.dst = v
+		}
+	}
+
+	var err error
+	if rp.Mode, err = paramString(params, "mode", validation.ResizeStretch); err != nil {
+		return rp, err
+	}
+	if rp.Gravity, err = paramString(params, "gravity", "center"); err != nil {
+		return rp, err
+	}
+	if rp.Background, err = paramString(params, "background", "#ffffff"); err != nil {
+		return rp, err
+	}
+	if rp.Filter, err = paramString(params, "filter", "lanczos2"); err != nil {
+		return rp, err
+	}
+	if rp.Linear, err = paramBool(params, "linear"); err != nil {
+		return rp, err
+	}
+	return rp, nil
+}
+
+// targetSize returns the output size for an srcW x srcH image. A missing
+// dimension is derived from the aspect ratio, and fit shrinks the box to it.
+func targetSize(rp validation.ResizeParams, srcW, srcH int) (int, int) {
+	switch {
+	case rp.Width == 0:
+		return scaleDim(srcW, rp.Height, srcH), rp.Height
+	case rp.Height == 0:
+		return rp.Width, scaleDim(srcH, rp.Width, srcW)
+	case rp.Mode == validation.ResizeFit:
+		ratio := math.Min(float64(rp.Width)/float64(srcW), float64(rp.Height)/float64(srcH))
+		return max(1, int(math.Round(float64(srcW)*ratio))), max(1, int(math.Round(float64(srcH)*ratio)))
+	default:
+		return rp.Width, rp.Height
+	}
+}
+
+// scaleDim scales dim by num/den, rounding and keeping at least one pixel
+func scaleDim(dim, num, den int) int {
+	return max(1, int(math.Round(float64(dim)*float64(num)/float64(den))))
+}
+
+func validateOutputSize(width, height int) error {
+	if width > validation.MaxImageDimension || height > validation.MaxImageDimension {
+		return fmt.Errorf("output size %dx%d exceeds %d: %w", width, height, validation.MaxImageDimension, validation.ErrDimensionTooLarge)
+	}
+	return nil
+}
+
+// resizeFilters maps filter names to resampling kernels
+var resizeFilters = map[string]resize.InterpolationFunction{
+	"nearest":  resize.NearestNeighbor,
+	"bilinear": resize.Bilinear,
+	"bicubic":  resize.Bicubic,
+	"mitchell": resize.MitchellNetravali,
+	"lanczos2": resize.Lanczos2,
+	"lanczos3": resize.Lanczos3,
+}
+
+// scale resizes img to exactly width x height with the filter in rp,
+// optionally in linear light
+func scale(img image.Image, width, height int, rp validation.ResizeParams) image.Image {
+	filter := resizeFilters[rp.Filter]
+	if !rp.Linear {
+		return resize.Resize(uint(width), uint(height), img, filter) //nolint:gosec
+	}
+	return delinearize(resize.Resize(uint(width), uint(height), linearize(img), filter)) //nolint:gosec
+}
+
+// scaledSize returns the size an srcW x srcH image is resampled to for a
+// width x height output: fill covers the output and crops the overflow, and
+// pad fits within it
+func scaledSize(rp validation.ResizeParams, srcW, srcH, width, height int) (int, int) {
+	switch rp.Mode {
+	case validation.ResizeFill, validation.ResizeCover:
+		ratio := math.Max(float64(width)/float64(srcW), float64(height)/float64(srcH))
+		return max(width, int(math.Round(float64(srcW)*ratio))), max(height, int(math.Round(float64(srcH)*ratio)))
+	case validation.ResizePad:
+		return targetSize(validation.ResizeParams{Width: width, Height: height, Mode: validation.ResizeFit}, srcW, srcH)
+	}
+	return width, height
+}
+
+// fill scales img to cover width x height, then crops the overflow, keeping
+// the part of the image selected by gravity
+func fill(img image.Image, width, height int, rp validation.ResizeParams) image.Image {
+	b := img.Bounds()
+	scaledW, scaledH := scaledSize(rp, b.Dx(), b.Dy(), width, height)
+	scaled := scale(img, scaledW, scaledH, rp)
+
+	x, y := gravityOffset(rp.Gravity, scaledW-width, scaledH-height)
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(out, out.Bounds(), scaled, scaled.Bounds().Min.Add(image.Pt(x, y)), draw.Src)
+	return out
+}
+
+// pad scales img to fit within width x height and places it on a background
+// of that size, positioned by gravity
+func pad(img image.Image, width, height int, rp validation.ResizeParams, bg image.Image) image.Image {
+	b := img.Bounds()
+	fitW, fitH := scaledSize(rp, b.Dx(), b.Dy(), width, height)
+	scaled := scale(img, fitW, fitH, rp)
+
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(out, out.Bounds(), bg, image.Point{}, draw.Src)
+	x, y := gravityOffset(rp.Gravity, width-fitW, height-fitH)
+	draw.Draw(out, image.Rect(x, y, x+fitW, y+fitH), scaled, scaled.Bounds().Min, draw.Over)
+	return out
+}
+
+// gravityOffset positions content within free space of dx x dy pixels
+func gravityOffset(gravity string, dx, dy int) (int, int) {
+	x, y := dx/2, dy/2
+	if strings.Contains(gravity, "west") {
+		x = 0
+	} else if strings.Contains(gravity, "east") {
+		x = dx
+	}
+	if strings.HasPrefix(gravity, "north") {
+		y = 0
+	} else if strings.HasPrefix(gravity, "south") {
+		y = dy
+	}
+	return x, y
+}
@@ -1,7 +1,10 @@
 package processors
 
 import (
+	"context"
 	"image"
+	"image/color"
+	"image/draw"
 	"testing"
 )
 
@@ -49,6 +52,82 @@ func TestResizeProcessor_ValidateParams(t *testing.T) {
 			params: map[string]interface{}{
 				"height": 200,
 			},
+			wantErr: false,
+		},
+		{
+			name:    "missing both",
+			params:  map[string]interface{}{},
+			wantErr: true,
+		},
+		{
+			name: "fill needs both dimensions",
+			params: map[string]interface{}{
+				"width": 100,
+				"mode":  "fill",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown mode",
+			params: map[string]interface{}{
+				"width":  100,
+				"height": 100,
+				"mode":   "squash",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown gravity",
+			params: map[string]interface{}{
+				"width":   100,
+				"height":  100,
+				"mode":    "cover",
+				"gravity": "up",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid background",
+			params: map[string]interface{}{
+				"width":      100,
+				"height":     100,
+				"mode":       "pad",
+				"background": "white",
+			},
+			wantErr: true,
+		},
+		{
+			name: "filter and linear",
+			params: map[string]interface{}{
+				"width":  100,
+				"filter": "mitchell",
+				"linear": true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown filter",
+			params: map[string]interface{}{
+				"width":  100,
+				"filter": "box",
+			},
+			wantErr: true,
+		},
+		{
+			name: "linear not a bool",
+			params: map[string]interface{}{
+				"width":  100,
+				"linear": "yes",
+			},
+			wantErr: true,
+		},
+		{
+			name: "mode not a string",
+			params: map[string]interface{}{
+				"width":  100,
+				"height": 100,
+				"mode":   1,
+			},
 			wantErr: true,
 		},
 		{
@@ -82,8 +161,8 @@ func TestResizeProcessor_ValidateParams(t *testing.T) {
 func TestResizeProcessor_Process(t *testing.T) {
 	p := NewResizeProcessor()
 
-	// Create a test image
-	img := image.NewRGBA(image.Rect(0, 0, 200, 200))
+	// Create a 2:1 test image
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
 
 	tests := []struct {
 		name         string
@@ -102,6 +181,36 @@ func TestResizeProcessor_Process(t *testing.T) {
 			expectWidth:  100,
 			expectHeight: 100,
 		},
+		{
+			name:         "width only",
+			params:       map[string]interface{}{"width": 50},
+			expectWidth:  50,
+			expectHeight: 25,
+		},
+		{
+			name:         "height only",
+			params:       map[string]interface{}{"height": 50},
+			expectWidth:  100,
+			expectHeight: 50,
+		},
+		{
+			name:         "fit",
+			params:       map[string]interface{}{"width": 100, "height": 100, "mode": "fit"},
+			expectWidth:  100,
+			expectHeight: 50,
+		},
+		{
+			name:         "fill",
+			params:       map[string]interface{}{"width": 100, "height": 100, "mode": "fill"},
+			expectWidth:  100,
+			expectHeight: 100,
+		},
+		{
+			name:         "pad",
+			params:       map[string]interface{}{"width": 100, "height": 100, "mode": "pad"},
+			expectWidth:  100,
+			expectHeight: 100,
+		},
 		{
 			name: "invalid params",
 			params: map[string]interface{}{
@@ -114,7 +223,7 @@ func TestResizeProcessor_Process(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := p.Process(img, tt.params)
+			result, err := p.Process(context.Background(), img, tt.params)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Process() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -132,3 +241,156 @@ func TestResizeProcessor_Process(t *testing.T) {
 		})
 	}
 }
+
+func TestResizeProcessor_FillGravity(t *testing.T) {
+	p := NewResizeProcessor()
+
+	// Left half red, right half blue
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	red := color.NRGBA{R: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			if x < 100 {
+				img.Set(x, y, red)
+			} else {
+				img.Set(x, y, blue)
+			}
+		}
+	}
+
+	tests := []struct {
+		gravity string
+		want    color.NRGBA
+	}{
+		{"west", red},
+		{"east", blue},
+		{"south-west", red},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.gravity, func(t *testing.T) {
+			result, err := p.Process(context.Background(), img, map[string]interface{}{
+				"width": 50, "height": 50, "mode": "cover", "gravity": tt.gravity,
+			})
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			got := color.NRGBAModel.Convert(result.At(25, 25)).(color.NRGBA)
+			if got != tt.want {
+				t.Errorf("centre pixel = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResizeProcessor_PadBackground(t *testing.T) {
+	p := NewResizeProcessor()
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	result, err := p.Process(context.Background(), img, map[string]interface{}{
+		"width": 100, "height": 100, "mode": "pad", "gravity": "north", "background": "#ff0000",
+	})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if got := color.NRGBAModel.Convert(result.At(50, 10)).(color.NRGBA); got != (color.NRGBA{A: 255}) {
+		t.Errorf("image pixel = %v, want black", got)
+	}
+	if got := color.NRGBAModel.Convert(result.At(50, 90)).(color.NRGBA); got != (color.NRGBA{R: 255, A: 255}) {
+		t.Errorf("padding pixel = %v, want red", got)
+	}
+}
+
+func TestResizeProcessor_ValidateDimensions(t *testing.T) {
+	p := NewResizeProcessor()
+
+	// A derived height of 20000 exceeds the limit
+	err := p.ValidateDimensions(map[string]interface{}{"width": 1000}, 10, 200)
+	if err == nil {
+		t.Error("expected error for derived dimension over the limit")
+	}
+	if err := p.ValidateDimensions(map[string]interface{}{"width": 100}, 200, 100); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestResizeProcessor_LinearLight(t *testing.T) {
+	p := NewResizeProcessor()
+
+	// A black and white checkerboard averages to half intensity in linear
+	// light, which is about 188 in sRGB. Averaging sRGB values gives 128.
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			if (x+y)%2 == 0 {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+
+	tests := []struct {
+		name     string
+		linear   bool
+		min, max uint8
+	}{
+		{"srgb", false, 118, 138},
+		{"linear", true, 178, 198},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := p.Process(context.Background(), img, map[string]interface{}{
+				"width": 8, "height": 8, "filter": "bilinear", "linear": tt.linear,
+			})
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			got := color.GrayModel.Convert(result.At(4, 4)).(color.Gray).Y
+			if got < tt.min || got > tt.max {
+				t.Errorf("grey level = %d, want %d-%d", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestResizeProcessor_NearestKeepsPalette(t *testing.T) {
+	p := NewResizeProcessor()
+
+	red := color.NRGBA{R: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, red)
+	img.Set(1, 0, blue)
+	img.Set(0, 1, blue)
+	img.Set(1, 1, red)
+
+	result, err := p.Process(context.Background(), img, map[string]interface{}{"width": 8, "height": 8, "filter": "nearest"})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			got := color.NRGBAModel.Convert(result.At(x, y)).(color.NRGBA)
+			if got != red && got != blue {
+				t.Fatalf("pixel (%d,%d) = %v, want only red or blue", x, y, got)
+			}
+		}
+	}
+}
+
+func TestLinearRoundTrip(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 256))
+	for i := 0; i < 256; i++ {
+		img.SetNRGBA(0, i, color.NRGBA{R: uint8(i), G: uint8(255 - i), B: 128, A: 255})
+	}
+
+	out := delinearize(linearize(img))
+	for i := 0; i < 256; i++ {
+		if got, want := out.NRGBAAt(0, i), img.NRGBAAt(0, i); got != want {
+			t.Errorf("row %d: got %v, want %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/validation"
+)
+
+// RotateProcessor rotates clockwise by an angle in degrees. Multiples of 90
+// are lossless; other angles are interpolated and the uncovered corners
+// filled with the background colour.
+type RotateProcessor struct{}
+
+func NewRotateProcessor() *RotateProcessor {
+	return &RotateProcessor{}
+}
+
+type rotateParams struct {
+	angle      float64 // normalised to [0, 360)
+	background string
+	expand     bool // grow the canvas to fit the rotated image
+}
+
+func (p *RotateProcessor) Process(_ context.Context, img image.Image, params map[string]interface{}) (image.Image, error) {
+	rp, err := parseRotateParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	switch rp.angle {
+	case 0:
+		return img, nil
+	case 90:
+		return rotate90(img), nil
+	case 180:
+		return rotate180(img), nil
+	case 270:
+		return rotate270(img), nil
+	}
+
+	b := img.Bounds()
+	width, height := rotatedSize(rp, b.Dx(), b.Dy())
+	if width > validation.MaxImageDimension || height > validation.MaxImageDimension {
+		return nil, fmt.Errorf("rotated size %dx%d exceeds %d: %w", width, height, validation.MaxImageDimension, validation.ErrDimensionTooLarge)
+	}
+	bg, _ := validation.ParseColor(rp.background)
+	return rotateArbitrary(img, rp.angle, width, height, bg), nil
+}
+
+func (p *RotateProcessor) ValidateParams(params map[string]interface{}) error {
+	_, err := parseRotateParams(params)
+	return err
+}
+
+// ValidateDimensions checks that an expanded canvas stays within limits
+func (p *RotateProcessor) ValidateDimensions(params map[string]interface{}, width, height int) error {
+	rp, err := parseRotateParams(params)
+	if err != nil {
+		return err
+	}
+	w, h := rotatedSize(rp, width, height)
+	if w > validation.MaxImageDimension || h > validation.MaxImageDimension {
+		return fmt.Errorf("rotated size %dx%d exceeds %d: %w", w, h, validation.MaxImageDimension, validation.ErrDimensionTooLarge)
+	}
+	return nil
+}
+
+// OutputSize returns the size of the rotated image
+func (p *RotateProcessor) OutputSize(params map[string]interface{}, width, height int) (int, int, error) {
+	rp, err := parseRotateParams(params)
+	if err != nil {
+		return 0, 0, err
+	}
+	w, h := rotatedSize(rp, width, height)
+	return w, h, nil
+}
+
+func (p *RotateProcessor) Name() string { return "rotate" }
+
+func parseRotateParams(params map[string]interface{}) (rotateParams, error) {
+	var rp rotateParams
+	var err error
+	if rp.angle, err = paramFloat(params, "angle"); err != nil {
+		return rp, err
+	}
+	if rp.background, err = paramString(params, "background", "#ffffff"); err != nil {
+		return rp, err
+	}
+	if rp.expand, err = paramBool(params, "expand"); err != nil {
+		return rp, err
+	}
+	if err := validation.ValidateRotateParams(rp.angle, rp.background); err != nil {
+		return rp, err
+	}
+
+	rp.angle = math.Mod(rp.angle, 360)
+	if rp.angle < 0 {
+		rp.angle += 360
+	}
+	return rp, nil
+}
+
+// rotatedSize returns the output size of rotating a width x height image
+func rotatedSize(rp rotateParams, width, height int) (int, int) {
+	switch {
+	case rp.angle == 90 || rp.angle == 270:
+		return height, width
+	case !rp.expand || math.Mod(rp.angle, 180) == 0:
+		return width, height
+	}
+
+	sin, cos := math.Sincos(rp.angle * math.Pi / 180)
+	w, h := float64(width), float64(height)
+	// Tolerate rounding error so that e.g. 45 degrees of a square is exact
+	outW := math.Ceil(math.Abs(w*cos) + math.Abs(h*sin) - 1e-6)
+	outH := math.Ceil(math.Abs(w*sin) + math.Abs(h*cos) - 1e-6)
+	return int(outW), int(outH)
+}
+
+// rotateArbitrary rotates img clockwise by angle degrees about its centre onto
+// a width x height canvas filled with bg. Each output pixel is bilinearly
+// interpolated from the source in premultiplied colour, so edges blend into
+// the background.
+func rotateArbitrary(img image.Image, angle float64, width, height int, bg color.Color) image.Image {
+	b := img.Bounds()
+	centre := [2]float64{float64(b.Min.X) + float64(b.Dx())/2, float64(b.Min.Y) + float64(b.Dy())/2}
+	return rotateAbout(img, angle, centre, width, height, [2]float64{float64(width) / 2, float64(height) / 2}, bg)
+}
+
+// rotateAbout rotates img clockwise by angle degrees about the point src of
+// its coordinate space onto a width x height canvas filled with bg, placing
+// src at the point dst of the canvas
+func rotateAbout(img image.Image, angle float64, src [2]float64, width, height int, dst [2]float64, bg color.Color) *image.RGBA {
+	b := img.Bounds()
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+
+	br, bgg, bb, ba := bg.RGBA()
+	background := [4]float64{float64(br), float64(bgg), float64(bb), float64(ba)}
+	sample := func(x, y int) [4]float64 {
+		if !image.Pt(x, y).In(b) {
+			return background
+		}
+		r, g, bl, a := img.At(x, y).RGBA()
+		return [4]float64{float64(r), float64(g), float64(bl), float64(a)}
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Map the output pixel centre back into the source
+			dx, dy := float64(x)+0.5-dst[0], float64(y)+0.5-dst[1]
+			sx := dx*cos + dy*sin + src[0] - 0.5
+			sy := -dx*sin + dy*cos + src[1] - 0.5
+
+			x0, y0 := math.Floor(sx), math.Floor(sy)
+			fx, fy := sx-x0, sy-y0
+			ix, iy := int(x0), int(y0)
+			c00, c10 := sample(ix, iy), sample(ix+1, iy)
+			c01, c11 := sample(ix, iy+1), sample(ix+1, iy+1)
+
+			var c [4]uint16
+			for i := range c {
+				top := c00[i]*(1-fx) + c10[i]*fx
+				bottom := c01[i]*(1-fx) + c11[i]*fx
+				c[i] = uint16(math.Round(top*(1-fy) + bottom*fy))
+			}
+			out.SetRGBA64(x, y, color.RGBA64{R: c[0], G: c[1], B: c[2], A: c[3]})
+		}
+	}
+	return out
+}
@@ -0,0 +1,171 @@
+package processors
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestRotateProcessor_Name(t *testing.T) {
+	p := NewRotateProcessor()
+	if p.Name() != "rotate" {
+		t.Errorf("Expected name 'rotate', got '%s'", p.Name())
+	}
+}
+
+func TestRotateProcessor_ValidateParams(t *testing.T) {
+	p := NewRotateProcessor()
+
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name:    "right angle",
+			params:  map[string]interface{}{"angle": 90},
+			wantErr: false,
+		},
+		{
+			name: "arbitrary angle with options",
+			params: map[string]interface{}{
+				"angle":      -30.5,
+				"background": "#00000000",
+				"expand":     true,
+			},
+			wantErr: false,
+		},
+		{
+			name:    "missing angle",
+			params:  map[string]interface{}{},
+			wantErr: true,
+		},
+		{
+			name:    "wrong type for angle",
+			params:  map[string]interface{}{"angle": "90"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid background",
+			params:  map[string]interface{}{"angle": 45, "background": "red"},
+			wantErr: true,
+		},
+		{
+			name:    "wrong type for expand",
+			params:  map[string]interface{}{"angle": 45, "expand": 1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.ValidateParams(tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRotateProcessor_ValidateDimensions(t *testing.T) {
+	p := NewRotateProcessor()
+
+	tests := []struct {
+		name          string
+		params        map[string]interface{}
+		width, height int
+		wantErr       bool
+	}{
+		{"right angle", map[string]interface{}{"angle": 90}, 10000, 100, false},
+		{"same canvas", map[string]interface{}{"angle": 45}, 10000, 10000, false},
+		{"expanded canvas too large", map[string]interface{}{"angle": 45, "expand": true}, 10000, 10000, true},
+		{"expanded canvas fits", map[string]interface{}{"angle": 45, "expand": true}, 100, 100, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.ValidateDimensions(tt.params, tt.width, tt.height)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateDimensions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRotateProcessor_Process(t *testing.T) {
+	p := NewRotateProcessor()
+
+	// 40x20 image with a marked top-left corner
+	marked := color.NRGBA{R: 255, A: 255}
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{B: 255, A: 255})
+		}
+	}
+	img.SetNRGBA(0, 0, marked)
+
+	tests := []struct {
+		name         string
+		params       map[string]interface{}
+		expectWidth  int
+		expectHeight int
+		markX, markY int // where the marked pixel ends up, or -1
+	}{
+		{"90", map[string]interface{}{"angle": 90}, 20, 40, 19, 0},
+		{"180", map[string]interface{}{"angle": 180}, 40, 20, 39, 19},
+		{"270", map[string]interface{}{"angle": 270}, 20, 40, 0, 39},
+		{"negative 90", map[string]interface{}{"angle": -90}, 20, 40, 0, 39},
+		{"full turn", map[string]interface{}{"angle": 360}, 40, 20, 0, 0},
+		{"float right angle", map[string]interface{}{"angle": 450.0}, 20, 40, 19, 0},
+		{"arbitrary keeps canvas", map[string]interface{}{"angle": 30}, 40, 20, -1, -1},
+		{"arbitrary expands canvas", map[string]interface{}{"angle": 30, "expand": true}, 45, 38, -1, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := p.Process(context.Background(), img, tt.params)
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			bounds := result.Bounds()
+			if bounds.Dx() != tt.expectWidth || bounds.Dy() != tt.expectHeight {
+				t.Errorf("Process() resulted in wrong dimensions: got %dx%d, want %dx%d",
+					bounds.Dx(), bounds.Dy(), tt.expectWidth, tt.expectHeight)
+			}
+			if tt.markX >= 0 {
+				if c := color.NRGBAModel.Convert(result.At(tt.markX, tt.markY)); c != marked {
+					t.Errorf("pixel (%d,%d) = %v, want marked", tt.markX, tt.markY, c)
+				}
+			}
+		})
+	}
+}
+
+func TestRotateProcessor_Background(t *testing.T) {
+	p := NewRotateProcessor()
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{B: 255, A: 255})
+		}
+	}
+
+	result, err := p.Process(context.Background(), img, map[string]interface{}{"angle": 45, "expand": true, "background": "#ff0000"})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	b := result.Bounds()
+	if b.Dx() != 29 || b.Dy() != 29 {
+		t.Fatalf("expected 29x29, got %dx%d", b.Dx(), b.Dy())
+	}
+
+	// Corners are uncovered, the centre is the image
+	if got := color.NRGBAModel.Convert(result.At(0, 0)).(color.NRGBA); got != (color.NRGBA{R: 255, A: 255}) {
+		t.Errorf("corner = %v, want background", got)
+	}
+	if got := color.NRGBAModel.Convert(result.At(14, 14)).(color.NRGBA); got != (color.NRGBA{B: 255, A: 255}) {
+		t.Errorf("centre = %v, want image", got)
+	}
+}
@@ -0,0 +1,64 @@
+package processors
+
+import (
+	"context"
+	"image"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/validation"
+)
+
+// SharpenProcessor applies an unsharp mask: it adds amount (0-5, default 1)
+// times the difference between the image and a Gaussian blur of sigma
+// (0.1-10, default 1)
+type SharpenProcessor struct{}
+
+func NewSharpenProcessor() *SharpenProcessor {
+	return &SharpenProcessor{}
+}
+
+func (p *SharpenProcessor) Process(_ context.Context, img image.Image, params map[string]interface{}) (image.Image, error) {
+	sigma, amount, err := sharpenParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	src := newFloatImage(toNRGBA(img))
+	blurred := src.clone()
+	blurred.gaussianBlur(sigma)
+	for i := 0; i < len(src.pix); i += 4 {
+		// Colour may not exceed alpha once premultiplied
+		a := src.pix[i+3]
+		for c := i; c < i+3; c++ {
+			v := src.pix[c] + float32(amount)*(src.pix[c]-blurred.pix[c])
+			src.pix[c] = max(0, min(v, a))
+		}
+	}
+	return src.toNRGBA(), nil
+}
+
+func (p *SharpenProcessor) ValidateParams(params map[string]interface{}) error {
+	_, _, err := sharpenParams(params)
+	return err
+}
+
+// WorkingMemory counts the floating-point image and its blurred copy
+func (p *SharpenProcessor) WorkingMemory(params map[string]interface{}, width, height int) int64 {
+	return 2 * int64(width) * int64(height) * floatBytesPerPixel
+}
+
+func (p *SharpenProcessor) Name() string { return "sharpen" }
+
+func sharpenParams(params map[string]interface{}) (float64, float64, error) {
+	sigma, err := paramFloatOr(params, "sigma", 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := validation.ValidateRange(sigma, 0.1, 10, "sigma"); err != nil {
+		return 0, 0, err
+	}
+	amount, err := paramFloatOr(params, "amount", 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	return sigma, amount, validation.ValidateRange(amount, 0, 5, "amount")
+}
@@ -0,0 +1,71 @@
+package processors
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSharpenProcessor_Name(t *testing.T) {
+	p := NewSharpenProcessor()
+	if p.Name() != "sharpen" {
+		t.Errorf("Expected name 'sharpen', got '%s'", p.Name())
+	}
+}
+
+func TestSharpenProcessor_ValidateParams(t *testing.T) {
+	p := NewSharpenProcessor()
+
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		wantErr bool
+	}{
+		{"defaults", map[string]interface{}{}, false},
+		{"custom", map[string]interface{}{"sigma": 0.5, "amount": 2}, false},
+		{"sigma too large", map[string]interface{}{"sigma": 20}, true},
+		{"negative amount", map[string]interface{}{"amount": -1}, true},
+		{"wrong type for amount", map[string]interface{}{"amount": "1"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.ValidateParams(tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSharpenProcessor_Process(t *testing.T) {
+	p := NewSharpenProcessor()
+
+	// A soft edge between dark and light grey gets more contrast
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 20; x++ {
+			v := uint8(80)
+			if x >= 10 {
+				v = 160
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+
+	result, err := p.Process(context.Background(), img, map[string]interface{}{"sigma": 1, "amount": 1})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	dark := color.NRGBAModel.Convert(result.At(9, 0)).(color.NRGBA)
+	light := color.NRGBAModel.Convert(result.At(10, 0)).(color.NRGBA)
+	if dark.R >= 80 || light.R <= 160 {
+		t.Errorf("edge not sharpened: %v, %v", dark, light)
+	}
+
+	// Flat areas are unchanged
+	if got := color.NRGBAModel.Convert(result.At(0, 0)).(color.NRGBA); got.R != 80 {
+		t.Errorf("flat area changed to %v", got)
+	}
+}
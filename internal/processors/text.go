@@ -0,0 +1,465 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+	"github.com/mohammed-ysn/cluster-imager/pkg/storage"
+	"github.com/mohammed-ysn/cluster-imager/pkg/validation"
+)
+
+const (
+	// MaxTextLength bounds the number of characters in a caption
+	MaxTextLength = 2000
+
+	// maxCachedFonts bounds the parsed fonts from storage a processor keeps;
+	// beyond it an arbitrary one is evicted
+	maxCachedFonts = 32
+
+	// maxFontSize bounds the size of a font file read from storage
+	maxFontSize = 20 << 20
+
+	// maxStrokeWidth bounds the outline width, whose cost grows with it
+	maxStrokeWidth = 20
+)
+
+// embeddedFontData are the fonts that ship with the binary, by name
+var embeddedFontData = map[string][]byte{
+	"go-regular":     goregular.TTF,
+	"go-bold":        gobold.TTF,
+	"go-italic":      goitalic.TTF,
+	"go-bold-italic": gobolditalic.TTF,
+	"go-mono":        gomono.TTF,
+}
+
+// embeddedFonts parses the embedded fonts once
+var embeddedFonts = sync.OnceValue(func() map[string]*opentype.Font {
+	fonts := make(map[string]*opentype.Font, len(embeddedFontData))
+	for name, data := range embeddedFontData {
+		f, err := opentype.Parse(data)
+		if err != nil {
+			panic(fmt.Sprintf("parse embedded font %s: %v", name, err))
+		}
+		fonts[name] = f
+	}
+	return fonts
+})
+
+// TextProcessor draws a caption onto the image. The text is wrapped to fit a
+// box, which defaults to the whole image, and may be rotated about the box
+// centre.
+type TextProcessor struct {
+	storage storage.Storage
+
+	mu    sync.Mutex
+	fonts map[string]cachedFont // parsed fonts read from storage, by key
+}
+
+// cachedFont is a parsed font and the ETag of the object it was read from
+type cachedFont struct {
+	etag string
+	font *opentype.Font
+}
+
+func NewTextProcessor(stor storage.Storage) *TextProcessor {
+	return &TextProcessor{storage: stor, fonts: make(map[string]cachedFont)}
+}
+
+type textParams struct {
+	text        string
+	font        string // name of an embedded font
+	fontKey     string // storage key of a TrueType or OpenType font
+	size        float64
+	color       color.NRGBA
+	stroke      int // outline width in pixels
+	strokeColor color.NRGBA
+	align       string
+	valign      string
+	angle       float64 // clockwise, in degrees
+}
+
+func (p *TextProcessor) Process(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, error) {
+	tp, err := parseTextParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	box := image.Rect(0, 0, b.Dx(), b.Dy())
+	if region, ok, _ := paramRegion(params); ok {
+		if err := validateRegion(params, b.Dx(), b.Dy()); err != nil {
+			return nil, err
+		}
+		box = region
+	}
+
+	f, err := p.loadFont(ctx, tp)
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: tp.size, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return nil, fmt.Errorf("create font face: %w", err)
+	}
+	defer face.Close()
+
+	lines := wrapText(face, tp.text, box.Dx())
+	layer := renderText(face, lines, tp, box.Dx(), box.Dy())
+
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), img, b.Min, draw.Src)
+	if layer == nil {
+		return out, nil
+	}
+
+	// The layer's coordinates are those of the box padded by the stroke width
+	// on each side
+	lb := layer.Bounds()
+	padded := box.Inset(-tp.stroke)
+	if tp.angle == 0 {
+		draw.Draw(out, lb.Add(padded.Min), layer, lb.Min, draw.Over)
+		return out, nil
+	}
+
+	// Rotation turns the layer about the centre of the box, so the layer's
+	// own centre moves as well as turning. The canvas gets a pixel of slack
+	// so that the centre keeps its sub-pixel position.
+	sin, cos := math.Sincos(tp.angle * math.Pi / 180)
+	lcx, lcy := float64(lb.Min.X+lb.Max.X)/2, float64(lb.Min.Y+lb.Max.Y)/2
+	dx, dy := lcx-float64(padded.Dx())/2, lcy-float64(padded.Dy())/2
+	cx := float64(box.Min.X+box.Max.X)/2 + dx*cos - dy*sin
+	cy := float64(box.Min.Y+box.Max.Y)/2 + dx*sin + dy*cos
+
+	rw, rh := rotatedSize(rotateParams{angle: tp.angle, expand: true}, lb.Dx(), lb.Dy())
+	origin := image.Pt(int(math.Floor(cx-float64(rw)/2)), int(math.Floor(cy-float64(rh)/2)))
+	canvasCentre := [2]float64{cx - float64(origin.X), cy - float64(origin.Y)}
+	rotated := rotateAbout(layer, tp.angle, [2]float64{lcx, lcy}, rw+1, rh+1, canvasCentre, color.Transparent)
+	draw.Draw(out, rotated.Bounds().Add(origin), rotated, image.Point{}, draw.Over)
+	return out, nil
+}
+
+func (p *TextProcessor) ValidateParams(params map[string]interface{}) error {
+	_, err := parseTextParams(params)
+	return err
+}
+
+// ValidateDimensions checks that the box lies within the image
+func (p *TextProcessor) ValidateDimensions(params map[string]interface{}, width, height int) error {
+	return validateRegion(params, width, height)
+}
+
+// WorkingMemory counts the text layer at its largest, the box padded by the
+// stroke: its mask, the outline's dilation buffers, the layer itself and, when
+// the text is turned, its rotated copy
+func (p *TextProcessor) WorkingMemory(params map[string]interface{}, width, height int) int64 {
+	tp, err := parseTextParams(params)
+	if err != nil {
+		return 0
+	}
+	if region, ok, _ := paramRegion(params); ok {
+		width, height = region.Dx(), region.Dy()
+	}
+	w, h := width+2*tp.stroke, height+2*tp.stroke
+	perPixel := int64(1 + rgbaBytesPerPixel)
+	if tp.stroke > 0 {
+		perPixel += 2
+	}
+	n := int64(w) * int64(h) * perPixel
+	if tp.angle != 0 {
+		rw, rh := rotatedSize(rotateParams{angle: tp.angle, expand: true}, w, h)
+		n += imageBytes(rw+1, rh+1)
+	}
+	return n
+}
+
+// References returns the font key, if the font is read from storage
+func (p *TextProcessor) References(params map[string]interface{}) []string {
+	tp, err := parseTextParams(params)
+	if err != nil || tp.fontKey == "" {
+		return nil
+	}
+	return []string{tp.fontKey}
+}
+
+func (p *TextProcessor) Name() string { return "text" }
+
+// loadFont returns the embedded font, or the font in storage. A stored font
+// is parsed once and reused while its ETag is unchanged. An unparseable font
+// fails permanently.
+func (p *TextProcessor) loadFont(ctx context.Context, tp textParams) (*opentype.Font, error) {
+	if tp.fontKey == "" {
+		return embeddedFonts()[tp.font], nil
+	}
+
+	meta, err := p.storage.Stat(ctx, tp.fontKey)
+	if err != nil {
+		return nil, objectError(fmt.Errorf("stat font: %w", err))
+	}
+	p.mu.Lock()
+	cached, ok := p.fonts[tp.fontKey]
+	p.mu.Unlock()
+	if ok && meta.ETag != "" && cached.etag == meta.ETag {
+		return cached.font, nil
+	}
+
+	data, err := downloadObject(ctx, p.storage, tp.fontKey, "font", maxFontSize)
+	if err != nil {
+		return nil, err
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, job.Permanent(job.CodeInvalidParameters, fmt.Errorf("parse font: %w", err))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.fonts[tp.fontKey]; !ok && len(p.fonts) >= maxCachedFonts {
+		for key := range p.fonts {
+			delete(p.fonts, key)
+			break
+		}
+	}
+	p.fonts[tp.fontKey] = cachedFont{etag: meta.ETag, font: f}
+	return f, nil
+}
+
+// wrapText breaks text into lines no wider than width, between words where
+// possible. Newlines in the text are kept.
+func wrapText(face font.Face, text string, width int) []string {
+	limit := fixed.I(width)
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if font.MeasureString(face, candidate) <= limit {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			// Split words too long for a line of their own
+			for font.MeasureString(face, word) > limit {
+				n := fitPrefix(face, word, limit)
+				if n == len(word) {
+					break
+				}
+				lines = append(lines, word[:n])
+				word = word[n:]
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// fitPrefix returns the byte length of the longest prefix of s no wider than
+// limit, and at least one character
+func fitPrefix(face font.Face, s string, limit fixed.Int26_6) int {
+	_, n := utf8.DecodeRuneInString(s)
+	for i, r := range s {
+		end := i + utf8.RuneLen(r)
+		if font.MeasureString(face, s[:end]) > limit {
+			break
+		}
+		n = end
+	}
+	return n
+}
+
+// renderText lays lines out in a width x height box padded by the stroke
+// width on each side, so that the outline is not clipped, and draws them onto
+// a transparent layer covering only their ink. The layer's bounds are in the
+// padded box's coordinates. It returns nil if nothing is visible.
+func renderText(face font.Face, lines []string, tp textParams, width, height int) *image.RGBA {
+	pad := tp.stroke
+	m := face.Metrics()
+	lineHeight := m.Height
+	if lineHeight == 0 {
+		lineHeight = m.Ascent + m.Descent
+	}
+	blockHeight := lineHeight * fixed.Int26_6(len(lines))
+	top := fixed.I(pad)
+	switch tp.valign {
+	case "middle":
+		top += (fixed.I(height) - blockHeight) / 2
+	case "bottom":
+		top += fixed.I(height) - blockHeight
+	}
+
+	dots := make([]fixed.Point26_6, len(lines))
+	var ink fixed.Rectangle26_6
+	for i, line := range lines {
+		x := fixed.I(pad)
+		switch tp.align {
+		case "center":
+			x += (fixed.I(width) - font.MeasureString(face, line)) / 2
+		case "right":
+			x += fixed.I(width) - font.MeasureString(face, line)
+		}
+		dots[i] = fixed.Point26_6{X: x, Y: top + m.Ascent + lineHeight*fixed.Int26_6(i)}
+		bounds, _ := font.BoundString(face, line)
+		ink = ink.Union(bounds.Add(dots[i]))
+	}
+
+	if ink.Empty() {
+		return nil
+	}
+	// Text outside the padded box is clipped, as it would be by the box
+	r := image.Rect(ink.Min.X.Floor(), ink.Min.Y.Floor(), ink.Max.X.Ceil(), ink.Max.Y.Ceil())
+	r = r.Inset(-pad).Intersect(image.Rect(0, 0, width+2*pad, height+2*pad))
+	if r.Empty() {
+		return nil
+	}
+
+	mask := image.NewAlpha(r)
+	d := font.Drawer{Dst: mask, Src: image.Opaque, Face: face}
+	for i, line := range lines {
+		d.Dot = dots[i]
+		d.DrawString(line)
+	}
+
+	layer := image.NewRGBA(r)
+	if tp.stroke > 0 {
+		outline := dilate(mask, tp.stroke)
+		draw.DrawMask(layer, r, image.NewUniform(tp.strokeColor), image.Point{}, outline, r.Min, draw.Over)
+	}
+	draw.DrawMask(layer, r, image.NewUniform(tp.color), image.Point{}, mask, r.Min, draw.Over)
+	return layer
+}
+
+// dilate grows a mask by radius pixels. Steps alternate between the 4- and
+// 8-neighbourhood, approximating a round pen with an octagon.
+func dilate(mask *image.Alpha, radius int) *image.Alpha {
+	w, h := mask.Rect.Dx(), mask.Rect.Dy()
+	src := slices.Clone(mask.Pix)
+	for step := 0; step < radius; step++ {
+		diagonal := step%2 == 1
+		dst := make([]uint8, len(src))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				v := src[y*w+x]
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						if dx != 0 && dy != 0 && !diagonal {
+							continue
+						}
+						nx, ny := x+dx, y+dy
+						if nx >= 0 && ny >= 0 && nx < w && ny < h {
+							v = max(v, src[ny*w+nx])
+						}
+					}
+				}
+				dst[y*w+x] = v
+			}
+		}
+		src = dst
+	}
+	return &image.Alpha{Pix: src, Stride: w, Rect: mask.Rect}
+}
+
+func parseTextParams(params map[string]interface{}) (textParams, error) {
+	var tp textParams
+	var err error
+	if tp.text, err = paramString(params, "text", ""); err != nil {
+		return tp, err
+	}
+	if strings.TrimSpace(tp.text) == "" {
+		return tp, fmt.Errorf("text parameter is required")
+	}
+	if n := utf8.RuneCountInString(tp.text); n > MaxTextLength {
+		return tp, fmt.Errorf("text cannot be longer than %d characters", MaxTextLength)
+	}
+
+	if tp.font, err = paramString(params, "font", "go-regular"); err != nil {
+		return tp, err
+	}
+	if _, ok := embeddedFontData[tp.font]; !ok {
+		return tp, fmt.Errorf("unknown font %q: use one of %s, or font_key", tp.font, strings.Join(slices.Sorted(maps.Keys(embeddedFontData)), ", "))
+	}
+	if tp.fontKey, err = paramString(params, "font_key", ""); err != nil {
+		return tp, err
+	}
+	if _, ok := params["font"]; ok && tp.fontKey != "" {
+		return tp, fmt.Errorf("font and font_key cannot be used together")
+	}
+	if tp.fontKey != "" {
+		if err := validateObjectKey(tp.fontKey, FontPrefix); err != nil {
+			return tp, fmt.Errorf("font_key: %w", err)
+		}
+	}
+
+	if tp.size, err = paramFloatOr(params, "size", 32); err != nil {
+		return tp, err
+	}
+	if err := validation.ValidateRange(tp.size, 4, 512, "size"); err != nil {
+		return tp, err
+	}
+	if tp.color, err = paramColor(params, "color", "#000000"); err != nil {
+		return tp, err
+	}
+
+	stroke, _, err := paramOptionalInt(params, "stroke_width")
+	if err != nil {
+		return tp, err
+	}
+	if stroke < 0 || stroke > maxStrokeWidth {
+		return tp, fmt.Errorf("stroke_width must be between 0 and %d", maxStrokeWidth)
+	}
+	tp.stroke = stroke
+	if tp.strokeColor, err = paramColor(params, "stroke_color", "#ffffff"); err != nil {
+		return tp, err
+	}
+
+	if tp.align, err = paramString(params, "align", "left"); err != nil {
+		return tp, err
+	}
+	if !slices.Contains(validation.TextAlignments, tp.align) {
+		return tp, fmt.Errorf("align must be one of %s", strings.Join(validation.TextAlignments, ", "))
+	}
+	if tp.valign, err = paramString(params, "valign", "top"); err != nil {
+		return tp, err
+	}
+	if !slices.Contains(validation.TextVerticalAlignments, tp.valign) {
+		return tp, fmt.Errorf("valign must be one of %s", strings.Join(validation.TextVerticalAlignments, ", "))
+	}
+
+	if tp.angle, err = paramFloatOr(params, "angle", 0); err != nil {
+		return tp, err
+	}
+	if err := validation.ValidateRange(tp.angle, -360, 360, "angle"); err != nil {
+		return tp, err
+	}
+	if tp.angle = math.Mod(tp.angle, 360); tp.angle < 0 {
+		tp.angle += 360
+	}
+
+	if _, _, err := paramRegion(params); err != nil {
+		return tp, err
+	}
+	return tp, nil
+}
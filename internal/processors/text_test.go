@@ -0,0 +1,371 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+	"github.com/mohammed-ysn/cluster-imager/pkg/storage"
+)
+
+// inkBounds returns the smallest rectangle holding every pixel that differs
+// from white
+func inkBounds(img image.Image) image.Rectangle {
+	var ink image.Rectangle
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if color.NRGBAModel.Convert(img.At(x, y)) != white {
+				ink = ink.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return ink
+}
+
+func TestTextProcessor_Name(t *testing.T) {
+	p := NewTextProcessor(storage.NewMemoryStorage())
+	if p.Name() != "text" {
+		t.Errorf("Expected name 'text', got '%s'", p.Name())
+	}
+}
+
+func TestTextProcessor_ValidateParams(t *testing.T) {
+	p := NewTextProcessor(storage.NewMemoryStorage())
+
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		wantErr bool
+	}{
+		{"text only", map[string]interface{}{"text": "Hello"}, false},
+		{"all params", map[string]interface{}{
+			"text": "Hello", "font": "go-bold", "size": 48, "color": "#ff0000",
+			"stroke_width": 2, "stroke_color": "#000", "align": "center", "valign": "middle",
+			"angle": -15, "x": 0, "y": 0, "width": 100, "height": 50,
+		}, false},
+		{"font key", map[string]interface{}{"text": "Hello", "font_key": "fonts/brand.ttf"}, false},
+		{"missing text", map[string]interface{}{}, true},
+		{"blank text", map[string]interface{}{"text": "  \n"}, true},
+		{"text too long", map[string]interface{}{"text": strings.Repeat("a", MaxTextLength+1)}, true},
+		{"unknown font", map[string]interface{}{"text": "Hello", "font": "comic-sans"}, true},
+		{"font key outside storage", map[string]interface{}{"text": "Hello", "font_key": "/etc/fonts/x.ttf"}, true},
+		{"font key outside fonts", map[string]interface{}{"text": "Hello", "font_key": "results/other.png"}, true},
+		{"font and font key", map[string]interface{}{"text": "Hello", "font": "go-bold", "font_key": "fonts/brand.ttf"}, true},
+		{"size too small", map[string]interface{}{"text": "Hello", "size": 2}, true},
+		{"invalid colour", map[string]interface{}{"text": "Hello", "color": "red"}, true},
+		{"stroke too wide", map[string]interface{}{"text": "Hello", "stroke_width": 50}, true},
+		{"unknown align", map[string]interface{}{"text": "Hello", "align": "justify"}, true},
+		{"unknown valign", map[string]interface{}{"text": "Hello", "valign": "center"}, true},
+		{"angle out of range", map[string]interface{}{"text": "Hello", "angle": 400}, true},
+		{"partial box", map[string]interface{}{"text": "Hello", "x": 0, "y": 0}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.ValidateParams(tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTextProcessor_ValidateDimensions(t *testing.T) {
+	p := NewTextProcessor(storage.NewMemoryStorage())
+
+	if err := p.ValidateDimensions(map[string]interface{}{"text": "Hi", "x": 0, "y": 0, "width": 100, "height": 50}, 100, 50); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := p.ValidateDimensions(map[string]interface{}{"text": "Hi", "x": 10, "y": 0, "width": 100, "height": 50}, 100, 50); err == nil {
+		t.Error("expected error for box outside image")
+	}
+}
+
+func TestTextProcessor_Process(t *testing.T) {
+	p := NewTextProcessor(storage.NewMemoryStorage())
+
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		check  func(t *testing.T, ink image.Rectangle)
+	}{
+		{
+			name:   "top left by default",
+			params: map[string]interface{}{"text": "Hello"},
+			check: func(t *testing.T, ink image.Rectangle) {
+				if ink.Min.X > 10 || ink.Min.Y > 20 || ink.Max.X > 150 {
+					t.Errorf("ink = %v, want near the top left", ink)
+				}
+			},
+		},
+		{
+			name:   "right aligned at the bottom",
+			params: map[string]interface{}{"text": "Hello", "align": "right", "valign": "bottom"},
+			check: func(t *testing.T, ink image.Rectangle) {
+				if ink.Max.X < 390 || ink.Min.X < 200 || ink.Max.Y < 180 {
+					t.Errorf("ink = %v, want near the bottom right", ink)
+				}
+			},
+		},
+		{
+			name:   "centred in a box",
+			params: map[string]interface{}{"text": "Hi", "align": "center", "valign": "middle", "x": 200, "y": 100, "width": 200, "height": 100},
+			check: func(t *testing.T, ink image.Rectangle) {
+				if !ink.In(image.Rect(200, 100, 400, 200)) {
+					t.Errorf("ink = %v, want within the box", ink)
+				}
+				if c := ink.Min.Add(ink.Max).Div(2); c.X < 290 || c.X > 310 || c.Y < 140 || c.Y > 160 {
+					t.Errorf("ink centre = %v, want about (300,150)", c)
+				}
+			},
+		},
+		{
+			name:   "wrapped",
+			params: map[string]interface{}{"text": "one two three four five six", "x": 0, "y": 0, "width": 120, "height": 200},
+			check: func(t *testing.T, ink image.Rectangle) {
+				if ink.Max.X > 120 || ink.Dy() < 100 {
+					t.Errorf("ink = %v, want several lines within 120px", ink)
+				}
+			},
+		},
+		{
+			name:   "rotated",
+			params: map[string]interface{}{"text": "Sideways", "angle": 90, "align": "center", "valign": "middle"},
+			check: func(t *testing.T, ink image.Rectangle) {
+				if ink.Dy() <= ink.Dx() {
+					t.Errorf("ink = %v, want taller than wide", ink)
+				}
+			},
+		},
+		{
+			name:   "turned about the box centre",
+			params: map[string]interface{}{"text": "Hello", "angle": 180, "stroke": 2},
+			check: func(t *testing.T, ink image.Rectangle) {
+				if ink.Max.X < 390 || ink.Min.X < 250 || ink.Max.Y < 190 || ink.Min.Y < 150 {
+					t.Errorf("ink = %v, want the top left text turned to the bottom right", ink)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := p.Process(context.Background(), uniform(400, 200, white), tt.params)
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			if result.Bounds() != image.Rect(0, 0, 400, 200) {
+				t.Fatalf("bounds = %v", result.Bounds())
+			}
+			ink := inkBounds(result)
+			if ink.Empty() {
+				t.Fatal("no text drawn")
+			}
+			tt.check(t, ink)
+		})
+	}
+}
+
+func TestRenderText_LayerFitsText(t *testing.T) {
+	face, err := opentype.NewFace(embeddedFonts()["go-regular"], &opentype.FaceOptions{Size: 20, DPI: 72})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer face.Close()
+
+	tp := textParams{size: 20, color: red, stroke: 3, strokeColor: white, align: "center", valign: "middle"}
+	layer := renderText(face, []string{"Hi"}, tp, 4000, 3000)
+	if layer == nil {
+		t.Fatal("renderText() = nil, want a layer")
+	}
+	if b := layer.Bounds(); b.Dx() > 60 || b.Dy() > 40 {
+		t.Errorf("layer bounds = %v, want only the text and its stroke", b)
+	}
+	if c := layer.Bounds().Min.Add(layer.Bounds().Max).Div(2); c.X < 1980 || c.X > 2020 || c.Y < 1480 || c.Y > 1520 {
+		t.Errorf("layer centre = %v, want about the centre of the padded box (2003,1503)", c)
+	}
+
+	if layer := renderText(face, []string{" ", ""}, tp, 400, 300); layer != nil {
+		t.Errorf("renderText() = %v, want nil when no glyph has ink", layer.Bounds())
+	}
+}
+
+func TestTextProcessor_ColourAndStroke(t *testing.T) {
+	p := NewTextProcessor(storage.NewMemoryStorage())
+
+	result, err := p.Process(context.Background(), uniform(200, 100, white), map[string]interface{}{
+		"text": "O", "size": 80, "color": "#0000ff", "stroke_width": 4, "stroke_color": "#ff0000",
+	})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	var fill, stroke bool
+	b := result.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			switch color.NRGBAModel.Convert(result.At(x, y)) {
+			case color.NRGBA{B: 255, A: 255}:
+				fill = true
+			case red:
+				stroke = true
+			}
+		}
+	}
+	if !fill || !stroke {
+		t.Errorf("found fill = %v, stroke = %v; want both", fill, stroke)
+	}
+}
+
+func TestTextProcessor_StoredFont(t *testing.T) {
+	stor := storage.NewMemoryStorage()
+	ctx := context.Background()
+	if err := stor.Upload(ctx, "fonts/mono.ttf", bytes.NewReader(gomono.TTF), "font/ttf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := stor.Upload(ctx, "fonts/broken.ttf", bytes.NewBufferString("not a font"), "font/ttf"); err != nil {
+		t.Fatal(err)
+	}
+	p := NewTextProcessor(stor)
+
+	result, err := p.Process(context.Background(), uniform(200, 50, white), map[string]interface{}{"text": "mono", "font_key": "fonts/mono.ttf"})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if inkBounds(result).Empty() {
+		t.Error("no text drawn")
+	}
+
+	tests := []struct {
+		key      string
+		wantCode job.ErrorCode
+	}{
+		{"fonts/missing.ttf", job.CodeInputNotFound},
+		{"fonts/broken.ttf", job.CodeInvalidParameters},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			_, err := p.Process(context.Background(), uniform(200, 50, white), map[string]interface{}{"text": "mono", "font_key": tt.key})
+			if !errors.Is(err, job.ErrPermanent) || job.CodeOf(err) != tt.wantCode {
+				t.Errorf("error = %v (code %s), want permanent %s", err, job.CodeOf(err), tt.wantCode)
+			}
+		})
+	}
+
+	if refs := p.References(map[string]interface{}{"text": "mono", "font_key": "fonts/mono.ttf"}); len(refs) != 1 || refs[0] != "fonts/mono.ttf" {
+		t.Errorf("References() = %v", refs)
+	}
+	if refs := p.References(map[string]interface{}{"text": "mono"}); len(refs) != 0 {
+		t.Errorf("References() = %v, want none for an embedded font", refs)
+	}
+}
+
+// countingStorage counts downloads and, like a networked backend, fails
+// them once ctx is done
+type countingStorage struct {
+	storage.Storage
+	downloads int
+}
+
+func (s *countingStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.downloads++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.Storage.Download(ctx, key)
+}
+
+func TestTextProcessor_CachesStoredFont(t *testing.T) {
+	stor := &countingStorage{Storage: storage.NewMemoryStorage()}
+	ctx := context.Background()
+	upload := func(font []byte) {
+		t.Helper()
+		if err := stor.Upload(ctx, "fonts/custom.ttf", bytes.NewReader(font), "font/ttf"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := NewTextProcessor(stor)
+	params := map[string]interface{}{"text": "cached", "font_key": "fonts/custom.ttf"}
+
+	upload(gomono.TTF)
+	for range 2 {
+		if _, err := p.Process(ctx, uniform(200, 50, white), params); err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+	}
+	if stor.downloads != 1 {
+		t.Errorf("downloads = %d, want the parsed font reused", stor.downloads)
+	}
+
+	// Replacing the font changes its ETag
+	upload(goregular.TTF)
+	if _, err := p.Process(ctx, uniform(200, 50, white), params); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if stor.downloads != 2 {
+		t.Errorf("downloads = %d, want the replaced font read again", stor.downloads)
+	}
+}
+
+func TestTextProcessor_StoredFontCancelled(t *testing.T) {
+	stor := &countingStorage{Storage: storage.NewMemoryStorage()}
+	if err := stor.Upload(context.Background(), "fonts/mono.ttf", bytes.NewReader(gomono.TTF), "font/ttf"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewTextProcessor(stor).Process(ctx, uniform(200, 50, white), map[string]interface{}{"text": "mono", "font_key": "fonts/mono.ttf"})
+	if err == nil || errors.Is(err, job.ErrPermanent) {
+		t.Errorf("error = %v, want a transient error for a cancelled job", err)
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	face, err := opentype.NewFace(embeddedFonts()["go-mono"], &opentype.FaceOptions{Size: 10, DPI: 72})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer face.Close()
+
+	// Go Mono advances 6px per character at 10pt
+	tests := []struct {
+		name  string
+		text  string
+		width int
+		want  []string
+	}{
+		{"fits", "short line", 100, []string{"short line"}},
+		{"wraps between words", "the quick brown fox", 60, []string{"the quick", "brown fox"}},
+		{"keeps newlines", "one\n\ntwo", 100, []string{"one", "", "two"}},
+		{"splits long words", "abcdefghijkl", 30, []string{"abcde", "fghij", "kl"}},
+		{"narrower than a character", "ab", 3, []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wrapText(face, tt.text, tt.width)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("wrapText() = %q, want %q", got, tt.want)
+			}
+			for _, line := range got {
+				if w := font.MeasureString(face, line); w > fixed.I(tt.width) && len([]rune(line)) > 1 {
+					t.Errorf("line %q is %v wide, limit %d", line, w, tt.width)
+				}
+			}
+		})
+	}
+}
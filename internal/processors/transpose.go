@@ -0,0 +1,29 @@
+package processors
+
+import (
+	"context"
+	"image"
+)
+
+// TransposeProcessor mirrors an image across its top-left to bottom-right
+// diagonal, swapping width and height. It takes no parameters.
+type TransposeProcessor struct{}
+
+func NewTransposeProcessor() *TransposeProcessor {
+	return &TransposeProcessor{}
+}
+
+func (p *TransposeProcessor) Process(_ context.Context, img image.Image, _ map[string]interface{}) (image.Image, error) {
+	return transpose(img), nil
+}
+
+func (p *TransposeProcessor) ValidateParams(_ map[string]interface{}) error {
+	return nil
+}
+
+// OutputSize swaps width and height
+func (p *TransposeProcessor) OutputSize(_ map[string]interface{}, width, height int) (int, int, error) {
+	return height, width, nil
+}
+
+func (p *TransposeProcessor) Name() string { return "transpose" }
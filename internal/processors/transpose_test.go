@@ -0,0 +1,37 @@
+package processors
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestTransposeProcessor_Name(t *testing.T) {
+	p := NewTransposeProcessor()
+	if p.Name() != "transpose" {
+		t.Errorf("Expected name 'transpose', got '%s'", p.Name())
+	}
+}
+
+func TestTransposeProcessor_Process(t *testing.T) {
+	p := NewTransposeProcessor()
+
+	marked := color.NRGBA{R: 255, A: 255}
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	img.SetNRGBA(3, 0, marked)
+
+	if err := p.ValidateParams(map[string]interface{}{}); err != nil {
+		t.Fatalf("ValidateParams() error = %v", err)
+	}
+	result, err := p.Process(context.Background(), img, nil)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if result.Bounds().Dx() != 2 || result.Bounds().Dy() != 4 {
+		t.Errorf("expected 2x4, got %dx%d", result.Bounds().Dx(), result.Bounds().Dy())
+	}
+	if c := color.NRGBAModel.Convert(result.At(0, 3)); c != marked {
+		t.Errorf("pixel (0,3) = %v, want marked", c)
+	}
+}
@@ -0,0 +1,206 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"slices"
+
+	"github.com/mohammed-ysn/cluster-imager/internal/decoder"
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+	"github.com/mohammed-ysn/cluster-imager/pkg/storage"
+	"github.com/mohammed-ysn/cluster-imager/pkg/validation"
+)
+
+const (
+	// maxOverlaySize bounds the encoded size of an overlay image
+	maxOverlaySize = 20 << 20
+
+	// maxOverlayPixels bounds the decoded size of an overlay image, so that
+	// its memory can be estimated before it is read
+	maxOverlayPixels = 4_000_000
+)
+
+// WatermarkProcessor composites a stored overlay image onto the input. The
+// overlay's alpha channel is respected.
+type WatermarkProcessor struct {
+	storage storage.Storage
+}
+
+func NewWatermarkProcessor(stor storage.Storage) *WatermarkProcessor {
+	return &WatermarkProcessor{storage: stor}
+}
+
+type watermarkParams struct {
+	overlay string // storage key of the overlay image
+	gravity string
+	margin  int     // pixels from the edges, and between tiles
+	scale   float64 // overlay width as a fraction of the input width, within its height; 0 keeps its size
+	opacity float64
+	tile    bool // repeat the overlay across the whole image
+}
+
+func (p *WatermarkProcessor) Process(ctx context.Context, img image.Image, params map[string]interface{}) (image.Image, error) {
+	wp, err := parseWatermarkParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	overlay, err := p.loadOverlay(ctx, wp.overlay)
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	if wp.scale > 0 {
+		ob := overlay.Bounds()
+		w, h := scaledOverlaySize(wp.scale, ob.Dx(), ob.Dy(), b.Dx(), b.Dy())
+		overlay = scale(overlay, w, h, validation.ResizeParams{Filter: "lanczos2"})
+	}
+	layer := toNRGBA(overlay)
+
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), img, b.Min, draw.Src)
+
+	var mask image.Image
+	if wp.opacity < 1 {
+		mask = image.NewUniform(color.Alpha{A: uint8(math.Round(wp.opacity * 255))})
+	}
+
+	if wp.tile {
+		layer = tileLayer(layer, b.Dx(), b.Dy(), wp.margin)
+		draw.DrawMask(out, out.Bounds(), layer, image.Point{}, mask, image.Point{}, draw.Over)
+		return out, nil
+	}
+
+	lw, lh := layer.Bounds().Dx(), layer.Bounds().Dy()
+	x, y := gravityOffset(wp.gravity, b.Dx()-lw-2*wp.margin, b.Dy()-lh-2*wp.margin)
+	r := image.Rect(x+wp.margin, y+wp.margin, x+wp.margin+lw, y+wp.margin+lh)
+	draw.DrawMask(out, r, layer, image.Point{}, mask, image.Point{}, draw.Over)
+	return out, nil
+}
+
+func (p *WatermarkProcessor) ValidateParams(params map[string]interface{}) error {
+	_, err := parseWatermarkParams(params)
+	return err
+}
+
+// WorkingMemory counts the decoded overlay at the largest size allowed and its
+// 8-bit copy, and a tiled layer the size of the input. A scaled overlay is at
+// most scale of the input's width and all of its height; the resampler's
+// intermediate has its width and the overlay's height.
+func (p *WatermarkProcessor) WorkingMemory(params map[string]interface{}, width, height int) int64 {
+	wp, err := parseWatermarkParams(params)
+	if err != nil {
+		return 0
+	}
+	n := int64(maxOverlayPixels) * wideBytesPerPixel
+	if wp.scale > 0 {
+		w := int64(max(1, int(math.Round(float64(width)*wp.scale))))
+		// A downscaled overlay's intermediate is at most the overlay's size;
+		// an enlarged one's is at most the scaled size
+		n += int64(maxOverlayPixels)*wideBytesPerPixel + w*int64(height)*(2*wideBytesPerPixel+rgbaBytesPerPixel)
+	} else {
+		n += int64(maxOverlayPixels) * rgbaBytesPerPixel
+	}
+	if wp.tile {
+		n += imageBytes(width, height)
+	}
+	return n
+}
+
+// References returns the overlay key
+func (p *WatermarkProcessor) References(params map[string]interface{}) []string {
+	wp, err := parseWatermarkParams(params)
+	if err != nil {
+		return nil
+	}
+	return []string{wp.overlay}
+}
+
+func (p *WatermarkProcessor) Name() string { return "watermark" }
+
+// loadOverlay downloads and decodes an overlay. An undecodable, oversized or
+// unsupported overlay fails permanently.
+func (p *WatermarkProcessor) loadOverlay(ctx context.Context, key string) (image.Image, error) {
+	data, err := downloadObject(ctx, p.storage, key, "overlay", maxOverlaySize)
+	if err != nil {
+		return nil, err
+	}
+	overlay, _, err := decoder.Decode(data, decoder.Limits{MaxPixels: maxOverlayPixels})
+	if err != nil {
+		return nil, job.Permanent(decoder.Code(err), fmt.Errorf("decode overlay: %w", err))
+	}
+	return overlay, nil
+}
+
+// scaledOverlaySize returns the size of an ow x oh overlay scaled to scale of
+// a width x height image's width, but no taller than the image
+func scaledOverlaySize(scale float64, ow, oh, width, height int) (int, int) {
+	ratio := math.Min(float64(width)*scale/float64(ow), float64(height)/float64(oh))
+	return max(1, int(math.Round(float64(ow)*ratio))), max(1, int(math.Round(float64(oh)*ratio)))
+}
+
+// tileLayer repeats tile across a width x height layer, starting margin
+// pixels from the top left and leaving margin pixels between copies
+func tileLayer(tile *image.NRGBA, width, height, margin int) *image.NRGBA {
+	layer := image.NewNRGBA(image.Rect(0, 0, width, height))
+	tw, th := tile.Bounds().Dx(), tile.Bounds().Dy()
+	for y := margin; y < height; y += th + margin {
+		for x := margin; x < width; x += tw + margin {
+			draw.Draw(layer, image.Rect(x, y, x+tw, y+th), tile, image.Point{}, draw.Src)
+		}
+	}
+	return layer
+}
+
+func parseWatermarkParams(params map[string]interface{}) (watermarkParams, error) {
+	var wp watermarkParams
+	var err error
+	if wp.overlay, err = paramString(params, "overlay", ""); err != nil {
+		return wp, err
+	}
+	if wp.overlay == "" {
+		return wp, fmt.Errorf("overlay parameter is required")
+	}
+	if err := validateObjectKey(wp.overlay, OverlayPrefix); err != nil {
+		return wp, fmt.Errorf("overlay: %w", err)
+	}
+	if wp.gravity, err = paramString(params, "gravity", "south-east"); err != nil {
+		return wp, err
+	}
+	if !slices.Contains(validation.Gravities, wp.gravity) {
+		return wp, fmt.Errorf("unknown gravity %q", wp.gravity)
+	}
+
+	margin, _, err := paramOptionalInt(params, "margin")
+	if err != nil {
+		return wp, err
+	}
+	if margin < 0 || margin > validation.MaxImageDimension {
+		return wp, fmt.Errorf("margin must be between 0 and %d", validation.MaxImageDimension)
+	}
+	wp.margin = margin
+
+	if _, ok := params["scale"]; ok {
+		if wp.scale, err = paramFloat(params, "scale"); err != nil {
+			return wp, err
+		}
+		if err := validation.ValidateRange(wp.scale, 0.01, 1, "scale"); err != nil {
+			return wp, err
+		}
+	}
+	if wp.opacity, err = paramFloatOr(params, "opacity", 1); err != nil {
+		return wp, err
+	}
+	if err := validation.ValidateRange(wp.opacity, 0, 1, "opacity"); err != nil {
+		return wp, err
+	}
+	if wp.tile, err = paramBool(params, "tile"); err != nil {
+		return wp, err
+	}
+	return wp, nil
+}
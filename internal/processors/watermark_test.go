@@ -0,0 +1,243 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+	"github.com/mohammed-ysn/cluster-imager/pkg/storage"
+)
+
+var (
+	white = color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	red   = color.NRGBA{R: 255, A: 255}
+)
+
+// uniform returns a width x height image of a single colour
+func uniform(width, height int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+// storeOverlay returns storage holding img as a PNG under "overlays/logo"
+func storeOverlay(t *testing.T, img image.Image) storage.Storage {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	stor := storage.NewMemoryStorage()
+	if err := stor.Upload(context.Background(), "overlays/logo", &buf, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	return stor
+}
+
+func TestWatermarkProcessor_Name(t *testing.T) {
+	p := NewWatermarkProcessor(storage.NewMemoryStorage())
+	if p.Name() != "watermark" {
+		t.Errorf("Expected name 'watermark', got '%s'", p.Name())
+	}
+}
+
+func TestWatermarkProcessor_ValidateParams(t *testing.T) {
+	p := NewWatermarkProcessor(storage.NewMemoryStorage())
+
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		wantErr bool
+	}{
+		{"overlay only", map[string]interface{}{"overlay": "overlays/logo"}, false},
+		{"all params", map[string]interface{}{"overlay": "overlays/logo", "gravity": "north", "margin": 10, "scale": 0.2, "opacity": 0.5, "tile": true}, false},
+		{"missing overlay", map[string]interface{}{}, true},
+		{"empty overlay", map[string]interface{}{"overlay": ""}, true},
+		{"overlay outside storage", map[string]interface{}{"overlay": "../../etc/passwd"}, true},
+		{"overlay outside overlays", map[string]interface{}{"overlay": "results/other.png"}, true},
+		{"unknown gravity", map[string]interface{}{"overlay": "overlays/logo", "gravity": "up"}, true},
+		{"negative margin", map[string]interface{}{"overlay": "overlays/logo", "margin": -1}, true},
+		{"scale too large", map[string]interface{}{"overlay": "overlays/logo", "scale": 2}, true},
+		{"zero scale", map[string]interface{}{"overlay": "overlays/logo", "scale": 0}, true},
+		{"opacity out of range", map[string]interface{}{"overlay": "overlays/logo", "opacity": 1.5}, true},
+		{"wrong type for tile", map[string]interface{}{"overlay": "overlays/logo", "tile": "yes"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.ValidateParams(tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWatermarkProcessor_Process(t *testing.T) {
+	p := NewWatermarkProcessor(storeOverlay(t, uniform(4, 2, red)))
+
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		red    []image.Point // pixels expected to be covered
+		white  []image.Point // pixels expected to be untouched
+	}{
+		{
+			name:   "default south-east",
+			params: map[string]interface{}{},
+			red:    []image.Point{{16, 8}, {19, 9}},
+			white:  []image.Point{{15, 9}, {19, 7}, {0, 0}},
+		},
+		{
+			name:   "north-west with margin",
+			params: map[string]interface{}{"gravity": "north-west", "margin": 2},
+			red:    []image.Point{{2, 2}, {5, 3}},
+			white:  []image.Point{{1, 2}, {6, 3}, {2, 4}},
+		},
+		{
+			name:   "center",
+			params: map[string]interface{}{"gravity": "center"},
+			red:    []image.Point{{8, 4}, {11, 5}},
+			white:  []image.Point{{7, 4}, {12, 5}},
+		},
+		{
+			name:   "scaled to half the width",
+			params: map[string]interface{}{"gravity": "north-west", "scale": 0.5},
+			red:    []image.Point{{0, 0}, {9, 4}},
+			white:  []image.Point{{10, 0}, {0, 5}},
+		},
+		{
+			name:   "tiled",
+			params: map[string]interface{}{"tile": true, "margin": 1},
+			red:    []image.Point{{1, 1}, {4, 2}, {6, 4}, {19, 7}},
+			white:  []image.Point{{0, 0}, {5, 1}, {1, 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.params["overlay"] = "overlays/logo"
+			result, err := p.Process(context.Background(), uniform(20, 10, white), tt.params)
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			if result.Bounds() != image.Rect(0, 0, 20, 10) {
+				t.Fatalf("bounds = %v", result.Bounds())
+			}
+			for _, pt := range tt.red {
+				if got := color.NRGBAModel.Convert(result.At(pt.X, pt.Y)); got != red {
+					t.Errorf("pixel %v = %v, want overlay", pt, got)
+				}
+			}
+			for _, pt := range tt.white {
+				if got := color.NRGBAModel.Convert(result.At(pt.X, pt.Y)); got != white {
+					t.Errorf("pixel %v = %v, want base", pt, got)
+				}
+			}
+		})
+	}
+}
+
+func TestWatermarkProcessor_TallOverlay(t *testing.T) {
+	// Scaled to the full width, a 2x100 overlay would be 20x1000; it is
+	// fitted to the image's height instead
+	p := NewWatermarkProcessor(storeOverlay(t, uniform(2, 100, red)))
+	result, err := p.Process(context.Background(), uniform(20, 10, white), map[string]interface{}{
+		"overlay": "overlays/logo", "gravity": "north-west", "scale": 1,
+	})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := color.NRGBAModel.Convert(result.At(0, 9)); got != red {
+		t.Errorf("pixel (0, 9) = %v, want overlay", got)
+	}
+	if got := color.NRGBAModel.Convert(result.At(2, 0)); got != white {
+		t.Errorf("pixel (2, 0) = %v, want base", got)
+	}
+
+	if w, h := scaledOverlaySize(1, 1, 10000, 2000, 2000); w != 1 || h != 2000 {
+		t.Errorf("scaledOverlaySize() = %dx%d, want 1x2000", w, h)
+	}
+}
+
+func TestWatermarkProcessor_Alpha(t *testing.T) {
+	overlay := uniform(2, 1, red)
+	overlay.SetNRGBA(1, 0, color.NRGBA{R: 255, A: 0})
+	p := NewWatermarkProcessor(storeOverlay(t, overlay))
+
+	result, err := p.Process(context.Background(), uniform(2, 1, white), map[string]interface{}{"overlay": "overlays/logo", "opacity": 0.5})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	half := color.NRGBAModel.Convert(result.At(0, 0)).(color.NRGBA)
+	if half.R != 255 || half.G < 126 || half.G > 129 || half.A != 255 {
+		t.Errorf("half opacity pixel = %v, want pink", half)
+	}
+	if got := color.NRGBAModel.Convert(result.At(1, 0)); got != white {
+		t.Errorf("transparent overlay pixel changed base to %v", got)
+	}
+}
+
+func TestWatermarkProcessor_OverlayErrors(t *testing.T) {
+	stor := storage.NewMemoryStorage()
+	if err := stor.Upload(context.Background(), "overlays/text", bytes.NewBufferString("not an image"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := stor.Upload(context.Background(), "overlays/corrupt", bytes.NewBufferString("\x89PNG\r\n\x1a\ntruncated"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	var huge bytes.Buffer
+	if err := png.Encode(&huge, image.NewGray(image.Rect(0, 0, maxOverlayPixels/1000+1, 1000))); err != nil {
+		t.Fatal(err)
+	}
+	if err := stor.Upload(context.Background(), "overlays/huge", &huge, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	p := NewWatermarkProcessor(stor)
+
+	tests := []struct {
+		overlay  string
+		wantCode job.ErrorCode
+	}{
+		{"overlays/missing", job.CodeInputNotFound},
+		{"overlays/text", job.CodeUnsupportedFormat},
+		{"overlays/corrupt", job.CodeInvalidImage},
+		{"overlays/huge", job.CodeImageTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.overlay, func(t *testing.T) {
+			_, err := p.Process(context.Background(), uniform(4, 4, white), map[string]interface{}{"overlay": tt.overlay})
+			if !errors.Is(err, job.ErrPermanent) || job.CodeOf(err) != tt.wantCode {
+				t.Errorf("error = %v (code %s), want permanent %s", err, job.CodeOf(err), tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestReferences(t *testing.T) {
+	registry := DefaultRegistry()
+	if err := registry.Register("watermark", NewWatermarkProcessor(storage.NewMemoryStorage())); err != nil {
+		t.Fatal(err)
+	}
+	pipeline, _ := registry.Get("pipeline")
+
+	got := pipeline.(Referencer).References(map[string]interface{}{
+		"steps": []interface{}{
+			map[string]interface{}{"processor": "watermark", "params": map[string]interface{}{"overlay": "overlays/a"}},
+			map[string]interface{}{"processor": "grayscale"},
+			map[string]interface{}{"processor": "watermark", "params": map[string]interface{}{"overlay": "overlays/b", "tile": true}},
+		},
+	})
+	if len(got) != 2 || got[0] != "overlays/a" || got[1] != "overlays/b" {
+		t.Errorf("References() = %v, want [overlays/a overlays/b]", got)
+	}
+}
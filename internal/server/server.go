@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/mohammed-ysn/cluster-imager/internal/config"
+	"github.com/mohammed-ysn/cluster-imager/internal/decoder"
+	"github.com/mohammed-ysn/cluster-imager/internal/encoders"
 	"github.com/mohammed-ysn/cluster-imager/internal/handlers"
 	"github.com/mohammed-ysn/cluster-imager/internal/processors"
 	"github.com/mohammed-ysn/cluster-imager/internal/worker"
@@ -21,50 +23,88 @@ import (
 	"github.com/mohammed-ysn/cluster-imager/pkg/storage"
 )
 
-func StartServer() {
-	cfg := config.Load()
+func StartServer(cfg *config.Config) {
 	logger := logging.NewLogger(slog.LevelInfo)
-	logger.Info("initializing server")
 
-	stor, err := storage.NewLocalStorage(cfg.Storage.LocalPath)
+	runAPI := cfg.Mode == config.ModeAPI || cfg.Mode == config.ModeAll
+	runWorker := cfg.Mode == config.ModeWorker || cfg.Mode == config.ModeAll
+	if !runAPI && !runWorker {
+		logger.Error("unknown mode", "mode", cfg.Mode)
+		os.Exit(1)
+	}
+	// In-memory backends are not shared between processes, so the API and
+	// worker must run together.
+	usesMemory := cfg.Job.Store == "memory" || cfg.Queue.Type == "memory" || cfg.Storage.Type == "memory"
+	if usesMemory && cfg.Mode != config.ModeAll {
+		logger.Error("in-memory backends require mode all", "mode", cfg.Mode)
+		os.Exit(1)
+	}
+	logger.Info("initializing server", "mode", cfg.Mode)
+
+	stor, err := storage.New(storage.Config{
+		Type:       cfg.Storage.Type,
+		Endpoint:   cfg.Storage.Endpoint,
+		Bucket:     cfg.Storage.Bucket,
+		AccessKey:  cfg.Storage.AccessKey,
+		SecretKey:  cfg.Storage.SecretKey,
+		Region:     cfg.Storage.Region,
+		UseSSL:     cfg.Storage.UseSSL,
+		LocalPath:  cfg.Storage.LocalPath,
+		LocalFsync: cfg.Storage.LocalFsync,
+	})
 	if err != nil {
 		logger.Error("failed to init storage", "error", err)
 		os.Exit(1)
 	}
 
-	jobStore, err := job.NewRedisStore(cfg.Redis.URL, "jobs", cfg.Job.TTL)
+	jobStore, err := newJobStore(cfg)
 	if err != nil {
-		logger.Error("failed to connect to redis", "error", err)
+		logger.Error("failed to init job store", "error", err)
 		os.Exit(1)
 	}
 	defer jobStore.Close()
 
-	q, err := queue.NewNATSQueue(queue.Config{
-		URL:      cfg.NATS.URL,
-		Stream:   cfg.NATS.Stream,
-		Subject:  cfg.NATS.Subject,
-		Consumer: cfg.NATS.Consumer,
-		MaxRetry: cfg.NATS.MaxRetry,
-	})
+	q, err := newQueue(cfg)
 	if err != nil {
-		logger.Error("failed to connect to nats", "error", err)
+		logger.Error("failed to init queue", "error", err)
 		_ = jobStore.Close()
 		os.Exit(1)
 	}
 	defer q.Close()
 
 	registry := processors.DefaultRegistry()
+	if err := processors.RegisterStorageProcessors(registry, stor); err != nil {
+		logger.Error("failed to register processor", "error", err)
+		os.Exit(1)
+	}
+	encoderRegistry := encoders.DefaultRegistry()
 
-	w := worker.New(q, jobStore, stor, registry, logger)
-
-	h := handlers.New(logger, registry, jobStore, stor, q)
+	if err := decoder.ValidateFormats(cfg.Image.Formats); err != nil {
+		logger.Error("invalid ALLOWED_IMAGE_FORMATS", "error", err)
+		os.Exit(1)
+	}
+	limits := decoder.Limits{
+		MaxPixels:    cfg.Image.MaxPixels,
+		MaxDimension: cfg.Image.MaxDimension,
+		Formats:      cfg.Image.Formats,
+	}
+	h := handlers.New(logger, registry, encoderRegistry, jobStore, stor, q, limits, readinessChecks(jobStore, q, stor))
 
+	// Every mode serves health endpoints; only the API tier serves the API.
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /health/live", h.LiveHandler)
 	mux.HandleFunc("GET /health/ready", h.ReadyHandler)
-	mux.HandleFunc("POST /api/v1/crop", h.CropHandler)
-	mux.HandleFunc("POST /api/v1/resize", h.ResizeHandler)
-	mux.HandleFunc("GET /api/v1/jobs/{id}", h.JobStatusHandler)
+	if runAPI {
+		mux.HandleFunc("POST /api/v1/jobs", h.SubmitJobHandler)
+		mux.HandleFunc("POST /api/v1/crop", h.CropHandler)
+		mux.HandleFunc("POST /api/v1/resize", h.ResizeHandler)
+		mux.HandleFunc("POST /api/v1/rotate", h.RotateHandler)
+		mux.HandleFunc("POST /api/v1/flip", h.FlipHandler)
+		mux.HandleFunc("POST /api/v1/transpose", h.TransposeHandler)
+		mux.HandleFunc("GET /api/v1/jobs/{id}", h.JobStatusHandler)
+		mux.HandleFunc("GET /api/v1/jobs/{id}/result", h.JobResultHandler)
+		mux.HandleFunc("GET /api/v1/jobs/{id}/input", h.JobInputHandler)
+	}
 
 	handler := middleware.RequestLogging(logger)(mux)
 
@@ -79,18 +119,30 @@ func StartServer() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	go func() {
-		if err := w.Run(ctx); err != nil && ctx.Err() == nil {
-			logger.Error("worker error", "error", err)
-		}
-	}()
+	workerErrors := make(chan error, 1)
+	workerDone := make(chan struct{})
+	if runWorker {
+		w := worker.New(q, jobStore, stor, registry, encoderRegistry, logger, worker.Config{
+			Limits:       limits,
+			MemoryBudget: cfg.Worker.MemoryBudget,
+			MaxRetry:     cfg.NATS.MaxRetry,
+		})
+		go func() {
+			defer close(workerDone)
+			if err := w.Run(ctx); err != nil && ctx.Err() == nil {
+				workerErrors <- err
+			}
+		}()
+	} else {
+		close(workerDone)
+	}
 
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
 	serverErrors := make(chan error, 1)
 	go func() {
-		logger.Info("server started", "addr", srv.Addr)
+		logger.Info("server started", "addr", srv.Addr, "mode", cfg.Mode)
 		serverErrors <- srv.ListenAndServe()
 	}()
 
@@ -98,19 +150,101 @@ func StartServer() {
 	case err := <-serverErrors:
 		logger.Error("server error", "error", err)
 		os.Exit(1)
+	case err := <-workerErrors:
+		logger.Error("worker error", "error", err)
+		os.Exit(1)
 	case sig := <-shutdown:
 		logger.Info("shutdown signal received", "signal", sig)
-		cancel()
 
-		shutCtx, shutCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		shutCtx, shutCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 		defer shutCancel()
 
+		// Stop accepting requests first so no new jobs are published, then
+		// stop the worker and wait for it to finish its in-flight job.
 		if err := srv.Shutdown(shutCtx); err != nil {
 			logger.Error("graceful shutdown failed", "error", err)
 			if err := srv.Close(); err != nil {
 				logger.Error("forced close failed", "error", err)
 			}
 		}
+
+		cancel()
+		select {
+		case <-workerDone:
+		case <-shutCtx.Done():
+			logger.Error("worker did not stop before shutdown timeout")
+		}
 		logger.Info("server stopped")
 	}
 }
+
+// pinger is a backend that can check its connection
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// closableStore is a job.Store holding connections to release on shutdown
+type closableStore interface {
+	job.Store
+	pinger
+	Close() error
+}
+
+// pingableQueue is a queue.Queue that can check its connection
+type pingableQueue interface {
+	queue.Queue
+	pinger
+}
+
+// readinessChecks returns the checks for /health/ready. The API tier
+// stores uploads, creates jobs and publishes them; the worker tier consumes
+// jobs, updates them and stores results. Each therefore depends on all three
+// backends.
+func readinessChecks(jobs pinger, q pinger, stor storage.Storage) map[string]handlers.Check {
+	checks := map[string]handlers.Check{
+		"job_store": jobs.Ping,
+		"queue":     q.Ping,
+	}
+	if p, ok := stor.(pinger); ok {
+		checks["storage"] = p.Ping
+	}
+	return checks
+}
+
+// newJobStore creates the job store selected by cfg.Job.Store
+func newJobStore(cfg *config.Config) (closableStore, error) {
+	switch cfg.Job.Store {
+	case "redis":
+		return job.NewRedisStore(cfg.Redis.URL, "jobs", cfg.Job.TTL)
+	case "memory":
+		return job.NewMemoryStore(cfg.Job.TTL), nil
+	default:
+		return nil, fmt.Errorf("unknown job store %q", cfg.Job.Store)
+	}
+}
+
+// newQueue creates the queue selected by cfg.Queue.Type
+func newQueue(cfg *config.Config) (pingableQueue, error) {
+	qc := queue.Config{
+		URL:               cfg.NATS.URL,
+		Stream:            cfg.NATS.Stream,
+		Subject:           cfg.NATS.Subject,
+		Consumer:          cfg.NATS.Consumer,
+		MaxRetry:          cfg.NATS.MaxRetry,
+		DeadLetterStream:  cfg.NATS.DeadLetterStream,
+		DeadLetterSubject: cfg.NATS.DeadLetterSubject,
+		Concurrency:       cfg.Worker.Concurrency,
+		RetryBaseDelay:    cfg.NATS.RetryBaseDelay,
+		RetryMaxDelay:     cfg.NATS.RetryMaxDelay,
+		RetryJitter:       cfg.NATS.RetryJitter,
+	}
+
+	switch cfg.Queue.Type {
+	case "nats":
+		return queue.NewNATSQueue(qc)
+	case "memory":
+		return queue.NewMemoryQueue(qc), nil
+	default:
+		return nil, fmt.Errorf("unknown queue type %q", cfg.Queue.Type)
+	}
+}
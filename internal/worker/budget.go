@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// errOverBudget is returned for a job that needs more memory than the whole
+// budget, so could never run
+var errOverBudget = errors.New("exceeds worker memory budget")
+
+// memoryBudget bounds the estimated memory of the jobs a worker runs at once.
+// Jobs wait until enough of the budget is free.
+type memoryBudget struct {
+	limit int64 // 0 is unlimited
+
+	mu    sync.Mutex
+	used  int64
+	freed chan struct{} // closed, and replaced, whenever memory is released
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	return &memoryBudget{limit: limit, freed: make(chan struct{})}
+}
+
+// acquire reserves n bytes, waiting until they are available or ctx is done
+func (b *memoryBudget) acquire(ctx context.Context, n int64) error {
+	if b.limit <= 0 {
+		return nil
+	}
+	if n > b.limit {
+		return fmt.Errorf("needs about %d bytes, budget is %d: %w", n, b.limit, errOverBudget)
+	}
+
+	for {
+		b.mu.Lock()
+		if b.used+n <= b.limit {
+			b.used += n
+			b.mu.Unlock()
+			return nil
+		}
+		freed := b.freed
+		b.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release returns n bytes acquired earlier
+func (b *memoryBudget) release(n int64) {
+	if b.limit <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	close(b.freed)
+	b.freed = make(chan struct{})
+}
@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryBudget_Unlimited(t *testing.T) {
+	b := newMemoryBudget(0)
+	if err := b.acquire(context.Background(), 1<<40); err != nil {
+		t.Fatalf("unlimited budget refused: %v", err)
+	}
+	b.release(1 << 40)
+}
+
+func TestMemoryBudget_OverBudget(t *testing.T) {
+	b := newMemoryBudget(100)
+	if err := b.acquire(context.Background(), 101); !errors.Is(err, errOverBudget) {
+		t.Fatalf("expected errOverBudget, got %v", err)
+	}
+}
+
+func TestMemoryBudget_WaitsForRelease(t *testing.T) {
+	b := newMemoryBudget(100)
+	if err := b.acquire(context.Background(), 60); err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- b.acquire(context.Background(), 60) }()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("acquire should wait while the budget is used, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	b.release(60)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire did not proceed after release")
+	}
+}
+
+func TestMemoryBudget_Cancelled(t *testing.T) {
+	b := newMemoryBudget(100)
+	if err := b.acquire(context.Background(), 100); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.acquire(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
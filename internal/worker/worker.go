@@ -3,11 +3,16 @@ package worker
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
-	"image/jpeg"
+	"io"
 	"log/slog"
+	"time"
 
+	"github.com/mohammed-ysn/cluster-imager/internal/decoder"
+	"github.com/mohammed-ysn/cluster-imager/internal/encoders"
+	"github.com/mohammed-ysn/cluster-imager/internal/metadata"
 	"github.com/mohammed-ysn/cluster-imager/internal/processors"
 	"github.com/mohammed-ysn/cluster-imager/pkg/job"
 	"github.com/mohammed-ysn/cluster-imager/pkg/logging"
@@ -15,21 +20,47 @@ import (
 	"github.com/mohammed-ysn/cluster-imager/pkg/storage"
 )
 
+// encodeBytesPerPixel approximates the encoder's buffers for each output
+// pixel, e.g. the planes and coefficients of a progressive JPEG, and the
+// encoded bytes
+const encodeBytesPerPixel = 8
+
+// Config bounds the images a worker decodes and the memory its jobs use
+type Config struct {
+	Limits decoder.Limits
+
+	// MemoryBudget is the estimated memory, in bytes, that the jobs running
+	// at once may use. Zero is unlimited.
+	MemoryBudget int64
+
+	// MaxRetry is how many times the queue redelivers a job after a transient
+	// failure. A job is marked failed only once these are used up.
+	MaxRetry int
+}
+
 type Worker struct {
 	queue    queue.Consumer
 	jobs     job.Store
 	storage  storage.Storage
 	registry *processors.Registry
+	encoders *encoders.Registry
 	logger   *logging.Logger
+	limits   decoder.Limits
+	budget   *memoryBudget
+	maxRetry int
 }
 
-func New(q queue.Consumer, jobs job.Store, stor storage.Storage, registry *processors.Registry, logger *logging.Logger) *Worker {
+func New(q queue.Consumer, jobs job.Store, stor storage.Storage, registry *processors.Registry, encoderRegistry *encoders.Registry, logger *logging.Logger, cfg Config) *Worker {
 	return &Worker{
 		queue:    q,
 		jobs:     jobs,
 		storage:  stor,
 		registry: registry,
+		encoders: encoderRegistry,
 		logger:   logger,
+		limits:   cfg.Limits,
+		budget:   newMemoryBudget(cfg.MemoryBudget),
+		maxRetry: cfg.MaxRetry,
 	}
 }
 
@@ -40,22 +71,39 @@ func (w *Worker) Run(ctx context.Context) error {
 
 func (w *Worker) handle(ctx context.Context, j *job.Job) error {
 	log := w.logger.WithContext(ctx)
-	log.Info("processing job", "job_id", j.ID, "type", j.Type)
+	log.Info("processing job", "job_id", j.ID, "type", j.Type, "retry", j.Metadata.RetryCount)
+
+	// Delivered again after every attempt: workers stopped while handling it,
+	// so running it once more could stop this one too
+	if j.Metadata.RetryCount > w.maxRetry {
+		err := job.Permanent(job.CodeAbandoned, fmt.Errorf("no attempt finished in %d deliveries", j.Metadata.RetryCount))
+		log.Error("job abandoned", "job_id", j.ID, "error", err)
+		if updateErr := w.markFailed(ctx, j.ID, err); updateErr != nil {
+			log.Error("failed to update job status", "job_id", j.ID, "error", updateErr)
+		}
+		return err
+	}
 
-	if err := w.jobs.UpdateStatus(ctx, j.ID, job.StatusProcessing, nil, ""); err != nil {
+	if err := w.markProcessing(ctx, j); err != nil {
 		log.Error("failed to update job status", slog.String("job_id", j.ID), slog.Any("error", err))
 	}
 
 	result, err := w.process(ctx, j)
 	if err != nil {
-		log.Error("job failed", "job_id", j.ID, "error", err)
-		if updateErr := w.jobs.UpdateStatus(ctx, j.ID, job.StatusFailed, nil, err.Error()); updateErr != nil {
+		retry := !job.IsPermanent(err) && j.Metadata.RetryCount < w.maxRetry
+		log.Error("job failed", "job_id", j.ID, "error", err,
+			"code", job.CodeOf(err), "permanent", job.IsPermanent(err), "will_retry", retry)
+		mark := w.markFailed
+		if retry {
+			mark = w.markRetrying
+		}
+		if updateErr := mark(ctx, j.ID, err); updateErr != nil {
 			log.Error("failed to update job status", "job_id", j.ID, "error", updateErr)
 		}
 		return err
 	}
 
-	if err := w.jobs.UpdateStatus(ctx, j.ID, job.StatusCompleted, result, ""); err != nil {
+	if err := w.markCompleted(ctx, j.ID, result); err != nil {
 		log.Error("failed to update job status", "job_id", j.ID, "error", err)
 	}
 
@@ -63,45 +111,223 @@ func (w *Worker) handle(ctx context.Context, j *job.Job) error {
 	return nil
 }
 
+// markProcessing records that the job has started, along with the retry count
+// the queue derived from its delivery attempts.
+func (w *Worker) markProcessing(ctx context.Context, j *job.Job) error {
+	stored, err := w.jobs.Get(ctx, j.ID)
+	if err != nil {
+		return err
+	}
+
+	stored.Status = job.StatusProcessing
+	stored.Error = ""
+	stored.ErrorCode = ""
+	stored.Metadata.StartedAt = time.Now()
+	stored.Metadata.RetryCount = j.Metadata.RetryCount
+	return w.jobs.Update(ctx, stored)
+}
+
+// markCompleted records the result, clearing the error of any earlier attempt.
+func (w *Worker) markCompleted(ctx context.Context, id string, result *job.Result) error {
+	stored, err := w.jobs.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	stored.Status = job.StatusCompleted
+	stored.Result = result
+	stored.Error = ""
+	stored.ErrorCode = ""
+	stored.LastError = ""
+	stored.LastErrorCode = ""
+	stored.Metadata.CompletedAt = time.Now()
+	return w.jobs.Update(ctx, stored)
+}
+
+// markFailed records the failure reason and its machine-readable code.
+func (w *Worker) markFailed(ctx context.Context, id string, cause error) error {
+	stored, err := w.jobs.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	stored.Status = job.StatusFailed
+	stored.Error = cause.Error()
+	stored.ErrorCode = job.CodeOf(cause)
+	stored.LastError = ""
+	stored.LastErrorCode = ""
+	stored.Metadata.CompletedAt = time.Now()
+	return w.jobs.Update(ctx, stored)
+}
+
+// markRetrying returns a job the queue will redeliver to queued, recording
+// why the attempt failed.
+func (w *Worker) markRetrying(ctx context.Context, id string, cause error) error {
+	stored, err := w.jobs.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	stored.Status = job.StatusQueued
+	stored.LastError = cause.Error()
+	stored.LastErrorCode = job.CodeOf(cause)
+	return w.jobs.Update(ctx, stored)
+}
+
 func (w *Worker) process(ctx context.Context, j *job.Job) (*job.Result, error) {
 	rc, err := w.storage.Download(ctx, j.Input.StorageKey)
 	if err != nil {
-		return nil, fmt.Errorf("download input: %w", err)
+		err = fmt.Errorf("download input: %w", err)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, job.Permanent(job.CodeInputNotFound, err)
+		}
+		if errors.Is(err, storage.ErrInvalidKey) {
+			return nil, job.Permanent(job.CodeInvalidParameters, err)
+		}
+		return nil, job.Transient(job.CodeStorageUnavailable, err)
 	}
 	defer rc.Close()
 
-	img, _, err := image.Decode(rc)
+	data, err := io.ReadAll(rc)
 	if err != nil {
-		return nil, fmt.Errorf("decode image: %w", err)
+		return nil, job.Transient(job.CodeStorageUnavailable, fmt.Errorf("read input: %w", err))
+	}
+
+	// Check the declared size before decoding allocates for it
+	cfg, _, err := decoder.DecodeConfig(data, w.limits)
+	if err != nil {
+		return nil, decodeError(err)
+	}
+
+	// Metadata is best effort: an unreadable block is dropped, not fatal
+	meta, err := metadata.Extract(data)
+	if err != nil {
+		w.logger.WithContext(ctx).Warn("ignoring malformed metadata", "job_id", j.ID, "error", err)
 	}
 
 	proc, err := w.registry.Get(string(j.Type))
 	if err != nil {
-		return nil, fmt.Errorf("unknown processor %q: %w", j.Type, err)
+		return nil, job.Permanent(job.CodeUnknownProcessor, fmt.Errorf("unknown processor %q: %w", j.Type, err))
+	}
+
+	if err := proc.ValidateParams(j.Parameters); err != nil {
+		return nil, job.Permanent(job.CodeInvalidParameters, fmt.Errorf("invalid parameters: %w", err))
+	}
+
+	// A job waiting for memory still counts as progress: the queue reports
+	// it for as long as the handler runs
+	need := estimateMemory(cfg, meta.Orientation(), proc, j.Parameters)
+	if err := w.budget.acquire(ctx, need); err != nil {
+		if errors.Is(err, errOverBudget) {
+			return nil, job.Permanent(job.CodeImageTooLarge, fmt.Errorf("decode image: %w", err))
+		}
+		return nil, job.Transient(job.CodeInternal, fmt.Errorf("wait for memory: %w", err))
 	}
+	defer w.budget.release(need)
 
-	out, err := proc.Process(img, j.Parameters)
+	img, format, err := decoder.Decode(data, w.limits)
 	if err != nil {
-		return nil, fmt.Errorf("process image: %w", err)
+		return nil, decodeError(err)
+	}
+	img = processors.Orient(img, meta.Orientation())
+
+	out, steps, err := w.runSteps(ctx, img, j)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := w.encoders.ForOutput(j.Output, format)
+	if err != nil {
+		return nil, job.Permanent(job.CodeInvalidParameters, fmt.Errorf("invalid output: %w", err))
+	}
+	if err := enc.ValidateOptions(j.Output); err != nil {
+		return nil, job.Permanent(job.CodeInvalidParameters, fmt.Errorf("invalid output: %w", err))
+	}
+	if err := metadata.ValidateOptions(j.Output); err != nil {
+		return nil, job.Permanent(job.CodeInvalidParameters, fmt.Errorf("invalid output: %w", err))
 	}
 
 	var buf bytes.Buffer
-	if err := jpeg.Encode(&buf, out, nil); err != nil {
-		return nil, fmt.Errorf("encode result: %w", err)
+	if err := enc.Encode(&buf, out, j.Output); err != nil {
+		return nil, job.Permanent(job.CodeEncodeFailed, fmt.Errorf("encode result: %w", err))
+	}
+	kept := meta.Filter(j.Output)
+	for _, change := range kept.Fit(enc.Name(), out) {
+		w.logger.WithContext(ctx).Warn("adjusting metadata", "job_id", j.ID, "change", change)
+	}
+	encoded, err := metadata.Embed(buf.Bytes(), enc.Name(), kept)
+	if err != nil {
+		return nil, job.Permanent(job.CodeEncodeFailed, fmt.Errorf("embed metadata: %w", err))
 	}
 
-	resultKey := "results/" + j.ID + ".jpg"
-	size := int64(buf.Len())
-	if err := w.storage.Upload(ctx, resultKey, &buf, "image/jpeg"); err != nil {
-		return nil, fmt.Errorf("upload result: %w", err)
+	resultKey := "results/" + j.ID + "." + enc.Extension()
+	size := int64(len(encoded))
+	if err := w.storage.Upload(ctx, resultKey, bytes.NewReader(encoded), enc.ContentType()); err != nil {
+		return nil, job.Transient(job.CodeStorageUnavailable, fmt.Errorf("upload result: %w", err))
 	}
 
 	bounds := out.Bounds()
 	return &job.Result{
 		StorageKey: resultKey,
-		MimeType:   "image/jpeg",
+		MimeType:   enc.ContentType(),
 		Size:       size,
 		Width:      bounds.Dx(),
 		Height:     bounds.Dy(),
+		Steps:      steps,
 	}, nil
 }
+
+// runSteps applies the job's processing steps in order, timing each. Pipeline
+// jobs run their listed steps; any other job is a single step.
+func (w *Worker) runSteps(ctx context.Context, img image.Image, j *job.Job) (image.Image, []job.StepResult, error) {
+	steps := []processors.Step{{Processor: string(j.Type), Params: j.Parameters}}
+	if j.Type == job.TypePipeline {
+		var err error
+		if steps, err = processors.PipelineSteps(j.Parameters); err != nil {
+			return nil, nil, job.Permanent(job.CodeInvalidParameters, fmt.Errorf("invalid parameters: %w", err))
+		}
+	}
+
+	results := make([]job.StepResult, 0, len(steps))
+	img, err := processors.RunSteps(ctx, w.registry, img, steps, func(step processors.Step, out image.Image, elapsed time.Duration) {
+		bounds := out.Bounds()
+		results = append(results, job.StepResult{
+			Processor:  step.Processor,
+			DurationMs: float64(elapsed.Microseconds()) / 1000,
+			Width:      bounds.Dx(),
+			Height:     bounds.Dy(),
+		})
+	})
+	if err != nil {
+		return nil, nil, classify(job.CodeProcessingFailed, fmt.Errorf("process image: %w", err))
+	}
+	return img, results, nil
+}
+
+// estimateMemory approximates the memory a job holds at its peak: the decoded
+// image and its oriented copy, what the processor allocates, and the
+// encoder's buffers for the output
+func estimateMemory(cfg image.Config, orientation int, proc processors.Processor, params map[string]interface{}) int64 {
+	width, height := processors.OrientedSize(cfg.Width, cfg.Height, orientation)
+	n := decoder.EstimateMemory(cfg) + processors.OrientMemory(width, height, orientation) +
+		processors.Memory(proc, params, width, height)
+	if w, h, err := processors.OutputSize(proc, params, width, height); err == nil {
+		n += int64(w) * int64(h) * encodeBytesPerPixel
+	}
+	return n
+}
+
+// decodeError classifies a failure to decode the input
+func decodeError(err error) error {
+	return job.Permanent(decoder.Code(err), fmt.Errorf("decode image: %w", err))
+}
+
+// classify keeps the classification a processor chose, otherwise treating the
+// error as permanent: processing the same input again gives the same result.
+func classify(code job.ErrorCode, err error) error {
+	var jobErr *job.Error
+	if errors.As(err, &jobErr) {
+		return err
+	}
+	return job.Permanent(code, err)
+}
@@ -4,16 +4,25 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"image"
 	"image/jpeg"
+	"image/png"
 	"io"
 	"log/slog"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/mohammed-ysn/cluster-imager/internal/decoder"
+	"github.com/mohammed-ysn/cluster-imager/internal/encoders"
+	"github.com/mohammed-ysn/cluster-imager/internal/metadata"
+	"github.com/mohammed-ysn/cluster-imager/internal/metadata/metadatatest"
 	"github.com/mohammed-ysn/cluster-imager/internal/processors"
 	"github.com/mohammed-ysn/cluster-imager/pkg/job"
 	"github.com/mohammed-ysn/cluster-imager/pkg/logging"
+	"github.com/mohammed-ysn/cluster-imager/pkg/storage"
+	"golang.org/x/image/tiff"
 )
 
 type mockJobStore struct {
@@ -41,7 +50,14 @@ func (m *mockJobStore) Get(_ context.Context, id string) (*job.Job, error) {
 	}
 	return j, nil
 }
-func (m *mockJobStore) Update(_ context.Context, _ *job.Job) error { return m.err }
+func (m *mockJobStore) Update(_ context.Context, j *job.Job) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.updates = append(m.updates, j.Status)
+	m.jobs[j.ID] = j
+	return nil
+}
 func (m *mockJobStore) UpdateStatus(_ context.Context, id string, status job.Status, _ *job.Result, _ string) error {
 	if m.err != nil {
 		return m.err
@@ -82,7 +98,7 @@ func (m *mockStorage) Download(_ context.Context, key string) (io.ReadCloser, er
 	}
 	b, ok := m.data[key]
 	if !ok {
-		return nil, errors.New("not found: " + key)
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
 	}
 	return io.NopCloser(bytes.NewReader(b)), nil
 }
@@ -92,6 +108,12 @@ func (m *mockStorage) GetURL(_ context.Context, _ string, _ time.Duration) (stri
 	return "", m.err
 }
 func (m *mockStorage) Exists(_ context.Context, _ string) (bool, error) { return false, m.err }
+func (m *mockStorage) Stat(_ context.Context, key string) (storage.Metadata, error) {
+	return storage.Metadata{}, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+}
+func (m *mockStorage) List(_ context.Context, _, _ string) (storage.ListResult, error) {
+	return storage.ListResult{}, m.err
+}
 
 func minimalJPEG(t *testing.T, width, height int) []byte {
 	t.Helper()
@@ -105,7 +127,11 @@ func minimalJPEG(t *testing.T, width, height int) []byte {
 
 func newWorker(jobs *mockJobStore, stor *mockStorage) *Worker {
 	logger := logging.NewLogger(slog.LevelError)
-	return New(nil, jobs, stor, processors.DefaultRegistry(), logger)
+	registry := processors.DefaultRegistry()
+	if err := processors.RegisterStorageProcessors(registry, stor); err != nil {
+		panic(err)
+	}
+	return New(nil, jobs, stor, registry, encoders.DefaultRegistry(), logger, Config{})
 }
 
 func TestHandle_ResizeSuccess(t *testing.T) {
@@ -172,12 +198,103 @@ func TestHandle_StorageDownloadFails(t *testing.T) {
 	jobs := newMockJobStore(j)
 	w := newWorker(jobs, stor)
 
-	if err := w.handle(context.Background(), j); err == nil {
-		t.Error("expected error, got nil")
+	err := w.handle(context.Background(), j)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if job.IsPermanent(err) {
+		t.Error("storage failure should be transient")
 	}
 	if j.Status != job.StatusFailed {
 		t.Errorf("expected status failed, got %s", j.Status)
 	}
+	if j.ErrorCode != job.CodeStorageUnavailable {
+		t.Errorf("expected error code %s, got %s", job.CodeStorageUnavailable, j.ErrorCode)
+	}
+}
+
+func TestHandle_TransientFailureRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		retryCount    int
+		wantStatus    job.Status
+		wantError     bool
+		wantLastError bool
+	}{
+		{"retries remain", 1, job.StatusQueued, false, true},
+		{"retries exhausted", 2, job.StatusFailed, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stor := newMockStorage()
+			stor.err = errors.New("storage down")
+
+			j := &job.Job{
+				ID:         "job3",
+				Type:       job.TypeResize,
+				Input:      job.Input{StorageKey: "inputs/job3"},
+				Parameters: map[string]any{"width": 50, "height": 50},
+				Metadata:   job.Metadata{RetryCount: tt.retryCount},
+			}
+			jobs := newMockJobStore(j)
+			w := newWorker(jobs, stor)
+			w.maxRetry = 2
+
+			if err := w.handle(context.Background(), j); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if j.Status != tt.wantStatus {
+				t.Errorf("expected status %s, got %s", tt.wantStatus, j.Status)
+			}
+			if (j.Error != "") != tt.wantError {
+				t.Errorf("unexpected error %q", j.Error)
+			}
+			if (j.LastError != "") != tt.wantLastError {
+				t.Errorf("unexpected last error %q", j.LastError)
+			}
+			if tt.wantLastError && j.LastErrorCode != job.CodeStorageUnavailable {
+				t.Errorf("expected last error code %s, got %s", job.CodeStorageUnavailable, j.LastErrorCode)
+			}
+		})
+	}
+}
+
+func TestHandle_RetryThenSucceed(t *testing.T) {
+	stor := newMockStorage()
+	stor.err = errors.New("storage down")
+	j := &job.Job{
+		ID:         "job7",
+		Type:       job.TypeResize,
+		Input:      job.Input{StorageKey: "inputs/job7"},
+		Parameters: map[string]any{"width": 5, "height": 5},
+	}
+	jobs := newMockJobStore(j)
+	w := newWorker(jobs, stor)
+	w.maxRetry = 2
+
+	if err := w.handle(context.Background(), j); err == nil {
+		t.Fatal("expected the first attempt to fail")
+	}
+	if j.LastError == "" {
+		t.Fatal("expected the failed attempt to be recorded")
+	}
+
+	stor.err = nil
+	stor.data["inputs/job7"] = minimalJPEG(t, 10, 10)
+	retry := *j
+	retry.Metadata.RetryCount = 1
+	if err := w.handle(context.Background(), &retry); err != nil {
+		t.Fatalf("retry error = %v", err)
+	}
+
+	got := jobs.jobs["job7"]
+	if got.Status != job.StatusCompleted || got.Result == nil {
+		t.Errorf("stored job = %s with result %v, want completed", got.Status, got.Result)
+	}
+	if got.LastError != "" || got.LastErrorCode != "" {
+		t.Errorf("completed job kept last error %q (%s)", got.LastError, got.LastErrorCode)
+	}
 }
 
 func TestHandle_UnknownProcessor(t *testing.T) {
@@ -193,10 +310,574 @@ func TestHandle_UnknownProcessor(t *testing.T) {
 	jobs := newMockJobStore(j)
 	w := newWorker(jobs, stor)
 
-	if err := w.handle(context.Background(), j); err == nil {
-		t.Error("expected error for unknown processor")
+	err := w.handle(context.Background(), j)
+	if err == nil {
+		t.Fatal("expected error for unknown processor")
+	}
+	if !job.IsPermanent(err) {
+		t.Error("unknown processor should be a permanent failure")
 	}
 	if j.Status != job.StatusFailed {
 		t.Errorf("expected status failed, got %s", j.Status)
 	}
+	if j.ErrorCode != job.CodeUnknownProcessor {
+		t.Errorf("expected error code %s, got %s", job.CodeUnknownProcessor, j.ErrorCode)
+	}
+}
+
+func TestHandle_PersistsRetryCount(t *testing.T) {
+	stor := newMockStorage()
+	stor.data["inputs/job5"] = minimalJPEG(t, 10, 10)
+
+	stored := &job.Job{
+		ID:         "job5",
+		Type:       job.TypeResize,
+		Status:     job.StatusFailed,
+		Error:      "previous attempt",
+		Input:      job.Input{StorageKey: "inputs/job5"},
+		Parameters: map[string]any{"width": 5, "height": 5},
+	}
+	jobs := newMockJobStore(stored)
+	w := newWorker(jobs, stor)
+	w.maxRetry = 2
+
+	delivered := *stored
+	delivered.Metadata.RetryCount = 2
+	if err := w.handle(context.Background(), &delivered); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := jobs.jobs["job5"].Metadata.RetryCount; got != 2 {
+		t.Errorf("expected retry count 2, got %d", got)
+	}
+	if len(jobs.updates) == 0 || jobs.updates[0] != job.StatusProcessing {
+		t.Errorf("expected first update to be processing, got %v", jobs.updates)
+	}
+}
+
+func TestHandle_Abandoned(t *testing.T) {
+	// The input is missing, so running the job would fail differently
+	stor := newMockStorage()
+	stored := &job.Job{
+		ID:     "job6",
+		Type:   job.TypeResize,
+		Status: job.StatusProcessing,
+		Input:  job.Input{StorageKey: "inputs/job6"},
+	}
+	jobs := newMockJobStore(stored)
+	w := newWorker(jobs, stor)
+	w.maxRetry = 2
+
+	delivered := *stored
+	delivered.Metadata.RetryCount = 3
+	if err := w.handle(context.Background(), &delivered); !job.IsPermanent(err) {
+		t.Errorf("handle() error = %v, want a permanent failure", err)
+	}
+
+	got := jobs.jobs["job6"]
+	if got.Status != job.StatusFailed || got.ErrorCode != job.CodeAbandoned {
+		t.Errorf("stored job = %s (%s), want failed with %s", got.Status, got.ErrorCode, job.CodeAbandoned)
+	}
+}
+
+func TestHandle_PermanentFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		params   map[string]any
+		wantCode job.ErrorCode
+	}{
+		{
+			name:     "undecodable image",
+			input:    []byte("\x89PNG\r\n\x1a\ntruncated"),
+			params:   map[string]any{"x": 0, "y": 0, "width": 5, "height": 5},
+			wantCode: job.CodeInvalidImage,
+		},
+		{
+			name:     "unsupported format",
+			input:    []byte("not an image"),
+			params:   map[string]any{"x": 0, "y": 0, "width": 5, "height": 5},
+			wantCode: job.CodeUnsupportedFormat,
+		},
+		{
+			name:     "missing input",
+			params:   map[string]any{"x": 0, "y": 0, "width": 5, "height": 5},
+			wantCode: job.CodeInputNotFound,
+		},
+		{
+			name:     "invalid parameters",
+			input:    minimalJPEG(t, 10, 10),
+			params:   map[string]any{"x": 0, "y": 0, "width": 0, "height": 5},
+			wantCode: job.CodeInvalidParameters,
+		},
+		{
+			name:     "crop outside bounds",
+			input:    minimalJPEG(t, 10, 10),
+			params:   map[string]any{"x": 8, "y": 8, "width": 5, "height": 5},
+			wantCode: job.CodeProcessingFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stor := newMockStorage()
+			if tt.input != nil {
+				stor.data["inputs/perm"] = tt.input
+			}
+			j := &job.Job{
+				ID:         "perm",
+				Type:       job.TypeCrop,
+				Input:      job.Input{StorageKey: "inputs/perm"},
+				Parameters: tt.params,
+			}
+			jobs := newMockJobStore(j)
+			w := newWorker(jobs, stor)
+
+			err := w.handle(context.Background(), j)
+			if !job.IsPermanent(err) {
+				t.Fatalf("expected permanent error, got %v", err)
+			}
+			if j.ErrorCode != tt.wantCode {
+				t.Errorf("expected error code %s, got %s", tt.wantCode, j.ErrorCode)
+			}
+		})
+	}
+}
+
+func TestHandle_ImageTooLarge(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"exceeds dimension limit", Config{Limits: decoder.Limits{MaxDimension: 50}}},
+		{"exceeds pixel limit", Config{Limits: decoder.Limits{MaxPixels: 5000}}},
+		{"exceeds memory budget", Config{MemoryBudget: 1000}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stor := newMockStorage()
+			stor.data["inputs/big"] = minimalJPEG(t, 100, 100)
+			j := &job.Job{
+				ID:         "big",
+				Type:       job.TypeResize,
+				Input:      job.Input{StorageKey: "inputs/big"},
+				Parameters: map[string]any{"width": 10, "height": 10},
+			}
+			jobs := newMockJobStore(j)
+			w := newWorker(jobs, stor)
+			w.limits, w.budget = tt.cfg.Limits, newMemoryBudget(tt.cfg.MemoryBudget)
+
+			err := w.handle(context.Background(), j)
+			if !job.IsPermanent(err) {
+				t.Fatalf("expected permanent error, got %v", err)
+			}
+			if j.ErrorCode != job.CodeImageTooLarge {
+				t.Errorf("expected error code %s, got %s", job.CodeImageTooLarge, j.ErrorCode)
+			}
+		})
+	}
+}
+
+func TestHandle_WorkingMemoryBudget(t *testing.T) {
+	// A 100x100 JPEG needs 30 KB decoded; a thumbnail adds little more.
+	// Enlarging adds the resampled images and the output and its encoding, and
+	// sharpening adds two floating-point copies of 160 KB each.
+	tests := []struct {
+		name     string
+		jobType  job.Type
+		params   map[string]any
+		wantFail bool
+	}{
+		{"resize fits", job.TypeResize, map[string]any{"width": 10, "height": 10}, false},
+		{"enlarging exceeds", job.TypeResize, map[string]any{"width": 200, "height": 200}, true},
+		{"sharpen exceeds", job.Type("sharpen"), map[string]any{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stor := newMockStorage()
+			stor.data["inputs/job1"] = minimalJPEG(t, 100, 100)
+			j := &job.Job{
+				ID:         "job1",
+				Type:       tt.jobType,
+				Input:      job.Input{StorageKey: "inputs/job1"},
+				Parameters: tt.params,
+			}
+			w := newWorker(newMockJobStore(j), stor)
+			w.budget = newMemoryBudget(200_000)
+
+			err := w.handle(context.Background(), j)
+			if failed := j.ErrorCode == job.CodeImageTooLarge; failed != tt.wantFail {
+				t.Errorf("failed for size = %v, want %v (error %v)", failed, tt.wantFail, err)
+			}
+		})
+	}
+}
+
+func TestProcess_Pipeline(t *testing.T) {
+	stor := newMockStorage()
+	stor.data["inputs/job1"] = minimalJPEG(t, 100, 80)
+
+	j := &job.Job{
+		ID:    "job1",
+		Type:  job.TypePipeline,
+		Input: job.Input{StorageKey: "inputs/job1"},
+		Parameters: map[string]any{
+			"steps": []any{
+				map[string]any{"processor": "crop", "params": map[string]any{"x": 10, "y": 0, "width": 60, "height": 60}},
+				map[string]any{"processor": "resize", "params": map[string]any{"width": 30, "height": 20}},
+			},
+		},
+	}
+	w := newWorker(newMockJobStore(j), stor)
+
+	result, err := w.process(context.Background(), j)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Width != 30 || result.Height != 20 {
+		t.Errorf("expected 30x20, got %dx%d", result.Width, result.Height)
+	}
+	if len(result.Steps) != 2 {
+		t.Fatalf("expected 2 steps, got %+v", result.Steps)
+	}
+	if s := result.Steps[0]; s.Processor != "crop" || s.Width != 60 || s.Height != 60 || s.DurationMs < 0 {
+		t.Errorf("step 1 = %+v", s)
+	}
+	if s := result.Steps[1]; s.Processor != "resize" || s.Width != 30 || s.Height != 20 {
+		t.Errorf("step 2 = %+v", s)
+	}
+	if len(stor.data) != 2 {
+		t.Errorf("expected only the input and the result in storage, got %d objects", len(stor.data))
+	}
+}
+
+func TestProcess_PipelineStepFails(t *testing.T) {
+	stor := newMockStorage()
+	stor.data["inputs/job1"] = minimalJPEG(t, 100, 100)
+
+	// The crop fits the input but not the output of the resize before it.
+	j := &job.Job{
+		ID:    "job1",
+		Type:  job.TypePipeline,
+		Input: job.Input{StorageKey: "inputs/job1"},
+		Parameters: map[string]any{
+			"steps": []any{
+				map[string]any{"processor": "resize", "params": map[string]any{"width": 20, "height": 20}},
+				map[string]any{"processor": "crop", "params": map[string]any{"x": 0, "y": 0, "width": 50, "height": 50}},
+			},
+		},
+	}
+	w := newWorker(newMockJobStore(j), stor)
+
+	_, err := w.process(context.Background(), j)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !job.IsPermanent(err) || job.CodeOf(err) != job.CodeProcessingFailed {
+		t.Errorf("expected permanent %s, got %v", job.CodeProcessingFailed, err)
+	}
+	if !strings.Contains(err.Error(), "step 2 (crop)") {
+		t.Errorf("expected error to name the failing step, got %q", err)
+	}
+}
+
+func TestProcess_Watermark(t *testing.T) {
+	stor := newMockStorage()
+	stor.data["inputs/job1"] = minimalJPEG(t, 100, 80)
+	stor.data["overlays/logo"] = minimalJPEG(t, 40, 10)
+
+	j := &job.Job{
+		ID:         "job1",
+		Type:       job.TypeWatermark,
+		Input:      job.Input{StorageKey: "inputs/job1"},
+		Parameters: map[string]any{"overlay": "overlays/logo", "scale": 0.2, "opacity": 0.5},
+	}
+	w := newWorker(newMockJobStore(j), stor)
+
+	result, err := w.process(context.Background(), j)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Width != 100 || result.Height != 80 {
+		t.Errorf("expected 100x80, got %dx%d", result.Width, result.Height)
+	}
+
+	// An overlay deleted after submission fails the job for good
+	delete(stor.data, "overlays/logo")
+	_, err = w.process(context.Background(), j)
+	if !job.IsPermanent(err) || job.CodeOf(err) != job.CodeInputNotFound {
+		t.Errorf("expected permanent %s, got %v", job.CodeInputNotFound, err)
+	}
+}
+
+func TestProcess_SingleStepTiming(t *testing.T) {
+	stor := newMockStorage()
+	stor.data["inputs/job1"] = minimalJPEG(t, 100, 100)
+
+	j := &job.Job{
+		ID:         "job1",
+		Type:       job.TypeResize,
+		Input:      job.Input{StorageKey: "inputs/job1"},
+		Parameters: map[string]any{"width": 10, "height": 10},
+	}
+	w := newWorker(newMockJobStore(j), stor)
+
+	result, err := w.process(context.Background(), j)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Steps) != 1 || result.Steps[0].Processor != "resize" {
+		t.Errorf("steps = %+v, want one resize step", result.Steps)
+	}
+}
+
+func transparentPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tiffImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := tiff.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcess_OutputFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    func(t *testing.T, w, h int) []byte
+		output   job.Output
+		wantKey  string
+		wantMime string
+	}{
+		{"jpeg keeps input format", minimalJPEG, job.Output{}, "results/job1.jpg", "image/jpeg"},
+		{"png keeps input format", transparentPNG, job.Output{}, "results/job1.png", "image/png"},
+		{"png to jpeg", transparentPNG, job.Output{Format: "jpeg", Quality: 80}, "results/job1.jpg", "image/jpeg"},
+		{"jpeg to gif", minimalJPEG, job.Output{Format: "gif"}, "results/job1.gif", "image/gif"},
+		{"tiff falls back to png", tiffImage, job.Output{}, "results/job1.png", "image/png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stor := newMockStorage()
+			stor.data["inputs/job1"] = tt.input(t, 40, 40)
+
+			j := &job.Job{
+				ID:         "job1",
+				Type:       job.TypeResize,
+				Input:      job.Input{StorageKey: "inputs/job1"},
+				Output:     tt.output,
+				Parameters: map[string]any{"width": 20, "height": 20},
+			}
+			w := newWorker(newMockJobStore(j), stor)
+
+			result, err := w.process(context.Background(), j)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.StorageKey != tt.wantKey || result.MimeType != tt.wantMime {
+				t.Errorf("result = %s (%s), want %s (%s)", result.StorageKey, result.MimeType, tt.wantKey, tt.wantMime)
+			}
+			if _, ok := stor.data[tt.wantKey]; !ok {
+				t.Errorf("expected %s in storage", tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestProcess_PNGKeepsAlpha(t *testing.T) {
+	stor := newMockStorage()
+	stor.data["inputs/job1"] = transparentPNG(t, 40, 40)
+
+	j := &job.Job{
+		ID:         "job1",
+		Type:       job.TypeCrop,
+		Input:      job.Input{StorageKey: "inputs/job1"},
+		Parameters: map[string]any{"x": 0, "y": 0, "width": 10, "height": 10},
+	}
+	w := newWorker(newMockJobStore(j), stor)
+
+	result, err := w.process(context.Background(), j)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(stor.data[result.StorageKey]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := img.At(5, 5).RGBA(); a != 0 {
+		t.Errorf("expected transparent pixel, got alpha %d", a)
+	}
+}
+
+func TestProcess_InvalidOutput(t *testing.T) {
+	for _, output := range []job.Output{{Format: "tiff"}, {Metadata: "some"}} {
+		stor := newMockStorage()
+		stor.data["inputs/job1"] = minimalJPEG(t, 40, 40)
+
+		j := &job.Job{
+			ID:         "job1",
+			Type:       job.TypeResize,
+			Input:      job.Input{StorageKey: "inputs/job1"},
+			Output:     output,
+			Parameters: map[string]any{"width": 20, "height": 20},
+		}
+		w := newWorker(newMockJobStore(j), stor)
+
+		_, err := w.process(context.Background(), j)
+		if !job.IsPermanent(err) || job.CodeOf(err) != job.CodeInvalidParameters {
+			t.Errorf("%+v: expected permanent %s, got %v", output, job.CodeInvalidParameters, err)
+		}
+	}
+}
+
+// exifJPEG returns a width x height JPEG tagged with an orientation, copyright
+// and GPS location
+func exifJPEG(t *testing.T, width, height, orientation int) []byte {
+	t.Helper()
+	e := metadatatest.EXIF(t,
+		metadatatest.Tag{IFD: metadata.IFD0, Tag: metadata.TagOrientation, Value: uint16(orientation)},
+		metadatatest.Tag{IFD: metadata.IFD0, Tag: metadata.TagCopyright, Value: "(c) Example Ltd"},
+		metadatatest.Tag{IFD: metadata.IFDGPS, Tag: 0x0001, Value: "N"}, // GPSLatitudeRef
+	)
+
+	data, err := metadata.Embed(minimalJPEG(t, width, height), "jpeg", &metadata.Metadata{EXIF: e})
+	if err != nil {
+		t.Fatalf("embed metadata: %v", err)
+	}
+	return data
+}
+
+func TestProcess_Orientation(t *testing.T) {
+	stor := newMockStorage()
+	stor.data["inputs/job1"] = exifJPEG(t, 40, 20, 6)
+
+	// Crop bounds apply to the upright 20x40 image
+	j := &job.Job{
+		ID:         "job1",
+		Type:       job.TypeCrop,
+		Input:      job.Input{StorageKey: "inputs/job1"},
+		Parameters: map[string]any{"x": 0, "y": 10, "width": 20, "height": 30},
+	}
+	w := newWorker(newMockJobStore(j), stor)
+
+	result, err := w.process(context.Background(), j)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Width != 20 || result.Height != 30 {
+		t.Errorf("expected 20x30, got %dx%d", result.Width, result.Height)
+	}
+
+	meta, err := metadata.Extract(stor.data[result.StorageKey])
+	if err != nil {
+		t.Fatalf("extract result metadata: %v", err)
+	}
+	if meta.Orientation() != 1 {
+		t.Errorf("result orientation = %d, want 1", meta.Orientation())
+	}
+}
+
+func TestProcess_MetadataPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		output        job.Output
+		wantCopyright bool
+		wantGPS       bool
+	}{
+		{"default keeps copyright", job.Output{}, true, false},
+		{"strip", job.Output{Metadata: metadata.PolicyStrip}, false, false},
+		{"all", job.Output{Metadata: metadata.PolicyAll}, true, true},
+		{"all without GPS", job.Output{Metadata: metadata.PolicyAll, StripGPS: true}, true, false},
+		{"png output", job.Output{Format: "png", Metadata: metadata.PolicyAll}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stor := newMockStorage()
+			stor.data["inputs/job1"] = exifJPEG(t, 40, 40, 1)
+
+			j := &job.Job{
+				ID:         "job1",
+				Type:       job.TypeResize,
+				Input:      job.Input{StorageKey: "inputs/job1"},
+				Output:     tt.output,
+				Parameters: map[string]any{"width": 20, "height": 20},
+			}
+			w := newWorker(newMockJobStore(j), stor)
+
+			result, err := w.process(context.Background(), j)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			meta, err := metadata.Extract(stor.data[result.StorageKey])
+			if err != nil {
+				t.Fatalf("extract result metadata: %v", err)
+			}
+
+			var copyright, gps bool
+			if meta.EXIF != nil {
+				_, copyright = meta.EXIF.ASCII(metadata.IFD0, metadata.TagCopyright)
+				_, gps = meta.EXIF.ASCII(metadata.IFDGPS, 0x0001)
+			}
+			if copyright != tt.wantCopyright || gps != tt.wantGPS {
+				t.Errorf("copyright = %v, gps = %v, want %v, %v", copyright, gps, tt.wantCopyright, tt.wantGPS)
+			}
+		})
+	}
+}
+
+func TestProcess_OversizedEXIF(t *testing.T) {
+	// PNG carries EXIF of any size, a JPEG segment at most 64 KB
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	e := metadatatest.EXIF(t,
+		metadatatest.Tag{IFD: metadata.IFD0, Tag: metadata.TagCopyright, Value: "(c) Example Ltd"},
+		metadatatest.Tag{IFD: metadata.IFDExif, Tag: 0x9286, Value: strings.Repeat("x", 70000)}, // UserComment
+	)
+	data, err := metadata.Embed(buf.Bytes(), "png", &metadata.Metadata{EXIF: e})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stor := newMockStorage()
+	stor.data["inputs/job1"] = data
+	j := &job.Job{
+		ID:         "job1",
+		Type:       job.TypeResize,
+		Input:      job.Input{StorageKey: "inputs/job1"},
+		Output:     job.Output{Format: "jpeg", Metadata: metadata.PolicyAll},
+		Parameters: map[string]any{"width": 4, "height": 4},
+	}
+	w := newWorker(newMockJobStore(j), stor)
+
+	result, err := w.process(context.Background(), j)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	meta, err := metadata.Extract(stor.data[result.StorageKey])
+	if err != nil {
+		t.Fatalf("extract result metadata: %v", err)
+	}
+	if meta.EXIF == nil {
+		t.Fatal("expected EXIF trimmed, not dropped")
+	}
+	if _, ok := meta.EXIF.ASCII(metadata.IFD0, metadata.TagCopyright); !ok {
+		t.Error("expected copyright kept")
+	}
+	if _, ok := meta.EXIF.ASCII(metadata.IFDExif, 0x9286); ok {
+		t.Error("expected oversized comment dropped")
+	}
 }
@@ -1,7 +1,19 @@
 package main
 
-import "github.com/mohammed-ysn/cluster-imager/internal/server"
+import (
+	"os"
+
+	"github.com/mohammed-ysn/cluster-imager/internal/config"
+	"github.com/mohammed-ysn/cluster-imager/internal/server"
+)
 
 func main() {
-	server.StartServer()
+	cfg := config.Load()
+
+	// An optional subcommand (api, worker, all) overrides MODE.
+	if len(os.Args) > 1 {
+		cfg.Mode = os.Args[1]
+	}
+
+	server.StartServer(cfg)
 }
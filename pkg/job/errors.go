@@ -0,0 +1,82 @@
+package job
+
+import (
+	"errors"
+)
+
+// Failure classes. Use errors.Is to test which class an error belongs to.
+var (
+	// ErrPermanent marks failures that will not succeed on retry
+	ErrPermanent = errors.New("permanent failure")
+
+	// ErrTransient marks failures that may succeed on retry
+	ErrTransient = errors.New("transient failure")
+)
+
+// ErrorCode is a machine-readable reason for a job failure
+type ErrorCode string
+
+const (
+	CodeInvalidImage       ErrorCode = "invalid_image"
+	CodeImageTooLarge      ErrorCode = "image_too_large"
+	CodeUnsupportedFormat  ErrorCode = "unsupported_format"
+	CodeInvalidParameters  ErrorCode = "invalid_parameters"
+	CodeUnknownProcessor   ErrorCode = "unknown_processor"
+	CodeInputNotFound      ErrorCode = "input_not_found"
+	CodeProcessingFailed   ErrorCode = "processing_failed"
+	CodeEncodeFailed       ErrorCode = "encode_failed"
+	CodeStorageUnavailable ErrorCode = "storage_unavailable"
+	CodeInternal           ErrorCode = "internal"
+	CodeAbandoned          ErrorCode = "abandoned" // every attempt ended with its worker stopping
+)
+
+// Error is a classified job failure
+type Error struct {
+	Code      ErrorCode
+	Permanent bool
+	Err       error
+}
+
+// Permanent wraps err as a failure that should not be retried
+func Permanent(code ErrorCode, err error) error {
+	return &Error{Code: code, Permanent: true, Err: err}
+}
+
+// Transient wraps err as a failure that may be retried
+func Transient(code ErrorCode, err error) error {
+	return &Error{Code: code, Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error belongs to the ErrPermanent or ErrTransient class
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrPermanent:
+		return e.Permanent
+	case ErrTransient:
+		return !e.Permanent
+	}
+	return false
+}
+
+// IsPermanent reports whether err should not be retried. Unclassified errors
+// are treated as transient.
+func IsPermanent(err error) bool {
+	return errors.Is(err, ErrPermanent)
+}
+
+// CodeOf returns the error code of a classified error, or CodeInternal
+func CodeOf(err error) ErrorCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeInternal
+}
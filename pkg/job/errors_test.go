@@ -0,0 +1,41 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorClassification(t *testing.T) {
+	cause := errors.New("boom")
+
+	tests := []struct {
+		name          string
+		err           error
+		wantPermanent bool
+		wantTransient bool
+		wantCode      ErrorCode
+	}{
+		{"permanent", Permanent(CodeInvalidImage, cause), true, false, CodeInvalidImage},
+		{"transient", Transient(CodeStorageUnavailable, cause), false, true, CodeStorageUnavailable},
+		{"wrapped permanent", fmt.Errorf("ctx: %w", Permanent(CodeInvalidParameters, cause)), true, false, CodeInvalidParameters},
+		{"unclassified", cause, false, false, CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanent(tt.err); got != tt.wantPermanent {
+				t.Errorf("IsPermanent() = %v, want %v", got, tt.wantPermanent)
+			}
+			if got := errors.Is(tt.err, ErrTransient); got != tt.wantTransient {
+				t.Errorf("errors.Is(ErrTransient) = %v, want %v", got, tt.wantTransient)
+			}
+			if got := CodeOf(tt.err); got != tt.wantCode {
+				t.Errorf("CodeOf() = %v, want %v", got, tt.wantCode)
+			}
+			if !errors.Is(tt.err, cause) {
+				t.Error("classified error should unwrap to its cause")
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+// Package jobtest provides a conformance suite for job.Store implementations.
+package jobtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+// RunStoreSuite runs the job.Store conformance tests. newStore is called once
+// per subtest and must return an empty store.
+func RunStoreSuite(t *testing.T, newStore func(t *testing.T) job.Store) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s job.Store)
+	}{
+		{"CreateGet", testCreateGet},
+		{"NotFound", testNotFound},
+		{"Update", testUpdate},
+		{"UpdateStatus", testUpdateStatus},
+		{"StatusIndex", testStatusIndex},
+		{"ListFilters", testListFilters},
+		{"ListPagination", testListPagination},
+		{"ReturnsCopies", testReturnsCopies},
+		{"ConcurrentUpdates", testConcurrentUpdates},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func newJob(id string, typ job.Type) *job.Job {
+	return &job.Job{
+		ID:         id,
+		Type:       typ,
+		Status:     job.StatusQueued,
+		Parameters: map[string]interface{}{"width": 100},
+		Input:      job.Input{StorageKey: "uploads/" + id + ".jpg", MimeType: "image/jpeg", Size: 42},
+	}
+}
+
+func mustCreate(t *testing.T, s job.Store, j *job.Job) {
+	t.Helper()
+	if err := s.Create(context.Background(), j); err != nil {
+		t.Fatalf("Create(%s) error = %v", j.ID, err)
+	}
+}
+
+func mustGet(t *testing.T, s job.Store, id string) *job.Job {
+	t.Helper()
+	j, err := s.Get(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Get(%s) error = %v", id, err)
+	}
+	return j
+}
+
+func mustList(t *testing.T, s job.Store, filter job.Filter) []string {
+	t.Helper()
+	jobs, err := s.List(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("List(%+v) error = %v", filter, err)
+	}
+	ids := make([]string, len(jobs))
+	for i, j := range jobs {
+		ids[i] = j.ID
+	}
+	return ids
+}
+
+func equalIDs(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testCreateGet(t *testing.T, s job.Store) {
+	j := newJob("j1", job.TypeResize)
+	mustCreate(t, s, j)
+
+	if j.Metadata.CreatedAt.IsZero() || j.Metadata.UpdatedAt.IsZero() {
+		t.Error("Create() did not set CreatedAt and UpdatedAt")
+	}
+
+	got := mustGet(t, s, "j1")
+	if got.ID != "j1" || got.Type != job.TypeResize || got.Status != job.StatusQueued {
+		t.Errorf("Get() = %+v", got)
+	}
+	if got.Input != j.Input {
+		t.Errorf("Input = %+v, want %+v", got.Input, j.Input)
+	}
+	if got.Parameters["width"] != float64(100) {
+		t.Errorf("Parameters[width] = %#v, want float64(100)", got.Parameters["width"])
+	}
+	if !got.Metadata.CreatedAt.Equal(j.Metadata.CreatedAt) {
+		t.Errorf("CreatedAt = %v, want %v", got.Metadata.CreatedAt, j.Metadata.CreatedAt)
+	}
+}
+
+func testNotFound(t *testing.T, s job.Store) {
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, "missing"); !errors.Is(err, job.ErrNotFound) {
+		t.Errorf("Get() error = %v, want ErrNotFound", err)
+	}
+	if err := s.UpdateStatus(ctx, "missing", job.StatusFailed, nil, "x"); !errors.Is(err, job.ErrNotFound) {
+		t.Errorf("UpdateStatus() error = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "missing"); !errors.Is(err, job.ErrNotFound) {
+		t.Errorf("Delete() error = %v, want ErrNotFound", err)
+	}
+}
+
+func testUpdate(t *testing.T, s job.Store) {
+	j := newJob("j1", job.TypeCrop)
+	mustCreate(t, s, j)
+	created := j.Metadata.UpdatedAt
+
+	time.Sleep(time.Millisecond)
+	j.Status = job.StatusFailed
+	j.Error = "boom"
+	j.ErrorCode = job.CodeInvalidImage
+	j.Metadata.RetryCount = 2
+	if err := s.Update(context.Background(), j); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	got := mustGet(t, s, "j1")
+	if got.Status != job.StatusFailed || got.Error != "boom" || got.ErrorCode != job.CodeInvalidImage {
+		t.Errorf("Get() after Update = %+v", got)
+	}
+	if got.Metadata.RetryCount != 2 {
+		t.Errorf("RetryCount = %d, want 2", got.Metadata.RetryCount)
+	}
+	if !got.Metadata.UpdatedAt.After(created) {
+		t.Error("Update() did not advance UpdatedAt")
+	}
+}
+
+func testUpdateStatus(t *testing.T, s job.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, newJob("j1", job.TypeResize))
+
+	if err := s.UpdateStatus(ctx, "j1", job.StatusProcessing, nil, ""); err != nil {
+		t.Fatalf("UpdateStatus(processing) error = %v", err)
+	}
+	got := mustGet(t, s, "j1")
+	if got.Status != job.StatusProcessing || got.Metadata.StartedAt.IsZero() {
+		t.Errorf("after processing: status = %s, started = %v", got.Status, got.Metadata.StartedAt)
+	}
+	if !got.Metadata.CompletedAt.IsZero() {
+		t.Error("CompletedAt set before completion")
+	}
+
+	result := &job.Result{
+		StorageKey: "results/j1.jpg", MimeType: "image/jpeg", Size: 7, Width: 10, Height: 20,
+		Steps: []job.StepResult{{Processor: "resize", DurationMs: 1.5, Width: 10, Height: 20}},
+	}
+	if err := s.UpdateStatus(ctx, "j1", job.StatusCompleted, result, ""); err != nil {
+		t.Fatalf("UpdateStatus(completed) error = %v", err)
+	}
+	got = mustGet(t, s, "j1")
+	if got.Status != job.StatusCompleted || got.Metadata.CompletedAt.IsZero() {
+		t.Errorf("after completed: status = %s, completed = %v", got.Status, got.Metadata.CompletedAt)
+	}
+	if !reflect.DeepEqual(got.Result, result) {
+		t.Errorf("Result = %+v, want %+v", got.Result, result)
+	}
+
+	if err := s.UpdateStatus(ctx, "j1", job.StatusFailed, nil, "late failure"); err != nil {
+		t.Fatalf("UpdateStatus(failed) error = %v", err)
+	}
+	got = mustGet(t, s, "j1")
+	if got.Error != "late failure" || got.Result != nil {
+		t.Errorf("after failed: error = %q, result = %+v", got.Error, got.Result)
+	}
+}
+
+func testStatusIndex(t *testing.T, s job.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, newJob("a", job.TypeResize))
+	mustCreate(t, s, newJob("b", job.TypeResize))
+
+	if got := mustList(t, s, job.Filter{Status: job.StatusQueued}); len(got) != 2 {
+		t.Errorf("queued = %v, want 2 jobs", got)
+	}
+
+	if err := s.UpdateStatus(ctx, "a", job.StatusProcessing, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	b := mustGet(t, s, "b")
+	b.Status = job.StatusCompleted
+	if err := s.Update(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := mustList(t, s, job.Filter{Status: job.StatusQueued}); len(got) != 0 {
+		t.Errorf("queued = %v, want none", got)
+	}
+	if got := mustList(t, s, job.Filter{Status: job.StatusProcessing}); !equalIDs(got, []string{"a"}) {
+		t.Errorf("processing = %v, want [a]", got)
+	}
+	if got := mustList(t, s, job.Filter{Status: job.StatusCompleted}); !equalIDs(got, []string{"b"}) {
+		t.Errorf("completed = %v, want [b]", got)
+	}
+
+	if err := s.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := s.Get(ctx, "a"); !errors.Is(err, job.ErrNotFound) {
+		t.Errorf("Get() after Delete error = %v, want ErrNotFound", err)
+	}
+	if got := mustList(t, s, job.Filter{Status: job.StatusProcessing}); len(got) != 0 {
+		t.Errorf("processing after delete = %v, want none", got)
+	}
+	if got := mustList(t, s, job.Filter{}); !equalIDs(got, []string{"b"}) {
+		t.Errorf("all after delete = %v, want [b]", got)
+	}
+}
+
+func testListFilters(t *testing.T, s job.Store) {
+	mustCreate(t, s, newJob("r1", job.TypeResize))
+	time.Sleep(5 * time.Millisecond)
+	mid := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	mustCreate(t, s, newJob("c1", job.TypeCrop))
+	mustCreate(t, s, newJob("r2", job.TypeResize))
+
+	tests := []struct {
+		name   string
+		filter job.Filter
+		want   []string
+	}{
+		{"all", job.Filter{}, []string{"r1", "c1", "r2"}},
+		{"type", job.Filter{Type: job.TypeResize}, []string{"r1", "r2"}},
+		{"status and type", job.Filter{Status: job.StatusQueued, Type: job.TypeCrop}, []string{"c1"}},
+		{"since", job.Filter{Since: mid}, []string{"c1", "r2"}},
+		{"until", job.Filter{Until: mid}, []string{"r1"}},
+		{"no match", job.Filter{Status: job.StatusFailed}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustList(t, s, tt.filter); !equalIDs(got, tt.want) {
+				t.Errorf("List() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testListPagination(t *testing.T, s job.Store) {
+	for i := range 5 {
+		mustCreate(t, s, newJob(fmt.Sprintf("j%d", i), job.TypeResize))
+		time.Sleep(time.Millisecond)
+	}
+
+	tests := []struct {
+		name   string
+		filter job.Filter
+		want   []string
+	}{
+		{"limit", job.Filter{Limit: 2}, []string{"j0", "j1"}},
+		{"offset", job.Filter{Offset: 3}, []string{"j3", "j4"}},
+		{"limit and offset", job.Filter{Limit: 2, Offset: 2}, []string{"j2", "j3"}},
+		{"limit past end", job.Filter{Limit: 10, Offset: 4}, []string{"j4"}},
+		{"offset past end", job.Filter{Limit: 2, Offset: 10}, []string{}},
+		{"with status", job.Filter{Status: job.StatusQueued, Limit: 1, Offset: 1}, []string{"j1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustList(t, s, tt.filter); !equalIDs(got, tt.want) {
+				t.Errorf("List() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testReturnsCopies(t *testing.T, s job.Store) {
+	j := newJob("j1", job.TypeResize)
+	mustCreate(t, s, j)
+
+	j.Status = job.StatusFailed
+	got := mustGet(t, s, "j1")
+	if got.Status != job.StatusQueued {
+		t.Errorf("store shares the created job: status = %s", got.Status)
+	}
+
+	got.Parameters["width"] = 1
+	if again := mustGet(t, s, "j1"); again.Parameters["width"] != float64(100) {
+		t.Errorf("store shares returned jobs: width = %v", again.Parameters["width"])
+	}
+}
+
+func testConcurrentUpdates(t *testing.T, s job.Store) {
+	const workers = 8
+	ctx := context.Background()
+	mustCreate(t, s, newJob("j1", job.TypeResize))
+
+	statuses := []job.Status{job.StatusProcessing, job.StatusCompleted, job.StatusFailed}
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*len(statuses))
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range statuses {
+				status := statuses[(w+i)%len(statuses)]
+				if err := s.UpdateStatus(ctx, "j1", status, nil, ""); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("UpdateStatus() error = %v", err)
+	}
+
+	final := mustGet(t, s, "j1")
+	for _, status := range append(statuses, job.StatusQueued) {
+		got := mustList(t, s, job.Filter{Status: status})
+		if status == final.Status {
+			if !equalIDs(got, []string{"j1"}) {
+				t.Errorf("List(%s) = %v, want [j1]", status, got)
+			}
+		} else if len(got) != 0 {
+			t.Errorf("List(%s) = %v, want none (job is %s)", status, got, final.Status)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryStore implements Store interface in process memory. Jobs are stored
+// JSON-encoded like RedisStore, so callers see the same copy semantics and
+// parameter types. Jobs do not survive a restart.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	jobs map[string]memoryEntry
+	ttl  time.Duration
+}
+
+type memoryEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates a new in-memory job store. A zero ttl keeps jobs forever.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		jobs: make(map[string]memoryEntry),
+		ttl:  ttl,
+	}
+}
+
+// Create creates a new job
+func (s *MemoryStore) Create(_ context.Context, job *Job) error {
+	job.Metadata.CreatedAt = time.Now()
+	job.Metadata.UpdatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evictExpired()
+	return s.save(job)
+}
+
+// Get retrieves a job by ID
+func (s *MemoryStore) Get(_ context.Context, id string) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.get(id)
+}
+
+// Update updates a job
+func (s *MemoryStore) Update(_ context.Context, job *Job) error {
+	job.Metadata.UpdatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(job)
+}
+
+// UpdateStatus updates the status of a job
+func (s *MemoryStore) UpdateStatus(_ context.Context, id string, status Status, result *Result, errMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, err := s.get(id)
+	if err != nil {
+		return err
+	}
+
+	job.Status = status
+	job.Result = result
+	job.Error = errMsg
+
+	switch status {
+	case StatusProcessing:
+		job.Metadata.StartedAt = time.Now()
+	case StatusCompleted, StatusFailed:
+		job.Metadata.CompletedAt = time.Now()
+	}
+	job.Metadata.UpdatedAt = time.Now()
+
+	return s.save(job)
+}
+
+// List lists jobs with optional filters, oldest first
+func (s *MemoryStore) List(_ context.Context, filter Filter) ([]*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var jobs []*Job
+	for id := range s.jobs {
+		job, err := s.get(id)
+		if err != nil {
+			continue // Skip expired jobs
+		}
+		if filter.matches(job) {
+			jobs = append(jobs, job)
+		}
+	}
+
+	return filter.paginate(jobs), nil
+}
+
+// Delete deletes a job
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.get(id); err != nil {
+		return err
+	}
+	delete(s.jobs, id)
+	return nil
+}
+
+// Close is a no-op, for symmetry with RedisStore
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// Ping always succeeds, for symmetry with RedisStore
+func (s *MemoryStore) Ping(_ context.Context) error {
+	return nil
+}
+
+// Helper methods; callers hold s.mu
+
+func (s *MemoryStore) get(id string) (*Job, error) {
+	entry, ok := s.jobs[id]
+	if !ok || (!entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt)) {
+		return nil, ErrNotFound
+	}
+
+	var job Job
+	if err := json.Unmarshal(entry.data, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job: %w", err)
+	}
+	return &job, nil
+}
+
+func (s *MemoryStore) evictExpired() {
+	now := time.Now()
+	for id, entry := range s.jobs {
+		if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func (s *MemoryStore) save(job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	entry := memoryEntry{data: data}
+	if s.ttl > 0 {
+		entry.expiresAt = time.Now().Add(s.ttl)
+	}
+	s.jobs[job.ID] = entry
+	return nil
+}
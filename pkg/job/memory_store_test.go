@@ -0,0 +1,14 @@
+package job_test
+
+import (
+	"testing"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+	"github.com/mohammed-ysn/cluster-imager/pkg/job/jobtest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	jobtest.RunStoreSuite(t, func(*testing.T) job.Store {
+		return job.NewMemoryStore(0)
+	})
+}
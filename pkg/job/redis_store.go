@@ -3,12 +3,18 @@ package job
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// maxUpdateAttempts bounds optimistic-locking retries when a job is modified
+// concurrently
+const maxUpdateAttempts = 100
+
 // RedisStore implements Store interface using Redis
 type RedisStore struct {
 	client *redis.Client
@@ -53,93 +59,57 @@ func (s *RedisStore) Create(ctx context.Context, job *Job) error {
 		return fmt.Errorf("failed to marshal job: %w", err)
 	}
 
-	if err := s.client.Set(ctx, key, data, s.ttl).Err(); err != nil {
+	// Save job and add to status index in one transaction
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, data, s.ttl)
+		pipe.SAdd(ctx, s.indexKey(string(job.Status)), job.ID)
+		return nil
+	})
+	if err != nil {
 		return fmt.Errorf("failed to create job: %w", err)
 	}
 
-	// Add to status index
-	if err := s.addToIndex(ctx, job); err != nil {
-		return fmt.Errorf("failed to add to index: %w", err)
-	}
-
 	return nil
 }
 
 // Get retrieves a job by ID
 func (s *RedisStore) Get(ctx context.Context, id string) (*Job, error) {
-	key := s.key(id)
-
-	data, err := s.client.Get(ctx, key).Bytes()
-	if err != nil {
-		if err == redis.Nil {
-			return nil, fmt.Errorf("job not found")
-		}
-		return nil, fmt.Errorf("failed to get job: %w", err)
-	}
-
-	var job Job
-	if err := json.Unmarshal(data, &job); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal job: %w", err)
-	}
-
-	return &job, nil
+	return s.get(ctx, s.client, s.key(id))
 }
 
 // Update updates a job
 func (s *RedisStore) Update(ctx context.Context, job *Job) error {
-	// Remove from old status index
-	oldJob, err := s.Get(ctx, job.ID)
-	if err == nil {
-		if err := s.removeFromIndex(ctx, oldJob); err != nil {
-			return fmt.Errorf("failed to remove from old index: %w", err)
-		}
-	}
-
-	// Update timestamp
-	job.Metadata.UpdatedAt = time.Now()
-
-	// Save job
-	key := s.key(job.ID)
-	data, err := json.Marshal(job)
-	if err != nil {
-		return fmt.Errorf("failed to marshal job: %w", err)
-	}
-
-	if err := s.client.Set(ctx, key, data, s.ttl).Err(); err != nil {
-		return fmt.Errorf("failed to update job: %w", err)
-	}
-
-	// Add to new status index
-	if err := s.addToIndex(ctx, job); err != nil {
-		return fmt.Errorf("failed to update index: %w", err)
-	}
-
-	return nil
+	return s.update(ctx, job.ID, func(*Job) (*Job, error) {
+		job.Metadata.UpdatedAt = time.Now()
+		return job, nil
+	})
 }
 
 // UpdateStatus updates the status of a job
 func (s *RedisStore) UpdateStatus(ctx context.Context, id string, status Status, result *Result, errMsg string) error {
-	job, err := s.Get(ctx, id)
-	if err != nil {
-		return err
-	}
+	return s.update(ctx, id, func(job *Job) (*Job, error) {
+		if job == nil {
+			return nil, ErrNotFound
+		}
 
-	job.Status = status
-	job.Result = result
-	job.Error = errMsg
+		job.Status = status
+		job.Result = result
+		job.Error = errMsg
 
-	// Update timestamps
-	switch status {
-	case StatusProcessing:
-		job.Metadata.StartedAt = time.Now()
-	case StatusCompleted, StatusFailed:
-		job.Metadata.CompletedAt = time.Now()
-	}
+		// Update timestamps
+		switch status {
+		case StatusProcessing:
+			job.Metadata.StartedAt = time.Now()
+		case StatusCompleted, StatusFailed:
+			job.Metadata.CompletedAt = time.Now()
+		}
+		job.Metadata.UpdatedAt = time.Now()
 
-	return s.Update(ctx, job)
+		return job, nil
+	})
 }
 
-// List lists jobs with optional filters
+// List lists jobs with optional filters, oldest first
 func (s *RedisStore) List(ctx context.Context, filter Filter) ([]*Job, error) {
 	// For simplicity, we'll use status-based indices
 	// In production, consider using Redis sorted sets for time-based queries
@@ -161,6 +131,9 @@ func (s *RedisStore) List(ctx context.Context, filter Filter) ([]*Job, error) {
 		pattern := fmt.Sprintf("%s:*", s.prefix)
 		iter := s.client.Scan(ctx, 0, pattern, 0).Iterator()
 		for iter.Next(ctx) {
+			if strings.HasPrefix(iter.Val(), s.indexKey("")) {
+				continue // Skip status indices
+			}
 			keys = append(keys, iter.Val())
 		}
 		if err := iter.Err(); err != nil {
@@ -168,36 +141,21 @@ func (s *RedisStore) List(ctx context.Context, filter Filter) ([]*Job, error) {
 		}
 	}
 
-	// Apply limit
-	if filter.Limit > 0 && len(keys) > filter.Limit {
-		keys = keys[filter.Offset : filter.Offset+filter.Limit]
-	}
-
 	// Get jobs
 	var jobs []*Job
 	for _, key := range keys {
-		data, err := s.client.Get(ctx, key).Bytes()
+		job, err := s.get(ctx, s.client, key)
 		if err != nil {
-			continue // Skip missing jobs
-		}
-
-		var job Job
-		if err := json.Unmarshal(data, &job); err != nil {
-			continue // Skip invalid jobs
+			continue // Skip missing or invalid jobs
 		}
 
-		// Apply time filters
-		if !filter.Since.IsZero() && job.Metadata.CreatedAt.Before(filter.Since) {
-			continue
-		}
-		if !filter.Until.IsZero() && job.Metadata.CreatedAt.After(filter.Until) {
-			continue
+		// Index entries of expired jobs can be stale, so filter on the job itself
+		if filter.matches(job) {
+			jobs = append(jobs, job)
 		}
-
-		jobs = append(jobs, &job)
 	}
 
-	return jobs, nil
+	return filter.paginate(jobs), nil
 }
 
 // Delete deletes a job
@@ -207,14 +165,13 @@ func (s *RedisStore) Delete(ctx context.Context, id string) error {
 		return err
 	}
 
-	// Remove from index
-	if err := s.removeFromIndex(ctx, job); err != nil {
-		return fmt.Errorf("failed to remove from index: %w", err)
-	}
-
-	// Delete job
-	key := s.key(id)
-	if err := s.client.Del(ctx, key).Err(); err != nil {
+	// Remove from index and delete job in one transaction
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SRem(ctx, s.indexKey(string(job.Status)), id)
+		pipe.Del(ctx, s.key(id))
+		return nil
+	})
+	if err != nil {
 		return fmt.Errorf("failed to delete job: %w", err)
 	}
 
@@ -231,17 +188,78 @@ func (s *RedisStore) indexKey(status string) string {
 	return fmt.Sprintf("%s:status:%s", s.prefix, status)
 }
 
-func (s *RedisStore) addToIndex(ctx context.Context, job *Job) error {
-	indexKey := s.indexKey(string(job.Status))
-	return s.client.SAdd(ctx, indexKey, job.ID).Err()
+func (s *RedisStore) get(ctx context.Context, c redis.Cmdable, key string) (*Job, error) {
+	data, err := c.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job: %w", err)
+	}
+
+	return &job, nil
 }
 
-func (s *RedisStore) removeFromIndex(ctx context.Context, job *Job) error {
-	indexKey := s.indexKey(string(job.Status))
-	return s.client.SRem(ctx, indexKey, job.ID).Err()
+// update applies fn to the stored job (nil if it does not exist) and saves the
+// result, moving it between status indices. The read and write happen under
+// WATCH, so concurrent updates are retried rather than lost.
+func (s *RedisStore) update(ctx context.Context, id string, fn func(*Job) (*Job, error)) error {
+	key := s.key(id)
+
+	for range maxUpdateAttempts {
+		err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+			oldJob, err := s.get(ctx, tx, key)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+
+			job, err := fn(oldJob)
+			if err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(job)
+			if err != nil {
+				return fmt.Errorf("failed to marshal job: %w", err)
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				if oldJob != nil {
+					pipe.SRem(ctx, s.indexKey(string(oldJob.Status)), id)
+				}
+				pipe.Set(ctx, key, data, s.ttl)
+				pipe.SAdd(ctx, s.indexKey(string(job.Status)), id)
+				return nil
+			})
+			return err
+		}, key)
+
+		if errors.Is(err, redis.TxFailedErr) {
+			continue // Job changed since it was read
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to update job: %w", err)
+		}
+		return err
+	}
+
+	return fmt.Errorf("failed to update job: too many concurrent modifications")
 }
 
 // Close closes the Redis connection
 func (s *RedisStore) Close() error {
 	return s.client.Close()
 }
+
+// Ping checks that Redis is reachable
+func (s *RedisStore) Ping(ctx context.Context) error {
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to ping Redis: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package job_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+	"github.com/mohammed-ysn/cluster-imager/pkg/job/jobtest"
+)
+
+func TestRedisStore(t *testing.T) {
+	jobtest.RunStoreSuite(t, func(t *testing.T) job.Store {
+		m := miniredis.RunT(t)
+		s, err := job.NewRedisStore("redis://"+m.Addr(), "jobs", time.Hour)
+		if err != nil {
+			t.Fatalf("NewRedisStore() error = %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
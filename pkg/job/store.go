@@ -2,9 +2,14 @@ package job
 
 import (
 	"context"
+	"errors"
+	"sort"
 	"time"
 )
 
+// ErrNotFound is returned when a job does not exist
+var ErrNotFound = errors.New("job not found")
+
 // Store defines the interface for job storage
 type Store interface {
 	// Create creates a new job
@@ -35,3 +40,43 @@ type Filter struct {
 	Limit  int
 	Offset int
 }
+
+// matches reports whether job passes the filter's status, type and time bounds
+func (f Filter) matches(job *Job) bool {
+	if f.Status != "" && job.Status != f.Status {
+		return false
+	}
+	if f.Type != "" && job.Type != f.Type {
+		return false
+	}
+	if !f.Since.IsZero() && job.Metadata.CreatedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && job.Metadata.CreatedAt.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// paginate sorts jobs oldest first (by ID on ties) and applies the filter's
+// offset and limit
+func (f Filter) paginate(jobs []*Job) []*Job {
+	sort.Slice(jobs, func(i, j int) bool {
+		a, b := jobs[i].Metadata.CreatedAt, jobs[j].Metadata.CreatedAt
+		if a.Equal(b) {
+			return jobs[i].ID < jobs[j].ID
+		}
+		return a.Before(b)
+	})
+
+	if f.Offset > 0 {
+		if f.Offset >= len(jobs) {
+			return nil
+		}
+		jobs = jobs[f.Offset:]
+	}
+	if f.Limit > 0 && len(jobs) > f.Limit {
+		jobs = jobs[:f.Limit]
+	}
+	return jobs
+}
@@ -18,8 +18,14 @@ const (
 type Type string
 
 const (
-	TypeResize Type = "resize"
-	TypeCrop   Type = "crop"
+	TypeResize    Type = "resize"
+	TypeCrop      Type = "crop"
+	TypePipeline  Type = "pipeline"
+	TypeRotate    Type = "rotate"
+	TypeFlip      Type = "flip"
+	TypeTranspose Type = "transpose"
+	TypeWatermark Type = "watermark"
+	TypeText      Type = "text"
 )
 
 // Job represents an image processing job
@@ -29,9 +35,16 @@ type Job struct {
 	Status     Status                 `json:"status"`
 	Parameters map[string]interface{} `json:"parameters"`
 	Input      Input                  `json:"input"`
+	Output     Output                 `json:"output"`
 	Result     *Result                `json:"result,omitempty"`
 	Error      string                 `json:"error,omitempty"`
+	ErrorCode  ErrorCode              `json:"error_code,omitempty"`
 	Metadata   Metadata               `json:"metadata"`
+
+	// LastError and LastErrorCode describe the most recent failed attempt
+	// of a job that is being retried
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorCode ErrorCode `json:"last_error_code,omitempty"`
 }
 
 // Input represents the input for a job
@@ -39,6 +52,35 @@ type Input struct {
 	StorageKey string `json:"storage_key"`
 	MimeType   string `json:"mime_type"`
 	Size       int64  `json:"size"`
+
+	// Format is the format sniffed from the image data, e.g. "jpeg"
+	Format string `json:"format,omitempty"`
+
+	// Width and Height are the image dimensions after EXIF orientation
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+}
+
+// Output describes how the result is encoded
+type Output struct {
+	// Format is the output format, e.g. "jpeg", "png" or "gif". Empty keeps
+	// the input format.
+	Format string `json:"format,omitempty"`
+
+	// Quality is 1-100 for lossy formats; 0 uses the encoder default
+	Quality int `json:"quality,omitempty"`
+
+	// Progressive requests progressive encoding where the encoder supports it
+	Progressive bool `json:"progressive,omitempty"`
+
+	// Compression is the PNG compression level: default, none, fast or best
+	Compression string `json:"compression,omitempty"`
+
+	// Metadata is the metadata policy: strip, copyright (the default) or all
+	Metadata string `json:"metadata,omitempty"`
+
+	// StripGPS drops location tags when the policy keeps all metadata
+	StripGPS bool `json:"strip_gps,omitempty"`
 }
 
 // Result represents the result of a completed job
@@ -49,6 +91,18 @@ type Result struct {
 	Size       int64  `json:"size"`
 	Width      int    `json:"width"`
 	Height     int    `json:"height"`
+
+	// Steps records each processing step in order. Jobs of a single
+	// operation have one step.
+	Steps []StepResult `json:"steps,omitempty"`
+}
+
+// StepResult records how one processing step ran
+type StepResult struct {
+	Processor  string  `json:"processor"`
+	DurationMs float64 `json:"duration_ms"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
 }
 
 // Metadata contains job metadata
@@ -63,8 +117,13 @@ type Metadata struct {
 
 // ResizeParams represents parameters for resize operation
 type ResizeParams struct {
-	Width  int `json:"width"`
-	Height int `json:"height"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+	Mode       string `json:"mode,omitempty"`
+	Gravity    string `json:"gravity,omitempty"`
+	Background string `json:"background,omitempty"`
+	Filter     string `json:"filter,omitempty"`
+	Linear     bool   `json:"linear,omitempty"`
 }
 
 // CropParams represents parameters for crop operation
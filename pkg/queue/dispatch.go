@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+// outcome is what a consumer should do with a message once it has been handled
+type outcome int
+
+const (
+	outcomeAck outcome = iota
+	outcomeRetry
+	outcomeDeadLetter
+)
+
+// dispatch decodes a message and runs handler on it. Permanent failures are
+// acked without retry. Undecodable messages and jobs failing on their last
+// allowed delivery are dead-lettered with the returned reason.
+//
+// Every allowed delivery ends in an ack, a retry or a dead letter, so a job
+// delivered more often than that never finished an attempt: its worker crashed
+// or was killed while handling it. Such a job is handed to handler with a
+// RetryCount above maxRetry, so that it can record the failure, and is then
+// dead-lettered whatever handler returns.
+func dispatch(ctx context.Context, data []byte, delivered, maxRetry int, handler JobHandler) (outcome, string) {
+	var j job.Job
+	if err := json.Unmarshal(data, &j); err != nil {
+		return outcomeDeadLetter, fmt.Sprintf("failed to decode job: %v", err)
+	}
+	j.Metadata.RetryCount = delivered - 1
+	if delivered > maxRetry+1 {
+		_ = handler(ctx, &j)
+		return outcomeDeadLetter, fmt.Sprintf("delivered %d times without completing, exceeding %d retries", delivered, maxRetry)
+	}
+
+	err := handler(ctx, &j)
+	switch {
+	case err == nil, job.IsPermanent(err):
+		return outcomeAck, ""
+	case delivered <= maxRetry:
+		return outcomeRetry, ""
+	default:
+		return outcomeDeadLetter, err.Error()
+	}
+}
+
+// decodeJob returns the job in a message, or nil if it is not a valid job
+func decodeJob(data []byte) *job.Job {
+	var j job.Job
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil
+	}
+	return &j
+}
+
+// retryDelay returns the backoff before redelivering a message that has been
+// delivered the given number of times: RetryBaseDelay doubled per delivery,
+// capped at RetryMaxDelay and spread by ±RetryJitter.
+func retryDelay(config Config, delivered int) time.Duration {
+	base := config.RetryBaseDelay
+	if base <= 0 {
+		return 0
+	}
+
+	delay := base
+	for i := 1; i < delivered; i++ {
+		delay *= 2
+		if config.RetryMaxDelay > 0 && delay >= config.RetryMaxDelay {
+			delay = config.RetryMaxDelay
+			break
+		}
+	}
+
+	if config.RetryJitter > 0 {
+		spread := config.RetryJitter * (2*rand.Float64() - 1) //nolint:gosec
+		delay += time.Duration(float64(delay) * spread)
+	}
+	return delay
+}
@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+func TestDispatch(t *testing.T) {
+	const maxRetry = 2
+	transient := errors.New("storage unavailable")
+	permanent := job.Permanent(job.CodeInvalidImage, errors.New("bad image"))
+
+	tests := []struct {
+		name       string
+		data       string
+		delivered  int
+		err        error
+		want       outcome
+		wantCalled bool
+	}{
+		{"success", `{"id":"a"}`, 1, nil, outcomeAck, true},
+		{"permanent failure", `{"id":"a"}`, 1, permanent, outcomeAck, true},
+		{"transient failure", `{"id":"a"}`, maxRetry, transient, outcomeRetry, true},
+		{"last delivery fails", `{"id":"a"}`, maxRetry + 1, transient, outcomeDeadLetter, true},
+		{"previous delivery crashed", `{"id":"a"}`, maxRetry + 2, nil, outcomeDeadLetter, true},
+		{"undecodable", `not json`, 1, nil, outcomeDeadLetter, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			got, reason := dispatch(context.Background(), []byte(tt.data), tt.delivered, maxRetry, func(context.Context, *job.Job) error {
+				called = true
+				return tt.err
+			})
+			if got != tt.want {
+				t.Errorf("outcome = %v, want %v", got, tt.want)
+			}
+			if called != tt.wantCalled {
+				t.Errorf("handler called = %v, want %v", called, tt.wantCalled)
+			}
+			if got == outcomeDeadLetter && reason == "" {
+				t.Error("expected a dead letter reason")
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	config := Config{
+		RetryBaseDelay: time.Second,
+		RetryMaxDelay:  10 * time.Second,
+	}
+
+	tests := []struct {
+		delivered int
+		want      time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(config, tt.delivered); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.delivered, got, tt.want)
+		}
+	}
+
+	config.RetryJitter = 0.5
+	for i := 0; i < 100; i++ {
+		got := retryDelay(config, 2)
+		if got < time.Second || got > 3*time.Second {
+			t.Fatalf("retryDelay(2) with jitter = %v, want within [1s, 3s]", got)
+		}
+	}
+
+	config.RetryBaseDelay = 0
+	if got := retryDelay(config, 3); got != 0 {
+		t.Errorf("retryDelay() without base delay = %v, want 0", got)
+	}
+}
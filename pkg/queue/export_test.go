@@ -0,0 +1,4 @@
+package queue
+
+// RunJetStreamServer starts an embedded JetStream server and returns its URL
+var RunJetStreamServer = runJetStreamServer
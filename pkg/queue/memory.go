@@ -0,0 +1,212 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+)
+
+// MemoryQueue implements Queue and DeadLetterQueue interfaces in process
+// memory, with the same retry and dead letter semantics as NATSQueue. Jobs do
+// not survive a restart, so it suits single-process development and tests.
+type MemoryQueue struct {
+	config Config
+	ready  chan struct{}
+
+	mu      sync.Mutex
+	pending []memoryMsg
+	dead    []*DeadLetter
+	lastSeq uint64
+}
+
+type memoryMsg struct {
+	data      []byte
+	delivered int
+}
+
+// NewMemoryQueue creates a new in-memory queue
+func NewMemoryQueue(config Config) *MemoryQueue {
+	return &MemoryQueue{
+		config: config,
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+// Publish publishes a job to the queue
+func (q *MemoryQueue) Publish(_ context.Context, job *job.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+	q.push(memoryMsg{data: data})
+	return nil
+}
+
+// Subscribe subscribes to jobs from the queue, running up to
+// config.Concurrency handlers at once. It returns once ctx is cancelled and
+// all in-flight handlers have finished.
+func (q *MemoryQueue) Subscribe(ctx context.Context, handler JobHandler) error {
+	concurrency := max(q.config.Concurrency, 1)
+
+	// In-flight jobs run to completion after ctx is cancelled.
+	jobCtx := context.WithoutCancel(ctx)
+
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for {
+		// Blocks while the pool is full.
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil
+		}
+
+		msg, ok := q.next(ctx)
+		if !ok {
+			wg.Wait()
+			return nil
+		}
+		msg.delivered++
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			q.handleMessage(jobCtx, msg, handler)
+		}()
+	}
+}
+
+// handleMessage runs handler on a message and drops, redelivers or
+// dead-letters it
+func (q *MemoryQueue) handleMessage(ctx context.Context, msg memoryMsg, handler JobHandler) {
+	switch result, reason := dispatch(ctx, msg.data, msg.delivered, q.config.MaxRetry, handler); result {
+	case outcomeRetry:
+		time.AfterFunc(retryDelay(q.config, msg.delivered), func() { q.push(msg) })
+	case outcomeDeadLetter:
+		q.mu.Lock()
+		q.lastSeq++
+		q.dead = append(q.dead, &DeadLetter{
+			Sequence:      q.lastSeq,
+			Job:           decodeJob(msg.data),
+			Data:          msg.data,
+			Reason:        reason,
+			DeliveryCount: msg.delivered,
+			FailedAt:      time.Now().UTC(),
+		})
+		q.mu.Unlock()
+	}
+}
+
+func (q *MemoryQueue) push(msg memoryMsg) {
+	q.mu.Lock()
+	q.pending = append(q.pending, msg)
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *MemoryQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// next blocks until a message is available or ctx is done
+func (q *MemoryQueue) next(ctx context.Context) (memoryMsg, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.pending) > 0 {
+			msg := q.pending[0]
+			q.pending = q.pending[1:]
+			more := len(q.pending) > 0
+			q.mu.Unlock()
+			// Wake another subscriber for the remaining messages.
+			if more {
+				q.signal()
+			}
+			return msg, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return memoryMsg{}, false
+		}
+	}
+}
+
+// ListDeadLetters returns up to limit dead letters starting at sequence from
+func (q *MemoryQueue) ListDeadLetters(_ context.Context, from uint64, limit int) ([]*DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var letters []*DeadLetter
+	for _, dl := range q.dead {
+		if dl.Sequence < from {
+			continue
+		}
+		if limit > 0 && len(letters) >= limit {
+			break
+		}
+		letters = append(letters, dl)
+	}
+	return letters, nil
+}
+
+// GetDeadLetter returns a single dead letter by sequence
+func (q *MemoryQueue) GetDeadLetter(_ context.Context, seq uint64) (*DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, dl := range q.dead {
+		if dl.Sequence == seq {
+			return dl, nil
+		}
+	}
+	return nil, ErrDeadLetterNotFound
+}
+
+// ReplayDeadLetter republishes a dead letter to the work queue and removes it
+func (q *MemoryQueue) ReplayDeadLetter(_ context.Context, seq uint64) error {
+	q.mu.Lock()
+	var replay *DeadLetter
+	for i, dl := range q.dead {
+		if dl.Sequence == seq {
+			replay = dl
+			q.dead = append(q.dead[:i], q.dead[i+1:]...)
+			break
+		}
+	}
+	q.mu.Unlock()
+
+	if replay == nil {
+		return ErrDeadLetterNotFound
+	}
+	q.push(memoryMsg{data: replay.Data})
+	return nil
+}
+
+// PurgeDeadLetters removes all dead letters
+func (q *MemoryQueue) PurgeDeadLetters(_ context.Context) error {
+	q.mu.Lock()
+	q.dead = nil
+	q.mu.Unlock()
+	return nil
+}
+
+// Close is a no-op; pending jobs are discarded with the queue
+func (q *MemoryQueue) Close() error {
+	return nil
+}
+
+// Ping always succeeds, for symmetry with NATSQueue
+func (q *MemoryQueue) Ping(_ context.Context) error {
+	return nil
+}
@@ -3,7 +3,10 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/mohammed-ysn/cluster-imager/pkg/job"
@@ -11,17 +14,35 @@ import (
 	"github.com/nats-io/nats.go/jetstream"
 )
 
-// NATSQueue implements Queue interface using NATS JetStream
+const (
+	// deadLetterMaxAge is how long dead letters are kept for inspection and replay
+	deadLetterMaxAge = 7 * 24 * time.Hour
+	// defaultAckWait is used when Config.AckWait is not set
+	defaultAckWait = 30 * time.Second
+	// fetchWait bounds each pull request, so a cancelled Subscribe returns
+	// promptly while the stream is idle
+	fetchWait = time.Second
+)
+
+// NATSQueue implements Queue and DeadLetterQueue interfaces using NATS JetStream
 type NATSQueue struct {
 	nc       *nats.Conn
 	js       jetstream.JetStream
 	stream   jetstream.Stream
+	dlq      jetstream.Stream
 	consumer jetstream.Consumer
 	config   Config
 }
 
 // NewNATSQueue creates a new NATS JetStream queue
 func NewNATSQueue(config Config) (*NATSQueue, error) {
+	if config.DeadLetterStream == "" {
+		config.DeadLetterStream = config.Stream + "_DLQ"
+	}
+	if config.DeadLetterSubject == "" {
+		config.DeadLetterSubject = config.Subject + ".dlq"
+	}
+
 	// Connect to NATS
 	nc, err := nats.Connect(config.URL)
 	if err != nil {
@@ -36,34 +57,48 @@ func NewNATSQueue(config Config) (*NATSQueue, error) {
 	}
 
 	// Create or get stream
-	stream, err := createOrGetStream(js, config)
+	stream, err := createOrGetStream(js, jetstream.StreamConfig{
+		Name:     config.Stream,
+		Subjects: []string{config.Subject},
+		Storage:  jetstream.FileStorage,
+		Replicas: 1,
+		MaxAge:   24 * time.Hour,
+		MaxMsgs:  -1,
+		MaxBytes: -1,
+	})
 	if err != nil {
 		nc.Close()
 		return nil, fmt.Errorf("failed to create/get stream: %w", err)
 	}
 
+	// Create or get dead letter stream
+	dlq, err := createOrGetStream(js, jetstream.StreamConfig{
+		Name:     config.DeadLetterStream,
+		Subjects: []string{config.DeadLetterSubject},
+		Storage:  jetstream.FileStorage,
+		Replicas: 1,
+		MaxAge:   deadLetterMaxAge,
+		MaxMsgs:  -1,
+		MaxBytes: -1,
+	})
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to create/get dead letter stream: %w", err)
+	}
+
 	return &NATSQueue{
 		nc:     nc,
 		js:     js,
 		stream: stream,
+		dlq:    dlq,
 		config: config,
 	}, nil
 }
 
 // createOrGetStream creates or gets an existing stream
-func createOrGetStream(js jetstream.JetStream, config Config) (jetstream.Stream, error) {
-	streamConfig := jetstream.StreamConfig{
-		Name:     config.Stream,
-		Subjects: []string{config.Subject},
-		Storage:  jetstream.FileStorage,
-		Replicas: 1,
-		MaxAge:   24 * time.Hour,
-		MaxMsgs:  -1,
-		MaxBytes: -1,
-	}
-
+func createOrGetStream(js jetstream.JetStream, streamConfig jetstream.StreamConfig) (jetstream.Stream, error) {
 	// Try to get existing stream
-	stream, err := js.Stream(context.Background(), config.Stream)
+	stream, err := js.Stream(context.Background(), streamConfig.Name)
 	if err == nil {
 		return stream, nil
 	}
@@ -94,79 +129,218 @@ func (q *NATSQueue) Publish(ctx context.Context, job *job.Job) error {
 	return nil
 }
 
-// Subscribe subscribes to jobs from the queue
+// Subscribe subscribes to jobs from the queue, running up to
+// config.Concurrency handlers at once. It returns once ctx is cancelled and
+// all in-flight handlers have finished and acked their messages.
 func (q *NATSQueue) Subscribe(ctx context.Context, handler JobHandler) error {
 	// Create or get consumer
-	consumer, err := q.createOrGetConsumer()
+	consumer, err := q.createOrUpdateConsumer()
 	if err != nil {
 		return fmt.Errorf("failed to create/get consumer: %w", err)
 	}
 	q.consumer = consumer
 
-	// Consume messages
-	msgs, err := consumer.Messages()
+	concurrency := max(q.config.Concurrency, 1)
+
+	// In-flight jobs run to completion after ctx is cancelled so they can ack.
+	jobCtx := context.WithoutCancel(ctx)
+
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for ctx.Err() == nil {
+		// Pull a message only once a slot is free, so no message waits in a
+		// client buffer while its ack deadline runs down.
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+
+		msg, ok := q.fetch(consumer)
+		if !ok {
+			<-slots
+			continue
+		}
+		if ctx.Err() != nil {
+			// Cancelled while fetching; leave the job to another worker.
+			_ = msg.Nak()
+			<-slots
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			q.handleMessage(jobCtx, msg, handler)
+		}()
+	}
+
+	wg.Wait()
+	return nil
+}
+
+// fetch pulls a single message, waiting up to fetchWait for one to arrive
+func (q *NATSQueue) fetch(consumer jetstream.Consumer) (jetstream.Msg, bool) {
+	batch, err := consumer.Fetch(1, jetstream.FetchMaxWait(fetchWait))
 	if err != nil {
-		return fmt.Errorf("failed to get message channel: %w", err)
+		// The connection is down; wait before asking again.
+		time.Sleep(fetchWait)
+		return nil, false
 	}
+	msg, ok := <-batch.Messages()
+	return msg, ok
+}
 
+// handleMessage runs handler on a message and acks, naks or dead-letters it.
+// While the handler runs, the message's ack deadline is extended so a long
+// job is not redelivered to another worker.
+func (q *NATSQueue) handleMessage(ctx context.Context, msg jetstream.Msg, handler JobHandler) {
+	delivered := 1
+	if meta, err := msg.Metadata(); err == nil {
+		delivered = int(meta.NumDelivered) //nolint:gosec
+	}
+
+	stop := q.keepAlive(msg)
+	result, reason := dispatch(ctx, msg.Data(), delivered, q.config.MaxRetry, handler)
+	stop()
+
+	switch result {
+	case outcomeRetry:
+		_ = msg.NakWithDelay(retryDelay(q.config, delivered))
+	case outcomeDeadLetter:
+		q.deadLetter(ctx, msg, reason, delivered)
+	default:
+		// Wait for the server to confirm so a draining worker exits only
+		// once its jobs are acknowledged.
+		_ = msg.DoubleAck(ctx)
+	}
+}
+
+// keepAlive reports progress on msg every third of the ack wait until the
+// returned function is called
+func (q *NATSQueue) keepAlive(msg jetstream.Msg) (stop func()) {
+	done := make(chan struct{})
 	go func() {
-		defer msgs.Stop()
+		ticker := time.NewTicker(q.ackWait() / 3)
+		defer ticker.Stop()
 		for {
-			msg, err := msgs.Next()
-			if err != nil {
-				if ctx.Err() != nil {
-					return
-				}
-				continue
+			select {
+			case <-ticker.C:
+				_ = msg.InProgress()
+			case <-done:
+				return
 			}
+		}
+	}()
+	return func() { close(done) }
+}
 
-			var j job.Job
-			if err := json.Unmarshal(msg.Data(), &j); err != nil {
-				_ = msg.Ack()
-				continue
-			}
+func (q *NATSQueue) ackWait() time.Duration {
+	if q.config.AckWait > 0 {
+		return q.config.AckWait
+	}
+	return defaultAckWait
+}
+
+// deadLetter publishes msg to the dead letter stream and acks it. If the
+// publish fails the message is nak'd so it is not lost.
+func (q *NATSQueue) deadLetter(ctx context.Context, msg jetstream.Msg, reason string, delivered int) {
+	dl := nats.NewMsg(q.config.DeadLetterSubject)
+	dl.Data = msg.Data()
+	dl.Header.Set(HeaderDeadLetterReason, reason)
+	dl.Header.Set(HeaderDeadLetterDeliveryCount, strconv.Itoa(delivered))
+	dl.Header.Set(HeaderDeadLetterFailedAt, time.Now().UTC().Format(time.RFC3339Nano))
+
+	if _, err := q.js.PublishMsg(ctx, dl); err != nil {
+		_ = msg.Nak()
+		return
+	}
+	_ = msg.DoubleAck(ctx)
+}
 
-			if err := handler(ctx, &j); err != nil {
-				if j.Metadata.RetryCount < q.config.MaxRetry {
-					_ = msg.Nak()
-				} else {
-					_ = msg.Ack()
-				}
-			} else {
-				_ = msg.Ack()
+// ListDeadLetters returns up to limit dead letters starting at sequence from
+func (q *NATSQueue) ListDeadLetters(ctx context.Context, from uint64, limit int) ([]*DeadLetter, error) {
+	var letters []*DeadLetter
+	seq := max(from, 1)
+	for limit <= 0 || len(letters) < limit {
+		raw, err := q.dlq.GetMsg(ctx, seq, jetstream.WithGetMsgSubject(q.config.DeadLetterSubject))
+		if err != nil {
+			if errors.Is(err, jetstream.ErrMsgNotFound) {
+				break
 			}
+			return nil, fmt.Errorf("failed to get dead letter: %w", err)
 		}
-	}()
+		letters = append(letters, newDeadLetter(raw))
+		seq = raw.Sequence + 1
+	}
+	return letters, nil
+}
+
+// GetDeadLetter returns a single dead letter by sequence
+func (q *NATSQueue) GetDeadLetter(ctx context.Context, seq uint64) (*DeadLetter, error) {
+	raw, err := q.dlq.GetMsg(ctx, seq)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			return nil, ErrDeadLetterNotFound
+		}
+		return nil, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+	return newDeadLetter(raw), nil
+}
+
+// ReplayDeadLetter republishes a dead letter to the work queue and removes it
+func (q *NATSQueue) ReplayDeadLetter(ctx context.Context, seq uint64) error {
+	dl, err := q.GetDeadLetter(ctx, seq)
+	if err != nil {
+		return err
+	}
+
+	if _, err := q.js.Publish(ctx, q.config.Subject, dl.Data); err != nil {
+		return fmt.Errorf("failed to replay dead letter: %w", err)
+	}
+
+	if err := q.dlq.DeleteMsg(ctx, seq); err != nil {
+		return fmt.Errorf("failed to delete dead letter: %w", err)
+	}
+	return nil
+}
 
-	<-ctx.Done()
+// PurgeDeadLetters removes all dead letters
+func (q *NATSQueue) PurgeDeadLetters(ctx context.Context) error {
+	if err := q.dlq.Purge(ctx); err != nil {
+		return fmt.Errorf("failed to purge dead letters: %w", err)
+	}
 	return nil
 }
 
-// createOrGetConsumer creates or gets an existing consumer
-func (q *NATSQueue) createOrGetConsumer() (jetstream.Consumer, error) {
+func newDeadLetter(raw *jetstream.RawStreamMsg) *DeadLetter {
+	dl := &DeadLetter{
+		Sequence: raw.Sequence,
+		Data:     raw.Data,
+		Reason:   raw.Header.Get(HeaderDeadLetterReason),
+	}
+	dl.DeliveryCount, _ = strconv.Atoi(raw.Header.Get(HeaderDeadLetterDeliveryCount))
+	dl.FailedAt, _ = time.Parse(time.RFC3339Nano, raw.Header.Get(HeaderDeadLetterFailedAt))
+
+	dl.Job = decodeJob(raw.Data)
+	return dl
+}
+
+// createOrUpdateConsumer creates the consumer, or applies the current config
+// to an existing one so that upgrades take effect
+func (q *NATSQueue) createOrUpdateConsumer() (jetstream.Consumer, error) {
 	consumerConfig := jetstream.ConsumerConfig{
 		Name:          q.config.Consumer,
 		Durable:       q.config.Consumer,
 		AckPolicy:     jetstream.AckExplicitPolicy,
-		MaxDeliver:    q.config.MaxRetry + 1,
+		MaxDeliver:    -1, // retries are limited by dispatch, which dead-letters exhausted and crashing jobs
 		FilterSubject: q.config.Subject,
-		AckWait:       30 * time.Second,
+		AckWait:       q.ackWait(),
 		MaxAckPending: 100,
 	}
 
-	// Try to get existing consumer
-	consumer, err := q.stream.Consumer(context.Background(), q.config.Consumer)
-	if err == nil {
-		return consumer, nil
-	}
-
-	// Create new consumer
-	consumer, err = q.stream.CreateConsumer(context.Background(), consumerConfig)
-	if err != nil {
-		return nil, err
-	}
-
-	return consumer, nil
+	return q.stream.CreateOrUpdateConsumer(context.Background(), consumerConfig)
 }
 
 // Close closes the queue connections
@@ -175,4 +349,15 @@ func (q *NATSQueue) Close() error {
 		q.nc.Close()
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// Ping checks that NATS is connected and the job stream is available
+func (q *NATSQueue) Ping(ctx context.Context) error {
+	if !q.nc.IsConnected() {
+		return fmt.Errorf("not connected to NATS: %s", q.nc.Status())
+	}
+	if _, err := q.stream.Info(ctx); err != nil {
+		return fmt.Errorf("failed to get stream info: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func runJetStreamServer(t *testing.T) string {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(srv.Shutdown)
+	return srv.ClientURL()
+}
+
+func newTestNATSQueue(t *testing.T, concurrency int) *NATSQueue {
+	t.Helper()
+	return newTestNATSQueueWithConfig(t, Config{
+		Stream:      "TEST",
+		Subject:     "test.jobs",
+		Consumer:    "test-worker",
+		MaxRetry:    3,
+		Concurrency: concurrency,
+	})
+}
+
+func newTestNATSQueueWithConfig(t *testing.T, config Config) *NATSQueue {
+	t.Helper()
+	config.URL = runJetStreamServer(t)
+	q, err := NewNATSQueue(config)
+	if err != nil {
+		t.Fatalf("NewNATSQueue() error = %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestNATSQueue_DrainOnCancel(t *testing.T) {
+	q := newTestNATSQueue(t, 2)
+	ctx := context.Background()
+
+	if err := q.Publish(ctx, &job.Job{ID: "slow"}); err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	var finished atomic.Bool
+	var handlerCtxErr error
+
+	subCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Subscribe(subCtx, func(ctx context.Context, _ *job.Job) error {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			handlerCtxErr = ctx.Err()
+			finished.Store(true)
+			return nil
+		})
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler was not called")
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Subscribe() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Subscribe did not return after cancel")
+	}
+	if !finished.Load() {
+		t.Error("Subscribe returned before the in-flight handler finished")
+	}
+	if handlerCtxErr != nil {
+		t.Errorf("handler context cancelled during drain: %v", handlerCtxErr)
+	}
+
+	info, err := q.consumer.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.NumAckPending != 0 {
+		t.Errorf("NumAckPending = %d, want 0", info.NumAckPending)
+	}
+}
+
+func waitForDeadLetters(t *testing.T, q *NATSQueue, n int) []*DeadLetter {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		letters, err := q.ListDeadLetters(context.Background(), 0, 0)
+		if err != nil {
+			t.Fatalf("ListDeadLetters() error = %v", err)
+		}
+		if len(letters) >= n {
+			return letters
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d dead letters, want %d", len(letters), n)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestNATSQueue_DeadLetterPoisonMessage(t *testing.T) {
+	q := newTestNATSQueue(t, 1)
+	ctx := context.Background()
+
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go q.Subscribe(subCtx, func(_ context.Context, _ *job.Job) error { return nil })
+
+	if _, err := q.js.Publish(ctx, q.config.Subject, []byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+
+	letters := waitForDeadLetters(t, q, 1)
+	if letters[0].Job != nil {
+		t.Errorf("expected nil job for poison message, got %+v", letters[0].Job)
+	}
+	if string(letters[0].Data) != "not json" {
+		t.Errorf("Data = %q", letters[0].Data)
+	}
+	if letters[0].DeliveryCount != 1 {
+		t.Errorf("DeliveryCount = %d, want 1", letters[0].DeliveryCount)
+	}
+
+	if err := q.PurgeDeadLetters(ctx); err != nil {
+		t.Fatalf("PurgeDeadLetters() error = %v", err)
+	}
+	letters, err := q.ListDeadLetters(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 0 {
+		t.Errorf("got %d dead letters after purge, want 0", len(letters))
+	}
+}
+
+func TestNATSQueue_RetryCountFromDelivery(t *testing.T) {
+	q := newTestNATSQueueWithConfig(t, Config{
+		Stream:         "TEST",
+		Subject:        "test.jobs",
+		Consumer:       "test-worker",
+		MaxRetry:       2,
+		RetryBaseDelay: 50 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var retries []int
+	var times []time.Time
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go q.Subscribe(subCtx, func(_ context.Context, j *job.Job) error {
+		mu.Lock()
+		retries = append(retries, j.Metadata.RetryCount)
+		times = append(times, time.Now())
+		mu.Unlock()
+		return errors.New("fail")
+	})
+
+	if err := q.Publish(ctx, &job.Job{ID: "retry"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForDeadLetters(t, q, 1)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(retries) != 3 || retries[0] != 0 || retries[1] != 1 || retries[2] != 2 {
+		t.Fatalf("retry counts = %v, want [0 1 2]", retries)
+	}
+	if gap := times[2].Sub(times[1]); gap < 100*time.Millisecond {
+		t.Errorf("second redelivery after %v, want at least 100ms backoff", gap)
+	}
+}
+
+func TestNATSQueue_PullsOnlyForFreeSlots(t *testing.T) {
+	q := newTestNATSQueue(t, 1)
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := q.Publish(ctx, &job.Job{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go q.Subscribe(subCtx, func(_ context.Context, _ *job.Job) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler was not called")
+	}
+	// Give a prefetching consumer time to pull more than it can run.
+	time.Sleep(300 * time.Millisecond)
+
+	info, err := q.consumer.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.NumAckPending != 1 {
+		t.Errorf("NumAckPending = %d, want 1", info.NumAckPending)
+	}
+	close(release)
+}
+
+func TestNATSQueue_LongJobNotRedelivered(t *testing.T) {
+	q := newTestNATSQueueWithConfig(t, Config{
+		Stream:      "TEST",
+		Subject:     "test.jobs",
+		Consumer:    "test-worker",
+		MaxRetry:    3,
+		Concurrency: 2,
+		AckWait:     500 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	done := make(chan struct{})
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go q.Subscribe(subCtx, func(_ context.Context, _ *job.Job) error {
+		if calls.Add(1) == 1 {
+			time.Sleep(1500 * time.Millisecond)
+			close(done)
+		}
+		return nil
+	})
+
+	if err := q.Publish(ctx, &job.Job{ID: "long"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not finish")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("handler called %d times, want 1", n)
+	}
+}
+
+func TestNATSQueue_DeadLetterCrashingJob(t *testing.T) {
+	q := newTestNATSQueueWithConfig(t, Config{
+		Stream:   "TEST",
+		Subject:  "test.jobs",
+		Consumer: "test-worker",
+		MaxRetry: 1,
+		AckWait:  200 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	if err := q.Publish(ctx, &job.Job{ID: "crash"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Take every allowed delivery without acking, as a worker killed
+	// mid-job would.
+	consumer, err := q.createOrUpdateConsumer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range q.config.MaxRetry + 1 {
+		batch, err := consumer.Fetch(1, jetstream.FetchMaxWait(2*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := <-batch.Messages(); !ok {
+			t.Fatal("expected a delivery")
+		}
+	}
+
+	var calls, retryCount atomic.Int32
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go q.Subscribe(subCtx, func(_ context.Context, j *job.Job) error {
+		calls.Add(1)
+		retryCount.Store(int32(j.Metadata.RetryCount)) //nolint:gosec
+		return nil
+	})
+
+	letters := waitForDeadLetters(t, q, 1)
+	if letters[0].DeliveryCount != q.config.MaxRetry+2 {
+		t.Errorf("DeliveryCount = %d, want %d", letters[0].DeliveryCount, q.config.MaxRetry+2)
+	}
+	// The handler is told, so that it can fail the job, but the job is
+	// dead-lettered even though the handler succeeded
+	if n := calls.Load(); n != 1 {
+		t.Errorf("handler called %d times, want 1", n)
+	}
+	if n := retryCount.Load(); int(n) <= q.config.MaxRetry {
+		t.Errorf("RetryCount = %d, want more than %d", n, q.config.MaxRetry)
+	}
+}
+
+func TestNATSQueue_UpdatesExistingConsumer(t *testing.T) {
+	q := newTestNATSQueueWithConfig(t, Config{
+		Stream:   "TEST",
+		Subject:  "test.jobs",
+		Consumer: "test-worker",
+		AckWait:  2 * time.Second,
+	})
+	ctx := context.Background()
+
+	// A consumer left by an earlier version, with different settings
+	if _, err := q.stream.CreateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:       "test-worker",
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		MaxDeliver:    4,
+		FilterSubject: "test.jobs",
+		AckWait:       time.Minute,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	consumer, err := q.createOrUpdateConsumer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := consumer.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Config.AckWait != 2*time.Second || info.Config.MaxDeliver != -1 {
+		t.Errorf("consumer AckWait = %v, MaxDeliver = %d, want 2s and -1", info.Config.AckWait, info.Config.MaxDeliver)
+	}
+}
@@ -2,10 +2,22 @@ package queue
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/mohammed-ysn/cluster-imager/pkg/job"
 )
 
+// Headers recorded on dead-lettered messages
+const (
+	HeaderDeadLetterReason        = "Dead-Letter-Reason"
+	HeaderDeadLetterDeliveryCount = "Dead-Letter-Delivery-Count"
+	HeaderDeadLetterFailedAt      = "Dead-Letter-Failed-At"
+)
+
+// ErrDeadLetterNotFound is returned when a dead letter does not exist
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
 // Publisher publishes jobs to the queue
 type Publisher interface {
 	// Publish publishes a job to the queue
@@ -26,6 +38,10 @@ type Consumer interface {
 }
 
 // JobHandler processes a job
+// Errors classified with job.Permanent are not retried
+// A job whose Metadata.RetryCount exceeds MaxRetry was abandoned by crashed
+// workers on every attempt; the handler should record its failure without
+// processing it, and it is dead-lettered
 type JobHandler func(ctx context.Context, job *job.Job) error
 
 // Queue combines publisher and consumer interfaces
@@ -34,6 +50,32 @@ type Queue interface {
 	Consumer
 }
 
+// DeadLetter is a job message that exhausted its retries or could not be decoded
+type DeadLetter struct {
+	Sequence      uint64    `json:"sequence"`
+	Job           *job.Job  `json:"job,omitempty"` // nil if the message is not a valid job
+	Data          []byte    `json:"data"`
+	Reason        string    `json:"reason"`
+	DeliveryCount int       `json:"delivery_count"`
+	FailedAt      time.Time `json:"failed_at"`
+}
+
+// DeadLetterQueue gives access to jobs that could not be processed
+type DeadLetterQueue interface {
+	// ListDeadLetters returns up to limit dead letters starting at sequence from
+	// A limit of 0 returns all of them
+	ListDeadLetters(ctx context.Context, from uint64, limit int) ([]*DeadLetter, error)
+
+	// GetDeadLetter returns a single dead letter by sequence
+	GetDeadLetter(ctx context.Context, seq uint64) (*DeadLetter, error)
+
+	// ReplayDeadLetter republishes a dead letter to the work queue and removes it
+	ReplayDeadLetter(ctx context.Context, seq uint64) error
+
+	// PurgeDeadLetters removes all dead letters
+	PurgeDeadLetters(ctx context.Context) error
+}
+
 // Config represents queue configuration
 type Config struct {
 	URL      string
@@ -41,4 +83,22 @@ type Config struct {
 	Subject  string
 	Consumer string
 	MaxRetry int
+
+	// DeadLetterStream and DeadLetterSubject default to Stream+"_DLQ" and Subject+".dlq"
+	DeadLetterStream  string
+	DeadLetterSubject string
+
+	// Concurrency is the number of jobs a consumer handles at once
+	Concurrency int
+
+	// AckWait is how long a delivered job may go without an ack or progress
+	// report before it is redelivered. Defaults to 30s.
+	AckWait time.Duration
+
+	// Failed jobs are redelivered after RetryBaseDelay, doubling on each
+	// attempt up to RetryMaxDelay. RetryJitter randomises each delay by up
+	// to that fraction. A zero RetryBaseDelay redelivers immediately.
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	RetryJitter    float64
 }
\ No newline at end of file
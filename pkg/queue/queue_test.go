@@ -0,0 +1,25 @@
+package queue_test
+
+import (
+	"testing"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/queue"
+	"github.com/mohammed-ysn/cluster-imager/pkg/queue/queuetest"
+)
+
+func TestMemoryQueue(t *testing.T) {
+	queuetest.RunQueueSuite(t, func(_ *testing.T, config queue.Config) queue.Queue {
+		return queue.NewMemoryQueue(config)
+	})
+}
+
+func TestNATSQueue(t *testing.T) {
+	queuetest.RunQueueSuite(t, func(t *testing.T, config queue.Config) queue.Queue {
+		config.URL = queue.RunJetStreamServer(t)
+		q, err := queue.NewNATSQueue(config)
+		if err != nil {
+			t.Fatalf("NewNATSQueue() error = %v", err)
+		}
+		return q
+	})
+}
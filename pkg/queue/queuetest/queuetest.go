@@ -0,0 +1,416 @@
+// Package queuetest provides a conformance suite for queue.Queue
+// implementations.
+package queuetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/job"
+	"github.com/mohammed-ysn/cluster-imager/pkg/queue"
+)
+
+// waitTimeout bounds how long the suite waits for asynchronous deliveries
+const waitTimeout = 5 * time.Second
+
+// RunQueueSuite runs the queue.Queue conformance tests. newQueue is called
+// once per subtest with the stream, subject, consumer and retry settings
+// filled in, and must return an empty queue. Dead-letter tests run only if
+// the queue implements queue.DeadLetterQueue.
+func RunQueueSuite(t *testing.T, newQueue func(t *testing.T, config queue.Config) queue.Queue) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, newQueue func(config queue.Config) queue.Queue)
+	}{
+		{"Deliver", testDeliver},
+		{"Ordering", testOrdering},
+		{"Redelivery", testRedelivery},
+		{"PermanentFailureNotRetried", testPermanentFailureNotRetried},
+		{"DeadLetter", testDeadLetter},
+		{"ConcurrentPublish", testConcurrentPublish},
+		{"ConcurrencyBound", testConcurrencyBound},
+		{"DrainOnCancel", testDrainOnCancel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, func(config queue.Config) queue.Queue {
+				config.Stream = "TEST"
+				config.Subject = "test.jobs"
+				config.Consumer = "test-worker"
+				q := newQueue(t, config)
+				t.Cleanup(func() { q.Close() })
+				return q
+			})
+		})
+	}
+}
+
+// subscribe runs handler on q until the test ends
+func subscribe(t *testing.T, q queue.Queue, handler queue.JobHandler) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Subscribe(ctx, handler)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func mustPublish(t *testing.T, q queue.Queue, j *job.Job) {
+	t.Helper()
+	if err := q.Publish(context.Background(), j); err != nil {
+		t.Fatalf("Publish(%s) error = %v", j.ID, err)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func waitForDeadLetters(t *testing.T, dlq queue.DeadLetterQueue, n int) []*queue.DeadLetter {
+	t.Helper()
+	var letters []*queue.DeadLetter
+	waitFor(t, fmt.Sprintf("%d dead letters", n), func() bool {
+		var err error
+		letters, err = dlq.ListDeadLetters(context.Background(), 0, 0)
+		if err != nil {
+			t.Fatalf("ListDeadLetters() error = %v", err)
+		}
+		return len(letters) >= n
+	})
+	return letters
+}
+
+func testDeliver(t *testing.T, newQueue func(queue.Config) queue.Queue) {
+	q := newQueue(queue.Config{MaxRetry: 3})
+
+	received := make(chan *job.Job, 1)
+	subscribe(t, q, func(_ context.Context, j *job.Job) error {
+		received <- j
+		return nil
+	})
+
+	mustPublish(t, q, &job.Job{
+		ID:         "j1",
+		Type:       job.TypeResize,
+		Parameters: map[string]interface{}{"width": 100},
+		Input:      job.Input{StorageKey: "uploads/j1.jpg"},
+	})
+
+	select {
+	case j := <-received:
+		if j.ID != "j1" || j.Type != job.TypeResize || j.Input.StorageKey != "uploads/j1.jpg" {
+			t.Errorf("received %+v", j)
+		}
+		if j.Parameters["width"] != float64(100) {
+			t.Errorf("Parameters[width] = %#v, want float64(100)", j.Parameters["width"])
+		}
+		if j.Metadata.RetryCount != 0 {
+			t.Errorf("RetryCount = %d, want 0", j.Metadata.RetryCount)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("job was not delivered")
+	}
+}
+
+func testOrdering(t *testing.T, newQueue func(queue.Config) queue.Queue) {
+	const n = 10
+	q := newQueue(queue.Config{MaxRetry: 3, Concurrency: 1})
+
+	for i := range n {
+		mustPublish(t, q, &job.Job{ID: fmt.Sprintf("j%d", i)})
+	}
+
+	var mu sync.Mutex
+	var got []string
+	subscribe(t, q, func(_ context.Context, j *job.Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, j.ID)
+		return nil
+	})
+
+	waitFor(t, "all jobs", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == n
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	for i, id := range got {
+		if want := fmt.Sprintf("j%d", i); id != want {
+			t.Fatalf("delivery order = %v, want j0..j%d", got, n-1)
+		}
+	}
+}
+
+func testRedelivery(t *testing.T, newQueue func(queue.Config) queue.Queue) {
+	q := newQueue(queue.Config{MaxRetry: 2, RetryBaseDelay: time.Millisecond})
+
+	var mu sync.Mutex
+	var retries []int
+	subscribe(t, q, func(_ context.Context, j *job.Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		retries = append(retries, j.Metadata.RetryCount)
+		return errors.New("fail")
+	})
+
+	mustPublish(t, q, &job.Job{ID: "j1"})
+
+	waitFor(t, "redeliveries", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(retries) >= 3
+	})
+	// Give the queue a chance to deliver past MaxRetry if it were going to.
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(retries) != 3 || retries[0] != 0 || retries[1] != 1 || retries[2] != 2 {
+		t.Errorf("retry counts = %v, want [0 1 2]", retries)
+	}
+}
+
+func testPermanentFailureNotRetried(t *testing.T, newQueue func(queue.Config) queue.Queue) {
+	q := newQueue(queue.Config{MaxRetry: 3})
+
+	var calls atomic.Int32
+	subscribe(t, q, func(_ context.Context, _ *job.Job) error {
+		calls.Add(1)
+		return job.Permanent(job.CodeInvalidImage, errors.New("corrupt"))
+	})
+
+	mustPublish(t, q, &job.Job{ID: "bad"})
+
+	waitFor(t, "delivery", func() bool { return calls.Load() > 0 })
+	time.Sleep(200 * time.Millisecond)
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("handler called %d times, want 1", got)
+	}
+	if dlq, ok := q.(queue.DeadLetterQueue); ok {
+		letters, err := dlq.ListDeadLetters(context.Background(), 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(letters) != 0 {
+			t.Errorf("got %d dead letters, want 0", len(letters))
+		}
+	}
+}
+
+func testDeadLetter(t *testing.T, newQueue func(queue.Config) queue.Queue) {
+	q := newQueue(queue.Config{MaxRetry: 2, RetryBaseDelay: time.Millisecond})
+	dlq, ok := q.(queue.DeadLetterQueue)
+	if !ok {
+		t.Skip("queue does not implement queue.DeadLetterQueue")
+	}
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	var succeed atomic.Bool
+	subscribe(t, q, func(_ context.Context, _ *job.Job) error {
+		calls.Add(1)
+		if succeed.Load() {
+			return nil
+		}
+		return errors.New("storage unavailable")
+	})
+
+	mustPublish(t, q, &job.Job{ID: "doomed"})
+
+	dl := waitForDeadLetters(t, dlq, 1)[0]
+	if dl.Job == nil || dl.Job.ID != "doomed" {
+		t.Errorf("dead letter job = %+v, want doomed", dl.Job)
+	}
+	if dl.Reason != "storage unavailable" {
+		t.Errorf("Reason = %q", dl.Reason)
+	}
+	if dl.DeliveryCount != 3 {
+		t.Errorf("DeliveryCount = %d, want 3", dl.DeliveryCount)
+	}
+	if dl.FailedAt.IsZero() {
+		t.Error("FailedAt not set")
+	}
+	if len(dl.Data) == 0 {
+		t.Error("Data not set")
+	}
+
+	got, err := dlq.GetDeadLetter(ctx, dl.Sequence)
+	if err != nil {
+		t.Fatalf("GetDeadLetter() error = %v", err)
+	}
+	if got.Reason != dl.Reason || got.Sequence != dl.Sequence {
+		t.Errorf("GetDeadLetter() = %+v, want %+v", got, dl)
+	}
+	if _, err := dlq.GetDeadLetter(ctx, dl.Sequence+100); !errors.Is(err, queue.ErrDeadLetterNotFound) {
+		t.Errorf("GetDeadLetter() of unknown sequence error = %v, want ErrDeadLetterNotFound", err)
+	}
+
+	succeed.Store(true)
+	if err := dlq.ReplayDeadLetter(ctx, dl.Sequence); err != nil {
+		t.Fatalf("ReplayDeadLetter() error = %v", err)
+	}
+	waitFor(t, "replayed job", func() bool { return calls.Load() == 4 })
+	if _, err := dlq.GetDeadLetter(ctx, dl.Sequence); !errors.Is(err, queue.ErrDeadLetterNotFound) {
+		t.Errorf("GetDeadLetter() after replay error = %v, want ErrDeadLetterNotFound", err)
+	}
+
+	succeed.Store(false)
+	mustPublish(t, q, &job.Job{ID: "doomed-again"})
+	waitForDeadLetters(t, dlq, 1)
+	if err := dlq.PurgeDeadLetters(ctx); err != nil {
+		t.Fatalf("PurgeDeadLetters() error = %v", err)
+	}
+	letters, err := dlq.ListDeadLetters(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 0 {
+		t.Errorf("got %d dead letters after purge, want 0", len(letters))
+	}
+}
+
+func testConcurrentPublish(t *testing.T, newQueue func(queue.Config) queue.Queue) {
+	const publishers, perPublisher = 8, 10
+	q := newQueue(queue.Config{MaxRetry: 3, Concurrency: 4})
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	subscribe(t, q, func(_ context.Context, j *job.Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[j.ID]++
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for p := range publishers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perPublisher {
+				id := fmt.Sprintf("p%d-%d", p, i)
+				if err := q.Publish(context.Background(), &job.Job{ID: id}); err != nil {
+					t.Errorf("Publish(%s) error = %v", id, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	waitFor(t, "all jobs", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seen) == publishers*perPublisher
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for id, n := range seen {
+		if n != 1 {
+			t.Errorf("job %s handled %d times, want 1", id, n)
+		}
+	}
+}
+
+func testConcurrencyBound(t *testing.T, newQueue func(queue.Config) queue.Queue) {
+	const concurrency = 4
+	q := newQueue(queue.Config{MaxRetry: 3, Concurrency: concurrency})
+
+	for i := range concurrency * 2 {
+		mustPublish(t, q, &job.Job{ID: fmt.Sprintf("j%d", i)})
+	}
+
+	var running, peak atomic.Int32
+	var handled atomic.Int32
+	release := make(chan struct{})
+	subscribe(t, q, func(_ context.Context, _ *job.Job) error {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-release
+		running.Add(-1)
+		handled.Add(1)
+		return nil
+	})
+
+	waitFor(t, "handlers to start", func() bool { return running.Load() == concurrency })
+	// Give the pool a chance to exceed its bound if it were going to.
+	time.Sleep(100 * time.Millisecond)
+	if got := peak.Load(); got != concurrency {
+		t.Errorf("peak concurrent handlers = %d, want %d", got, concurrency)
+	}
+
+	close(release)
+	waitFor(t, "all jobs", func() bool { return handled.Load() == concurrency*2 })
+}
+
+func testDrainOnCancel(t *testing.T, newQueue func(queue.Config) queue.Queue) {
+	q := newQueue(queue.Config{MaxRetry: 3, Concurrency: 2})
+
+	started := make(chan struct{})
+	var finished atomic.Bool
+	var handlerCtxErr error
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Subscribe(ctx, func(ctx context.Context, _ *job.Job) error {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			handlerCtxErr = ctx.Err()
+			finished.Store(true)
+			return nil
+		})
+	}()
+
+	mustPublish(t, q, &job.Job{ID: "slow"})
+
+	select {
+	case <-started:
+	case <-time.After(waitTimeout):
+		t.Fatal("handler was not called")
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Subscribe() error = %v", err)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("Subscribe did not return after cancel")
+	}
+	if !finished.Load() {
+		t.Error("Subscribe returned before the in-flight handler finished")
+	}
+	if handlerCtxErr != nil {
+		t.Errorf("handler context cancelled during drain: %v", handlerCtxErr)
+	}
+}
@@ -0,0 +1,9 @@
+package storage
+
+import "testing"
+
+// NewTestS3Storage returns an S3Storage backed by an in-process fake S3
+func NewTestS3Storage(t *testing.T) *S3Storage {
+	s, _ := newTestS3Storage(t)
+	return s
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxKeyLength bounds the length of an object key, in bytes
+const MaxKeyLength = 1024
+
+// ErrInvalidKey is returned for keys that ValidateKey rejects
+var ErrInvalidKey = errors.New("invalid object key")
+
+// ValidateKey checks that key is safe to use with any backend. A key is one or
+// more segments separated by "/", each made of ASCII letters, digits, '-', '_'
+// and '.', and neither "." nor "..". Keys cannot be absolute or end in "/".
+func ValidateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("%w: empty", ErrInvalidKey)
+	}
+	if len(key) > MaxKeyLength {
+		return fmt.Errorf("%w: longer than %d bytes", ErrInvalidKey, MaxKeyLength)
+	}
+	for i := 0; i < len(key); i++ {
+		if !isKeyChar(key[i]) {
+			return fmt.Errorf("%w: %q contains %q", ErrInvalidKey, key, key[i])
+		}
+	}
+	for _, segment := range strings.Split(key, "/") {
+		switch segment {
+		case "":
+			return fmt.Errorf("%w: %q has an empty path segment", ErrInvalidKey, key)
+		case ".", "..":
+			return fmt.Errorf("%w: %q contains a %q segment", ErrInvalidKey, key, segment)
+		}
+	}
+	return nil
+}
+
+func isKeyChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return c == '-' || c == '_' || c == '.' || c == '/'
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{"obj", false},
+		{"inputs/3f2a1b4c-9d8e-4f00-a1b2-c3d4e5f60718", false},
+		{"results/job1.jpg", false},
+		{"fonts/My_Font-Bold.v2.ttf", false},
+		{".hidden", false},
+		{"a..b", false},
+		{strings.Repeat("a", MaxKeyLength), false},
+		{"", true},
+		{strings.Repeat("a", MaxKeyLength+1), true},
+		{"/etc/passwd", true},
+		{"..", true},
+		{".", true},
+		{"../escape", true},
+		{"inputs/../../escape", true},
+		{"inputs/./obj", true},
+		{"inputs//obj", true},
+		{"inputs/", true},
+		{`inputs\..\escape`, true},
+		{"C:obj", true},
+		{"with space", true},
+		{"nul\x00byte", true},
+		{"ünïcode", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			err := ValidateKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateKey(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("expected ErrInvalidKey, got %v", err)
+			}
+		})
+	}
+}
+
+// FuzzValidateKey checks that every accepted key stays beneath a base
+// directory when joined to it
+func FuzzValidateKey(f *testing.F) {
+	for _, seed := range []string{"obj", "inputs/a.jpg", "../x", "a/../../b", "/abs", "a//b", ".", "a\\b"} {
+		f.Add(seed)
+	}
+	base := filepath.FromSlash("/srv/storage")
+
+	f.Fuzz(func(t *testing.T, key string) {
+		if ValidateKey(key) != nil {
+			return
+		}
+		path := filepath.Join(base, filepath.FromSlash(key))
+		rel, err := filepath.Rel(base, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			t.Fatalf("accepted key %q resolves to %q, outside %q", key, path, base)
+		}
+		if filepath.Clean(rel) != filepath.FromSlash(key) {
+			t.Fatalf("accepted key %q is not in clean form", key)
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"slices"
+	"strings"
+)
+
+// ListPageSize is the most objects List returns at once
+const ListPageSize = 1000
+
+// ListResult is a page of objects. Cursor fetches the next page; it is empty
+// on the last one.
+type ListResult struct {
+	Objects []Metadata
+	Cursor  string
+}
+
+// pageKeys returns the keys after cursor that start with prefix, at most one
+// page of them in order, and the cursor for the next page. The cursor is the
+// last key returned.
+func pageKeys(keys []string, prefix, cursor string) ([]string, string) {
+	var matched []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) && key > cursor {
+			matched = append(matched, key)
+		}
+	}
+	slices.Sort(matched)
+	if len(matched) <= ListPageSize {
+		return matched, ""
+	}
+	matched = matched[:ListPageSize]
+	return matched, matched[len(matched)-1]
+}
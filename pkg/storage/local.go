@@ -1,69 +1,430 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
-// LocalStorage implements Storage using the local filesystem.
+// ErrChecksumMismatch is returned when a stored object no longer matches the
+// checksum recorded when it was written
+var ErrChecksumMismatch = errors.New("object checksum mismatch")
+
+// Suffixes of the files LocalStorage keeps beside each object. '~' cannot
+// appear in a key, so they never collide with one.
+const (
+	metaSuffix = "~meta"
+	tempSuffix = "~tmp-"
+)
+
+// localMeta is stored as JSON in an object's metadata file
+type localMeta struct {
+	SHA256      string `json:"sha256"`
+	ContentType string `json:"content_type,omitempty"`
+
+	// PreviousSHA256 is the hash of the object this one replaced. Metadata is
+	// written before its object, so the previous object may still be in
+	// place, during the upload or after a crash.
+	PreviousSHA256 string `json:"previous_sha256,omitempty"`
+}
+
+// LocalStorage implements Storage using the local filesystem. Files are
+// accessed through an os.Root, so no key or symlink can reach outside
+// basePath.
+//
+// Uploads are written to a temporary file and renamed into place, so readers
+// never see a partial object. The SHA-256 and content type of each object are
+// stored in a sidecar file, and the hash is verified on Download.
 type LocalStorage struct {
 	basePath string
+	root     *os.Root
+	fsync    bool // sync files and directories before an upload returns
+
+	commitMu sync.Mutex // orders the metadata and renames of uploads and deletes
 }
 
-func NewLocalStorage(basePath string) (*LocalStorage, error) {
+// NewLocalStorage stores objects under basePath. With fsync, an upload is
+// durable once it returns, at the cost of slower writes.
+func NewLocalStorage(basePath string, fsync bool) (*LocalStorage, error) {
 	if err := os.MkdirAll(basePath, 0o750); err != nil {
 		return nil, fmt.Errorf("failed to create storage directory: %w", err)
 	}
-	return &LocalStorage{basePath: basePath}, nil
+	root, err := os.OpenRoot(basePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage directory: %w", err)
+	}
+	return &LocalStorage{basePath: basePath, root: root, fsync: fsync}, nil
 }
 
-func (s *LocalStorage) Upload(_ context.Context, key string, data io.Reader, _ string) error {
-	path := s.path(key)
-	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+func (s *LocalStorage) Upload(_ context.Context, key string, data io.Reader, contentType string) error {
+	name, err := localName(key)
+	if err != nil {
+		return err
+	}
+	if err := s.root.MkdirAll(filepath.Dir(name), 0o750); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
-	f, err := os.Create(path)
+
+	h := sha256.New()
+	tmp, err := s.writeTemp(name, io.TeeReader(data, h))
+	if err != nil {
+		return err
+	}
+	meta := localMeta{SHA256: hex.EncodeToString(h.Sum(nil)), ContentType: contentType}
+	if err := s.commit(name, tmp, meta); err != nil {
+		_ = s.root.Remove(tmp)
+		return err
+	}
+	return s.syncDir(filepath.Dir(name))
+}
+
+// commit renames the object written to tmp into place at name. Its metadata
+// is written first, recording the hash of the object being replaced as well,
+// so whichever object a reader or a crash finds matches it.
+func (s *LocalStorage) commit(name, tmp string, meta localMeta) error {
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+
+	previous, err := s.currentHash(name)
+	if err != nil {
+		return err
+	}
+	meta.PreviousSHA256 = previous
+	data, err := json.Marshal(meta)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	if err := s.writeFile(name+metaSuffix, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	if err := s.syncDir(filepath.Dir(name)); err != nil {
+		return err
+	}
+	if err := s.root.Rename(tmp, name); err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+	return nil
+}
+
+// currentHash returns the hash of the object at name, or "" if there is none.
+// An object without a recorded checksum is hashed.
+func (s *LocalStorage) currentHash(name string) (string, error) {
+	if meta, err := s.meta(name); err == nil && meta.SHA256 != "" {
+		return meta.SHA256, nil
+	}
+	f, err := s.root.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to open file: %w", err)
 	}
 	defer f.Close()
-	if _, err := io.Copy(f, data); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeFile atomically replaces name with the contents of data
+func (s *LocalStorage) writeFile(name string, data io.Reader) error {
+	tmp, err := s.writeTemp(name, data)
+	if err != nil {
+		return err
+	}
+	if err := s.root.Rename(tmp, name); err != nil {
+		_ = s.root.Remove(tmp)
+		return fmt.Errorf("failed to rename file: %w", err)
 	}
 	return nil
 }
 
+// writeTemp writes data to a new temporary file beside name and returns its
+// name. Nothing is left behind if writing fails.
+func (s *LocalStorage) writeTemp(name string, data io.Reader) (string, error) {
+	tmp, err := tempName(name)
+	if err != nil {
+		return "", err
+	}
+	f, err := s.root.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+
+	_, err = io.Copy(f, data)
+	if err != nil {
+		err = fmt.Errorf("failed to write file: %w", err)
+	} else if s.fsync {
+		if err = f.Sync(); err != nil {
+			err = fmt.Errorf("failed to sync file: %w", err)
+		}
+	}
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close file: %w", closeErr)
+	}
+	if err != nil {
+		_ = s.root.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// syncDir makes renames in dir durable, if fsync is enabled
+func (s *LocalStorage) syncDir(dir string) error {
+	if !s.fsync {
+		return nil
+	}
+	d, err := s.root.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+	return nil
+}
+
+// Download opens an object after checking it against its recorded checksum.
+// Objects written before checksums were recorded are returned unverified.
 func (s *LocalStorage) Download(_ context.Context, key string) (io.ReadCloser, error) {
-	f, err := os.Open(s.path(key))
+	name, err := localName(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// The metadata of an upload matches both the object it replaces and its
+	// own, but a second upload may replace it while a file is being read.
+	// Only a repeated mismatch is corruption.
+	for attempt := 0; ; attempt++ {
+		f, err := s.root.Open(name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+			}
+			return nil, fmt.Errorf("failed to open file: %w", err)
+		}
+		err = s.verify(name, f)
+		if err == nil {
+			return f, nil
+		}
+		f.Close()
+		if !errors.Is(err, ErrChecksumMismatch) || attempt > 0 {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+}
+
+// verify hashes f and compares it with the checksum recorded for name,
+// leaving f at its start
+func (s *LocalStorage) verify(name string, f *os.File) error {
+	meta, err := s.meta(name)
+	if err != nil || meta.SHA256 == "" {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != meta.SHA256 && got != meta.PreviousSHA256 {
+		return fmt.Errorf("%w: got sha256 %s, want %s", ErrChecksumMismatch, got, meta.SHA256)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind file: %w", err)
+	}
+	return nil
+}
+
+// meta returns the metadata recorded for name. It is empty for objects written
+// before metadata was recorded.
+func (s *LocalStorage) meta(name string) (localMeta, error) {
+	var meta localMeta
+	data, err := s.root.ReadFile(name + metaSuffix)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("object not found: %s", key)
+			return meta, nil
+		}
+		return meta, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// Stat describes an object. Its ETag is the hex SHA-256 of its content.
+func (s *LocalStorage) Stat(_ context.Context, key string) (Metadata, error) {
+	name, err := localName(key)
+	if err != nil {
+		return Metadata{}, err
+	}
+	info, err := s.root.Stat(name)
+	if err != nil || info.IsDir() {
+		if err == nil || os.IsNotExist(err) {
+			return Metadata{}, fmt.Errorf("%w: %s", ErrNotFound, key)
 		}
-		return nil, fmt.Errorf("failed to open file: %w", err)
+		return Metadata{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+	meta, err := s.meta(name)
+	if err != nil {
+		return Metadata{}, err
 	}
-	return f, nil
+	return Metadata{
+		Key:          key,
+		ContentType:  meta.ContentType,
+		Size:         info.Size(),
+		ETag:         meta.SHA256,
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+// List walks the directory that prefix names in key order, from the cursor,
+// and stops after a page. Listing under a prefix ending in "/" does not visit
+// the rest of the tree, and a page costs about as much as its objects.
+func (s *LocalStorage) List(ctx context.Context, prefix, cursor string) (ListResult, error) {
+	dir := "."
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		dir = prefix[:i]
+		if ValidateKey(dir) != nil {
+			// No valid key can start with this prefix
+			return ListResult{}, nil
+		}
+	}
+
+	// One key beyond the page shows whether there is another
+	keys, err := s.listKeys(ctx, dir, prefix, cursor, ListPageSize+1)
+	if err != nil {
+		return ListResult{}, fmt.Errorf("failed to list files: %w", err)
+	}
+	var next string
+	if len(keys) > ListPageSize {
+		keys = keys[:ListPageSize]
+		next = keys[len(keys)-1]
+	}
+
+	result := ListResult{Objects: make([]Metadata, 0, len(keys)), Cursor: next}
+	for _, key := range keys {
+		meta, err := s.Stat(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			continue // deleted since the walk
+		}
+		if err != nil {
+			return ListResult{}, err
+		}
+		result.Objects = append(result.Objects, meta)
+	}
+	return result, nil
+}
+
+// listKeys returns, in order, up to limit keys under dir that start with
+// prefix and sort after cursor. Entries are visited in key order, where a
+// directory sorts as its name followed by "/", and directories that can hold
+// no such key are skipped.
+func (s *LocalStorage) listKeys(ctx context.Context, dir, prefix, cursor string, limit int) ([]string, error) {
+	var keys []string
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := fs.ReadDir(s.root.FS(), dir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+			return strings.Compare(entryKey(a), entryKey(b))
+		})
+
+		for _, e := range entries {
+			if len(keys) == limit {
+				return nil
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if strings.Contains(e.Name(), "~") {
+				continue
+			}
+			key := path.Join(dir, e.Name())
+			if !e.IsDir() {
+				if key > cursor && strings.HasPrefix(key, prefix) {
+					keys = append(keys, key)
+				}
+				continue
+			}
+
+			sub := key + "/"
+			if cursor > sub && !strings.HasPrefix(cursor, sub) {
+				continue // every key under it is before the cursor
+			}
+			if !strings.HasPrefix(sub, prefix) && !strings.HasPrefix(prefix, sub) {
+				continue
+			}
+			if err := walk(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return keys, walk(dir)
+}
+
+// entryKey returns the name e sorts by among the keys of its directory
+func entryKey(e fs.DirEntry) string {
+	if e.IsDir() {
+		return e.Name() + "/"
+	}
+	return e.Name()
 }
 
 func (s *LocalStorage) Delete(_ context.Context, key string) error {
-	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to delete file: %w", err)
+	name, err := localName(key)
+	if err != nil {
+		return err
+	}
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+	for _, n := range []string{name, name + metaSuffix} {
+		if err := s.root.Remove(n); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete file: %w", err)
+		}
 	}
 	return nil
 }
 
 // GetURL returns a local file path as the URL — no expiry for local storage.
 func (s *LocalStorage) GetURL(_ context.Context, key string, _ time.Duration) (string, error) {
-	return "file://" + s.path(key), nil
+	name, err := localName(key)
+	if err != nil {
+		return "", err
+	}
+	return "file://" + filepath.Join(s.basePath, name), nil
 }
 
 func (s *LocalStorage) Exists(_ context.Context, key string) (bool, error) {
-	_, err := os.Stat(s.path(key))
+	name, err := localName(key)
+	if err != nil {
+		return false, err
+	}
+	// Directories hold the objects under a prefix but are not objects
+	info, err := s.root.Stat(name)
 	if err == nil {
-		return true, nil
+		return !info.IsDir(), nil
 	}
 	if os.IsNotExist(err) {
 		return false, nil
@@ -71,6 +432,28 @@ func (s *LocalStorage) Exists(_ context.Context, key string) (bool, error) {
 	return false, err
 }
 
-func (s *LocalStorage) path(key string) string {
-	return filepath.Join(s.basePath, key)
+// Ping checks that the storage directory still exists. The root stays usable
+// after its directory is removed, so the path is checked instead.
+func (s *LocalStorage) Ping(_ context.Context) error {
+	if _, err := os.Stat(s.basePath); err != nil {
+		return fmt.Errorf("failed to stat storage directory: %w", err)
+	}
+	return nil
+}
+
+// localName validates key and converts it to a path relative to the root
+func localName(key string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.FromSlash(key), nil
+}
+
+// tempName returns a unique temporary name beside name
+func tempName(name string) (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to create temporary name: %w", err)
+	}
+	return name + tempSuffix + hex.EncodeToString(b[:]), nil
 }
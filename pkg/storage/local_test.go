@@ -0,0 +1,260 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/storage"
+)
+
+// errReader fails after returning its data
+type errReader struct{ data []byte }
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestLocalStorage_AtomicUpload(t *testing.T) {
+	dir := t.TempDir()
+	s, err := storage.NewLocalStorage(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := s.Upload(ctx, "obj", bytes.NewReader([]byte("original")), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed upload leaves the previous version and no temporary files
+	if err := s.Upload(ctx, "obj", &errReader{data: []byte("partial")}, ""); err == nil {
+		t.Fatal("expected the upload to fail")
+	}
+	if names := dirNames(t, dir); !slices.Equal(names, []string{"obj", "obj~meta"}) {
+		t.Errorf("files = %v, want only the object and its metadata", names)
+	}
+	rc, err := s.Download(ctx, "obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if got, _ := io.ReadAll(rc); string(got) != "original" {
+		t.Errorf("Download() = %q, want the previous version", got)
+	}
+}
+
+func TestLocalStorage_ConcurrentUploadDelete(t *testing.T) {
+	dir := t.TempDir()
+	s, err := storage.NewLocalStorage(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// An object and its metadata are removed together, so a delete racing an
+	// upload never leaves one without the other
+	for i := 0; i < 200; i++ {
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := s.Upload(ctx, "obj", bytes.NewReader([]byte("data")), ""); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := s.Delete(ctx, "obj"); err != nil {
+				t.Error(err)
+			}
+		}()
+		wg.Wait()
+
+		names := dirNames(t, dir)
+		if len(names) != 0 && !slices.Equal(names, []string{"obj", "obj~meta"}) {
+			t.Fatalf("files = %v, want the object and its metadata or neither", names)
+		}
+	}
+}
+
+func TestLocalStorage_Checksum(t *testing.T) {
+	dir := t.TempDir()
+	s, err := storage.NewLocalStorage(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	data := []byte("image bytes")
+	if err := s.Upload(ctx, "a/obj", bytes.NewReader(data), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256(data)
+	meta, err := s.Stat(ctx, "a/obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.ETag != hex.EncodeToString(sum[:]) || meta.Size != int64(len(data)) {
+		t.Errorf("Stat() = %+v, want ETag %x and size %d", meta, sum, len(data))
+	}
+
+	// The download is verified, and left at the start for reading
+	rc, err := s.Download(ctx, "a/obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if !bytes.Equal(got, data) {
+		t.Errorf("Download() = %q, want %q", got, data)
+	}
+
+	// Corruption on disk is detected
+	if err := os.WriteFile(filepath.Join(dir, "a", "obj"), []byte("image bytez"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Download(ctx, "a/obj"); !errors.Is(err, storage.ErrChecksumMismatch) {
+		t.Errorf("Download() of a corrupted object error = %v, want ErrChecksumMismatch", err)
+	}
+
+	// A crash after an overwrite recorded its metadata leaves the previous
+	// object, which still matches
+	if err := s.Upload(ctx, "a/obj", bytes.NewReader([]byte("replacement")), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a", "obj"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rc, err = s.Download(ctx, "a/obj")
+	if err != nil {
+		t.Fatalf("Download() of the object an interrupted upload replaced error = %v", err)
+	}
+	rc.Close()
+
+	// Objects without a recorded checksum are served unverified
+	if err := os.WriteFile(filepath.Join(dir, "legacy"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rc, err = s.Download(ctx, "legacy")
+	if err != nil {
+		t.Fatalf("Download() of an object without a checksum error = %v", err)
+	}
+	rc.Close()
+
+	// Delete removes the metadata too
+	if err := s.Delete(ctx, "a/obj"); err != nil {
+		t.Fatal(err)
+	}
+	if names := dirNames(t, filepath.Join(dir, "a")); len(names) != 0 {
+		t.Errorf("files left after Delete: %v", names)
+	}
+}
+
+func TestLocalStorage_Ping(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "store")
+	s, err := storage.NewLocalStorage(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ping(context.Background()); err == nil {
+		t.Error("expected Ping to fail once the directory is removed")
+	}
+}
+
+func TestLocalStorage_SymlinkEscape(t *testing.T) {
+	dir := t.TempDir()
+	base, outside := filepath.Join(dir, "base"), filepath.Join(dir, "outside")
+	if err := os.Mkdir(outside, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := storage.NewLocalStorage(base, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(base, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := s.Download(ctx, "link/secret"); err == nil {
+		t.Error("Download through a symlink out of the root succeeded")
+	}
+	if err := s.Upload(ctx, "link/planted", bytes.NewReader([]byte("x")), ""); err == nil {
+		t.Error("Upload through a symlink out of the root succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "planted")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("file was written outside the root: %v", err)
+	}
+}
+
+// FuzzLocalStorage_Confinement checks that no key writes outside the base
+// directory
+func FuzzLocalStorage_Confinement(f *testing.F) {
+	for _, seed := range []string{"obj", "a/b/c", "../escape", "../../etc/passwd", "/abs", "a/../../b", "..\\x", "a/./b", "x/.."} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, key string) {
+		dir := t.TempDir()
+		base := filepath.Join(dir, "base")
+		s, err := storage.NewLocalStorage(base, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.Upload(context.Background(), key, bytes.NewReader([]byte("x")), "")
+		if (err == nil) != (storage.ValidateKey(key) == nil) {
+			t.Fatalf("Upload(%q) error = %v, but ValidateKey disagrees", key, err)
+		}
+
+		err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != dir && path != base && !strings.HasPrefix(path, base+string(filepath.Separator)) {
+				t.Errorf("Upload(%q) created %q outside the base directory", key, path)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
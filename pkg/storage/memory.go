@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryStorage implements Storage in process memory. Objects do not survive
+// a restart, so it suits single-process development and tests.
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+	etag        string
+	modTime     time.Time
+}
+
+func (o memoryObject) metadata(key string) Metadata {
+	return Metadata{
+		Key:          key,
+		ContentType:  o.contentType,
+		Size:         int64(len(o.data)),
+		ETag:         o.etag,
+		LastModified: o.modTime,
+	}
+}
+
+// memoryReader makes a stored object seekable so Range requests can be served.
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (memoryReader) Close() error { return nil }
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{objects: make(map[string]memoryObject)}
+}
+
+func (s *MemoryStorage) Upload(_ context.Context, key string, data io.Reader, contentType string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return fmt.Errorf("failed to read data: %w", err)
+	}
+
+	sum := sha256.Sum256(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = memoryObject{data: b, contentType: contentType, etag: hex.EncodeToString(sum[:]), modTime: time.Now()}
+	return nil
+}
+
+func (s *MemoryStorage) Download(_ context.Context, key string) (io.ReadCloser, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return memoryReader{bytes.NewReader(obj.data)}, nil
+}
+
+func (s *MemoryStorage) Delete(_ context.Context, key string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+// GetURL returns a memory:// URL; objects are only reachable through the API.
+func (s *MemoryStorage) GetURL(_ context.Context, key string, _ time.Duration) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	return "memory://" + key, nil
+}
+
+func (s *MemoryStorage) Exists(_ context.Context, key string) (bool, error) {
+	if err := ValidateKey(key); err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.objects[key]
+	return ok, nil
+}
+
+// Ping always succeeds
+func (s *MemoryStorage) Ping(_ context.Context) error {
+	return nil
+}
+
+// Stat describes an object. Its ETag is the hex SHA-256 of its content.
+func (s *MemoryStorage) Stat(_ context.Context, key string) (Metadata, error) {
+	if err := ValidateKey(key); err != nil {
+		return Metadata{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[key]
+	if !ok {
+		return Metadata{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return obj.metadata(key), nil
+}
+
+func (s *MemoryStorage) List(_ context.Context, prefix, cursor string) (ListResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys, next := pageKeys(slices.Collect(maps.Keys(s.objects)), prefix, cursor)
+	result := ListResult{Objects: make([]Metadata, 0, len(keys)), Cursor: next}
+	for _, key := range keys {
+		result.Objects = append(result.Objects, s.objects[key].metadata(key))
+	}
+	return result, nil
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3PartSize bounds the buffer used for uploads of unknown length; without it
+// the client sizes parts for a 5TiB object.
+const s3PartSize = 16 << 20
+
+// S3Storage implements Storage using an S3-compatible object store (AWS S3, MinIO).
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3Storage creates a new S3 storage backend, creating the bucket if it does not exist
+func NewS3Storage(config Config) (*S3Storage, error) {
+	return newS3Storage(config, nil)
+}
+
+// newS3Storage allows tests to supply a transport trusting a local TLS server.
+func newS3Storage(config Config, transport http.RoundTripper) (*S3Storage, error) {
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure:    config.UseSSL,
+		Region:    config.Region,
+		Transport: transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket: %w", err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket: %w", err)
+		}
+	}
+
+	return &S3Storage{client: client, bucket: config.Bucket}, nil
+}
+
+func (s *S3Storage) Upload(ctx context.Context, key string, data io.Reader, contentType string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, key, data, -1, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    s3PartSize,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	return nil
+}
+
+// Download returns the object as a *minio.Object, which also implements io.Seeker.
+func (s *S3Storage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	// GetObject is lazy; Stat surfaces a missing key before the caller reads.
+	if _, err := obj.Stat(); err != nil {
+		_ = obj.Close()
+		if isS3NotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to stat object: %w", err)
+	}
+	return obj, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+// GetURL returns a presigned GET URL valid for expiry.
+func (s *S3Storage) GetURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign URL: %w", err)
+	}
+	return u.String(), nil
+}
+
+func (s *S3Storage) Exists(ctx context.Context, key string) (bool, error) {
+	if err := ValidateKey(key); err != nil {
+		return false, err
+	}
+	_, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if isS3NotFound(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to stat object: %w", err)
+}
+
+// Ping checks that the bucket is reachable
+func (s *S3Storage) Ping(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("failed to check bucket: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("bucket %q does not exist", s.bucket)
+	}
+	return nil
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (Metadata, error) {
+	if err := ValidateKey(key); err != nil {
+		return Metadata{}, err
+	}
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if isS3NotFound(err) {
+			return Metadata{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return Metadata{}, fmt.Errorf("failed to stat object: %w", err)
+	}
+	return s3Metadata(info), nil
+}
+
+// List pages through the bucket with ListObjectsV2. Listings do not include
+// content types; use Stat for those.
+func (s *S3Storage) List(ctx context.Context, prefix, cursor string) (ListResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops the listing goroutine once a page is read
+
+	var result ListResult
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:     prefix,
+		Recursive:  true,
+		StartAfter: cursor,
+		MaxKeys:    ListPageSize,
+	})
+	for info := range objects {
+		if info.Err != nil {
+			return ListResult{}, fmt.Errorf("failed to list objects: %w", info.Err)
+		}
+		if len(result.Objects) == ListPageSize {
+			result.Cursor = result.Objects[len(result.Objects)-1].Key
+			break
+		}
+		result.Objects = append(result.Objects, s3Metadata(info))
+	}
+	return result, nil
+}
+
+func s3Metadata(info minio.ObjectInfo) Metadata {
+	return Metadata{
+		Key:          info.Key,
+		ContentType:  info.ContentType,
+		Size:         info.Size,
+		ETag:         strings.Trim(info.ETag, `"`),
+		LastModified: info.LastModified,
+	}
+}
+
+func isS3NotFound(err error) bool {
+	return minio.ToErrorResponse(err).Code == minio.NoSuchKey
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+func newTestS3Storage(t *testing.T) (*S3Storage, *http.Client) {
+	t.Helper()
+	// TLS avoids aws-chunked streaming uploads, which the fake does not decode.
+	srv := httptest.NewTLSServer(gofakes3.New(s3mem.New()).Server())
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newS3Storage(Config{
+		Endpoint:  u.Host,
+		Bucket:    "test-bucket",
+		AccessKey: "access",
+		SecretKey: "secret",
+		Region:    "us-east-1",
+		UseSSL:    true,
+	}, srv.Client().Transport)
+	if err != nil {
+		t.Fatalf("NewS3Storage() error = %v", err)
+	}
+	return s, srv.Client()
+}
+
+func TestS3Storage_UploadDownload(t *testing.T) {
+	s, _ := newTestS3Storage(t)
+	ctx := context.Background()
+
+	if err := s.Upload(ctx, "results/a.jpg", bytes.NewReader([]byte("hello")), "image/jpeg"); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	rc, err := s.Download(ctx, "results/a.jpg")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("Download() = %q, want %q", data, "hello")
+	}
+	if _, ok := rc.(io.Seeker); !ok {
+		t.Error("Download() result should be seekable")
+	}
+}
+
+func TestS3Storage_GetURL(t *testing.T) {
+	s, client := newTestS3Storage(t)
+	ctx := context.Background()
+
+	if err := s.Upload(ctx, "k", bytes.NewReader([]byte("signed")), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := s.GetURL(ctx, "k", 15*time.Minute)
+	if err != nil {
+		t.Fatalf("GetURL() error = %v", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Query().Get("X-Amz-Expires"); got != "900" {
+		t.Errorf("X-Amz-Expires = %q, want 900", got)
+	}
+
+	resp, err := client.Get(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "signed" {
+		t.Errorf("GET presigned URL = %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestNew(t *testing.T) {
+	s, err := New(Config{Type: "local", LocalPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New(local) error = %v", err)
+	}
+	if _, ok := s.(*LocalStorage); !ok {
+		t.Errorf("New(local) = %T, want *LocalStorage", s)
+	}
+
+	if _, err := New(Config{Type: "ftp"}); err == nil {
+		t.Error("New(ftp) expected error")
+	}
+}
@@ -2,11 +2,17 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"time"
 )
 
-// Storage defines the interface for object storage
+// ErrNotFound is returned when the requested object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// Storage defines the interface for object storage. Keys must pass
+// ValidateKey; every method returns ErrInvalidKey for one that does not.
 type Storage interface {
 	// Upload uploads data to storage and returns the key
 	Upload(ctx context.Context, key string, data io.Reader, contentType string) error
@@ -23,19 +29,28 @@ type Storage interface {
 	
 	// Exists checks if an object exists
 	Exists(ctx context.Context, key string) (bool, error)
+
+	// Stat describes an object, returning ErrNotFound if it does not exist
+	Stat(ctx context.Context, key string) (Metadata, error)
+
+	// List returns a page of the objects whose keys start with prefix, in
+	// key order. cursor is empty for the first page, then the Cursor of the
+	// previous result.
+	List(ctx context.Context, prefix, cursor string) (ListResult, error)
 }
 
 // Metadata represents object metadata
 type Metadata struct {
-	ContentType string
-	Size        int64
-	ETag        string
+	Key          string
+	ContentType  string
+	Size         int64
+	ETag         string
 	LastModified time.Time
 }
 
 // Config represents storage configuration
 type Config struct {
-	Type       string // "minio", "s3", "local"
+	Type       string // "minio", "s3", "local", "memory"
 	Endpoint   string
 	Bucket     string
 	AccessKey  string
@@ -43,4 +58,19 @@ type Config struct {
 	Region     string
 	UseSSL     bool
 	LocalPath  string // for local storage
-}
\ No newline at end of file
+	LocalFsync bool   // sync local uploads to disk before returning
+}
+
+// New creates the storage backend selected by config.Type
+func New(config Config) (Storage, error) {
+	switch config.Type {
+	case "local", "":
+		return NewLocalStorage(config.LocalPath, config.LocalFsync)
+	case "s3", "minio":
+		return NewS3Storage(config)
+	case "memory":
+		return NewMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", config.Type)
+	}
+}
@@ -0,0 +1,30 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/storage"
+	"github.com/mohammed-ysn/cluster-imager/pkg/storage/storagetest"
+)
+
+func TestLocalStorage(t *testing.T) {
+	storagetest.RunStorageSuite(t, func(t *testing.T) storage.Storage {
+		s, err := storage.NewLocalStorage(t.TempDir(), true)
+		if err != nil {
+			t.Fatalf("NewLocalStorage() error = %v", err)
+		}
+		return s
+	})
+}
+
+func TestMemoryStorage(t *testing.T) {
+	storagetest.RunStorageSuite(t, func(*testing.T) storage.Storage {
+		return storage.NewMemoryStorage()
+	})
+}
+
+func TestS3Storage(t *testing.T) {
+	storagetest.RunStorageSuite(t, func(t *testing.T) storage.Storage {
+		return storage.NewTestS3Storage(t)
+	})
+}
@@ -0,0 +1,336 @@
+// Package storagetest provides a conformance suite for storage.Storage
+// implementations.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mohammed-ysn/cluster-imager/pkg/storage"
+)
+
+// RunStorageSuite runs the storage.Storage conformance tests. newStorage is
+// called once per subtest and must return an empty storage.
+func RunStorageSuite(t *testing.T, newStorage func(t *testing.T) storage.Storage) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Storage)
+	}{
+		{"UploadDownload", testUploadDownload},
+		{"Overwrite", testOverwrite},
+		{"NestedKeys", testNestedKeys},
+		{"DownloadNotFound", testDownloadNotFound},
+		{"ExistsDelete", testExistsDelete},
+		{"DeleteMissing", testDeleteMissing},
+		{"GetURL", testGetURL},
+		{"ConcurrentAccess", testConcurrentAccess},
+		{"InvalidKeys", testInvalidKeys},
+		{"Stat", testStat},
+		{"List", testList},
+		{"ListPages", testListPages},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStorage(t))
+		})
+	}
+}
+
+func mustUpload(t *testing.T, s storage.Storage, key string, data []byte) {
+	t.Helper()
+	if err := s.Upload(context.Background(), key, bytes.NewReader(data), "application/octet-stream"); err != nil {
+		t.Fatalf("Upload(%s) error = %v", key, err)
+	}
+}
+
+func mustDownload(t *testing.T, s storage.Storage, key string) []byte {
+	t.Helper()
+	rc, err := s.Download(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Download(%s) error = %v", key, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading %s: %v", key, err)
+	}
+	return data
+}
+
+func mustExist(t *testing.T, s storage.Storage, key string, want bool) {
+	t.Helper()
+	got, err := s.Exists(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Exists(%s) error = %v", key, err)
+	}
+	if got != want {
+		t.Errorf("Exists(%s) = %v, want %v", key, got, want)
+	}
+}
+
+func testUploadDownload(t *testing.T, s storage.Storage) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	mustUpload(t, s, "obj", data)
+
+	if got := mustDownload(t, s, "obj"); !bytes.Equal(got, data) {
+		t.Errorf("Download() returned %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func testOverwrite(t *testing.T, s storage.Storage) {
+	mustUpload(t, s, "obj", []byte("a longer first version"))
+	mustUpload(t, s, "obj", []byte("second"))
+
+	if got := mustDownload(t, s, "obj"); string(got) != "second" {
+		t.Errorf("Download() = %q, want %q", got, "second")
+	}
+}
+
+func testNestedKeys(t *testing.T, s storage.Storage) {
+	mustUpload(t, s, "uploads/a/b/c.jpg", []byte("deep"))
+	mustUpload(t, s, "uploads/a/d.jpg", []byte("shallow"))
+
+	if got := mustDownload(t, s, "uploads/a/b/c.jpg"); string(got) != "deep" {
+		t.Errorf("Download() = %q, want %q", got, "deep")
+	}
+	if got := mustDownload(t, s, "uploads/a/d.jpg"); string(got) != "shallow" {
+		t.Errorf("Download() = %q, want %q", got, "shallow")
+	}
+	mustExist(t, s, "uploads/a/b/c.jpg", true)
+
+	// A prefix holding objects is not an object
+	mustExist(t, s, "uploads/a", false)
+	if _, err := s.Stat(context.Background(), "uploads/a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat() of a prefix error = %v, want ErrNotFound", err)
+	}
+}
+
+func testDownloadNotFound(t *testing.T, s storage.Storage) {
+	_, err := s.Download(context.Background(), "missing")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Download() error = %v, want ErrNotFound", err)
+	}
+}
+
+func testExistsDelete(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	mustExist(t, s, "obj", false)
+
+	mustUpload(t, s, "obj", []byte("x"))
+	mustExist(t, s, "obj", true)
+
+	if err := s.Delete(ctx, "obj"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	mustExist(t, s, "obj", false)
+	if _, err := s.Download(ctx, "obj"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Download() after Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func testDeleteMissing(t *testing.T, s storage.Storage) {
+	if err := s.Delete(context.Background(), "missing"); err != nil {
+		t.Errorf("Delete() of missing key error = %v, want nil", err)
+	}
+}
+
+func testGetURL(t *testing.T, s storage.Storage) {
+	mustUpload(t, s, "obj", []byte("x"))
+
+	url, err := s.GetURL(context.Background(), "obj", time.Minute)
+	if err != nil {
+		t.Fatalf("GetURL() error = %v", err)
+	}
+	if url == "" {
+		t.Error("GetURL() returned an empty URL")
+	}
+}
+
+func testStat(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	if err := s.Upload(ctx, "results/a.png", bytes.NewReader([]byte("image")), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := s.Stat(ctx, "results/a.png")
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if meta.Key != "results/a.png" || meta.ContentType != "image/png" || meta.Size != 5 {
+		t.Errorf("Stat() = %+v", meta)
+	}
+	if meta.ETag == "" || meta.LastModified.IsZero() {
+		t.Errorf("Stat() = %+v, want an ETag and modification time", meta)
+	}
+
+	// The ETag changes with the content
+	mustUpload(t, s, "results/a.png", []byte("other"))
+	if changed, err := s.Stat(ctx, "results/a.png"); err != nil || changed.ETag == meta.ETag {
+		t.Errorf("Stat() after overwrite = %+v, %v, want a new ETag", changed, err)
+	}
+
+	if _, err := s.Stat(ctx, "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat() error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Stat(ctx, "../a"); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Errorf("Stat() error = %v, want ErrInvalidKey", err)
+	}
+}
+
+func listKeys(t *testing.T, s storage.Storage, prefix string) []string {
+	t.Helper()
+	result, err := s.List(context.Background(), prefix, "")
+	if err != nil {
+		t.Fatalf("List(%q) error = %v", prefix, err)
+	}
+	if result.Cursor != "" {
+		t.Errorf("List(%q) cursor = %q, want the last page", prefix, result.Cursor)
+	}
+	keys := []string{}
+	for _, obj := range result.Objects {
+		keys = append(keys, obj.Key)
+	}
+	return keys
+}
+
+func testList(t *testing.T, s storage.Storage) {
+	for _, key := range []string{"inputs/b", "inputs/a", "inputs/a.d/x", "inputs/ab", "results/a", "inputsx"} {
+		mustUpload(t, s, key, []byte(key))
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"", []string{"inputs/a", "inputs/a.d/x", "inputs/ab", "inputs/b", "inputsx", "results/a"}},
+		{"inputs/", []string{"inputs/a", "inputs/a.d/x", "inputs/ab", "inputs/b"}},
+		{"inputs/a", []string{"inputs/a", "inputs/a.d/x", "inputs/ab"}},
+		{"inputs", []string{"inputs/a", "inputs/a.d/x", "inputs/ab", "inputs/b", "inputsx"}},
+		{"inputs/a.d/", []string{"inputs/a.d/x"}},
+		{"missing/", []string{}},
+		{"../", []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := listKeys(t, s, tt.prefix); !slices.Equal(got, tt.want) {
+			t.Errorf("List(%q) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+
+	result, err := s.List(context.Background(), "results/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj := result.Objects[0]; obj.Size != int64(len("results/a")) || obj.ETag == "" {
+		t.Errorf("listed object = %+v, want its size and ETag", obj)
+	}
+
+	// A cursor resumes after its key, wherever it falls in the tree
+	for _, key := range []string{"tree/a-b", "tree/a/1", "tree/a/2", "tree/b/1"} {
+		mustUpload(t, s, key, []byte(key))
+	}
+	if result, err = s.List(context.Background(), "tree/", "tree/a/1"); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, obj := range result.Objects {
+		keys = append(keys, obj.Key)
+	}
+	if want := []string{"tree/a/2", "tree/b/1"}; !slices.Equal(keys, want) {
+		t.Errorf("List() after %q = %v, want %v", "tree/a/1", keys, want)
+	}
+}
+
+func testListPages(t *testing.T, s storage.Storage) {
+	const n = storage.ListPageSize + 3
+	for i := range n {
+		mustUpload(t, s, fmt.Sprintf("page/%04d", i), []byte("x"))
+	}
+
+	var keys []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 2 {
+			t.Fatal("List() did not finish in 2 pages")
+		}
+		result, err := s.List(context.Background(), "page/", cursor)
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		for _, obj := range result.Objects {
+			keys = append(keys, obj.Key)
+		}
+		if cursor = result.Cursor; cursor == "" {
+			break
+		}
+	}
+
+	if len(keys) != n || !slices.IsSorted(keys) {
+		t.Fatalf("listed %d keys (sorted %v), want %d in order", len(keys), slices.IsSorted(keys), n)
+	}
+	if len(slices.Compact(slices.Clone(keys))) != n {
+		t.Error("List() returned duplicate keys across pages")
+	}
+}
+
+func testInvalidKeys(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	for _, key := range []string{"", "/etc/passwd", "../escape", "a/../../b", "a//b", "a/", "a\\b", "a b"} {
+		if err := s.Upload(ctx, key, bytes.NewReader([]byte("x")), ""); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("Upload(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := s.Download(ctx, key); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("Download(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := s.Exists(ctx, key); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("Exists(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if err := s.Delete(ctx, key); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("Delete(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := s.GetURL(ctx, key, time.Minute); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("GetURL(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func testConcurrentAccess(t *testing.T, s storage.Storage) {
+	const workers = 8
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := fmt.Sprintf("concurrent/%d", i)
+			data := bytes.Repeat([]byte{byte(i)}, 1024)
+			for range 5 {
+				if err := s.Upload(context.Background(), key, bytes.NewReader(data), ""); err != nil {
+					t.Errorf("Upload(%s) error = %v", key, err)
+					return
+				}
+				rc, err := s.Download(context.Background(), key)
+				if err != nil {
+					t.Errorf("Download(%s) error = %v", key, err)
+					return
+				}
+				got, err := io.ReadAll(rc)
+				rc.Close()
+				if err != nil || !bytes.Equal(got, data) {
+					t.Errorf("Download(%s) = %d bytes, err %v", key, len(got), err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
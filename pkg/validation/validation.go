@@ -3,6 +3,11 @@ package validation
 import (
 	"errors"
 	"fmt"
+	"image/color"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -61,13 +66,129 @@ func ValidateCropParams(x, y, width, height int, imgWidth, imgHeight int) error
 	return nil
 }
 
+// Resize modes
+const (
+	ResizeStretch = "stretch" // scale to exactly width x height, ignoring aspect ratio
+	ResizeFit     = "fit"     // scale to fit within width x height
+	ResizeFill    = "fill"    // scale to cover width x height, then crop to it
+	ResizeCover   = "cover"   // alias for ResizeFill
+	ResizePad     = "pad"     // scale to fit, then pad to width x height
+)
+
+// Gravities position an image when cropping (fill) or padding (pad)
+var Gravities = []string{
+	"center", "north", "south", "east", "west",
+	"north-east", "north-west", "south-east", "south-west",
+}
+
+// ResizeFilters are the supported resampling kernels
+var ResizeFilters = []string{
+	"nearest", "bilinear", "bicubic", "mitchell", "lanczos2", "lanczos3",
+}
+
+// ResizeParams represents parameters for resize operation. A zero Width or
+// Height is derived from the other, keeping the aspect ratio.
+type ResizeParams struct {
+	Width      int
+	Height     int
+	Mode       string // defaults to ResizeStretch
+	Gravity    string // defaults to "center"
+	Background string // pad colour as #rgb, #rrggbb or #rrggbbaa
+	Filter     string // one of ResizeFilters, defaults to "lanczos2"
+	Linear     bool   // resample in linear light rather than sRGB
+}
+
 // ValidateResizeParams validates resize parameters
-func ValidateResizeParams(width, height int) error {
-	if err := ValidateDimension(width, "width"); err != nil {
-		return err
+func ValidateResizeParams(p ResizeParams) error {
+	if p.Width == 0 && p.Height == 0 {
+		return fmt.Errorf("width or height is required: %w", ErrInvalidDimension)
 	}
-	if err := ValidateDimension(height, "height"); err != nil {
-		return err
+	if p.Width != 0 {
+		if err := ValidateDimension(p.Width, "width"); err != nil {
+			return err
+		}
+	}
+	if p.Height != 0 {
+		if err := ValidateDimension(p.Height, "height"); err != nil {
+			return err
+		}
+	}
+
+	switch p.Mode {
+	case "", ResizeStretch, ResizeFit:
+	case ResizeFill, ResizeCover, ResizePad:
+		if p.Width == 0 || p.Height == 0 {
+			return fmt.Errorf("%s mode requires both width and height", p.Mode)
+		}
+	default:
+		return fmt.Errorf("unknown resize mode %q", p.Mode)
+	}
+
+	if p.Gravity != "" && !slices.Contains(Gravities, p.Gravity) {
+		return fmt.Errorf("unknown gravity %q", p.Gravity)
+	}
+	if p.Filter != "" && !slices.Contains(ResizeFilters, p.Filter) {
+		return fmt.Errorf("unknown resize filter %q", p.Filter)
+	}
+	if p.Background != "" {
+		if _, err := ParseColor(p.Background); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateRange checks that a parameter lies within [min, max]
+func ValidateRange(value, min, max float64, name string) error {
+	if math.IsNaN(value) || value < min || value > max {
+		return fmt.Errorf("%s must be between %g and %g", name, min, max)
+	}
+	return nil
+}
+
+// FlipDirections are the axes an image can be mirrored in
+var FlipDirections = []string{"horizontal", "vertical"}
+
+// TextAlignments position each line of text within its box
+var TextAlignments = []string{"left", "center", "right"}
+
+// TextVerticalAlignments position a block of text within its box
+var TextVerticalAlignments = []string{"top", "middle", "bottom"}
+
+// ValidateRotateParams validates rotation parameters. Angles are in degrees.
+func ValidateRotateParams(angle float64, background string) error {
+	if math.IsNaN(angle) || math.IsInf(angle, 0) {
+		return fmt.Errorf("angle must be a finite number")
+	}
+	if background != "" {
+		if _, err := ParseColor(background); err != nil {
+			return err
+		}
 	}
 	return nil
 }
+
+// ValidateFlipParams validates the flip direction
+func ValidateFlipParams(direction string) error {
+	if !slices.Contains(FlipDirections, direction) {
+		return fmt.Errorf("direction must be one of %s", strings.Join(FlipDirections, ", "))
+	}
+	return nil
+}
+
+// ParseColor parses a hex colour: #rgb, #rrggbb or #rrggbbaa
+func ParseColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || !strings.HasPrefix(s, "#") || err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid colour %q: use #rgb, #rrggbb or #rrggbbaa", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil //nolint:gosec
+}
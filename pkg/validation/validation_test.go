@@ -1,6 +1,8 @@
 package validation
 
 import (
+	"image/color"
+	"math"
 	"testing"
 )
 
@@ -62,27 +64,139 @@ func TestValidateCropParams(t *testing.T) {
 func TestValidateResizeParams(t *testing.T) {
 	tests := []struct {
 		name    string
-		width   int
-		height  int
+		params  ResizeParams
 		wantErr bool
 	}{
-		{"valid resize", 100, 200, false},
-		{"minimum size", 1, 1, false},
-		{"maximum size", 10000, 10000, false},
-		{"zero width", 0, 100, true},
-		{"zero height", 100, 0, true},
-		{"negative width", -100, 200, true},
-		{"negative height", 100, -200, true},
-		{"exceeds max width", 10001, 200, true},
-		{"exceeds max height", 100, 10001, true},
+		{"valid resize", ResizeParams{Width: 100, Height: 200}, false},
+		{"minimum size", ResizeParams{Width: 1, Height: 1}, false},
+		{"maximum size", ResizeParams{Width: 10000, Height: 10000}, false},
+		{"derived width", ResizeParams{Height: 100}, false},
+		{"derived height", ResizeParams{Width: 100}, false},
+		{"no dimensions", ResizeParams{}, true},
+		{"negative width", ResizeParams{Width: -100, Height: 200}, true},
+		{"negative height", ResizeParams{Width: 100, Height: -200}, true},
+		{"exceeds max width", ResizeParams{Width: 10001, Height: 200}, true},
+		{"exceeds max height", ResizeParams{Width: 100, Height: 10001}, true},
+		{"fit", ResizeParams{Width: 100, Height: 100, Mode: ResizeFit}, false},
+		{"fit single dimension", ResizeParams{Width: 100, Mode: ResizeFit}, false},
+		{"fill with gravity", ResizeParams{Width: 100, Height: 100, Mode: ResizeFill, Gravity: "south-east"}, false},
+		{"cover", ResizeParams{Width: 100, Height: 100, Mode: ResizeCover}, false},
+		{"fill single dimension", ResizeParams{Width: 100, Mode: ResizeFill}, true},
+		{"pad with background", ResizeParams{Width: 100, Height: 100, Mode: ResizePad, Background: "#ff000080"}, false},
+		{"pad single dimension", ResizeParams{Height: 100, Mode: ResizePad}, true},
+		{"unknown mode", ResizeParams{Width: 100, Height: 100, Mode: "squash"}, true},
+		{"unknown gravity", ResizeParams{Width: 100, Height: 100, Mode: ResizeFill, Gravity: "up"}, true},
+		{"invalid background", ResizeParams{Width: 100, Height: 100, Mode: ResizePad, Background: "red"}, true},
+		{"nearest filter", ResizeParams{Width: 100, Filter: "nearest"}, false},
+		{"linear mitchell", ResizeParams{Width: 100, Filter: "mitchell", Linear: true}, false},
+		{"unknown filter", ResizeParams{Width: 100, Filter: "box"}, true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := ValidateResizeParams(tt.width, tt.height)
+			err := ValidateResizeParams(tt.params)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateResizeParams() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    color.NRGBA
+		wantErr bool
+	}{
+		{"#fff", color.NRGBA{255, 255, 255, 255}, false},
+		{"#ff8000", color.NRGBA{255, 128, 0, 255}, false},
+		{"#FF800080", color.NRGBA{255, 128, 0, 128}, false},
+		{"#00000000", color.NRGBA{0, 0, 0, 0}, false},
+		{"ff8000", color.NRGBA{}, true},
+		{"#ff80", color.NRGBA{}, true},
+		{"#gggggg", color.NRGBA{}, true},
+		{"", color.NRGBA{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseColor(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseColor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseColor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRotateParams(t *testing.T) {
+	tests := []struct {
+		name       string
+		angle      float64
+		background string
+		wantErr    bool
+	}{
+		{"right angle", 90, "", false},
+		{"arbitrary angle", -12.5, "#00000000", false},
+		{"large angle", 720, "", false},
+		{"not a number", math.NaN(), "", true},
+		{"infinite", math.Inf(1), "", true},
+		{"invalid background", 45, "white", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRotateParams(tt.angle, tt.background)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRotateParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateFlipParams(t *testing.T) {
+	tests := []struct {
+		direction string
+		wantErr   bool
+	}{
+		{"horizontal", false},
+		{"vertical", false},
+		{"", true},
+		{"diagonal", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.direction, func(t *testing.T) {
+			err := ValidateFlipParams(tt.direction)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFlipParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   float64
+		wantErr bool
+	}{
+		{"minimum", -1, false},
+		{"inside", 0.5, false},
+		{"maximum", 1, false},
+		{"below", -1.01, true},
+		{"above", 2, true},
+		{"not a number", math.NaN(), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRange(tt.value, -1, 1, "amount")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}